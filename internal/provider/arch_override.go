@@ -0,0 +1,42 @@
+package provider
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/ko/pkg/build"
+)
+
+// parseArchOverride splits an `arch_override` value, `arch` or `arch/variant`, into its architecture and variant.
+func parseArchOverride(s string) (arch, variant string, err error) {
+	arch, variant, _ = strings.Cut(s, "/")
+	if arch == "" || strings.Contains(variant, "/") || (strings.Contains(s, "/") && variant == "") {
+		return "", "", fmt.Errorf("expected arch or arch/variant, got %q", s)
+	}
+	return arch, variant, nil
+}
+
+// withArchOverride returns the built image with the architecture and variant declared in its config replaced by override,
+// whatever the binary was actually built for. This makes a mismatched image, so it's only for testing under emulation.
+// Only a single image can be overridden, since the images of an index would end up declaring the same platform.
+func withArchOverride(res build.Result, override string) (build.Result, error) {
+	arch, variant, err := parseArchOverride(override)
+	if err != nil {
+		return nil, err
+	}
+	img, ok := res.(v1.Image)
+	if !ok {
+		return nil, errors.New("arch_override requires building for a single platform")
+	}
+	cf, err := img.ConfigFile()
+	if err != nil {
+		return nil, err
+	}
+	cf = cf.DeepCopy()
+	cf.Architecture = arch
+	cf.Variant = variant
+	return mutate.ConfigFile(img, cf)
+}
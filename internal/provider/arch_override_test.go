@@ -0,0 +1,93 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/registry"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+)
+
+func TestParseArchOverride(t *testing.T) {
+	for _, tc := range []struct {
+		in, arch, variant string
+		wantErr           bool
+	}{
+		{in: "arm64", arch: "arm64"},
+		{in: "arm/v7", arch: "arm", variant: "v7"},
+		{in: "", wantErr: true},
+		{in: "arm/", wantErr: true},
+		{in: "/v7", wantErr: true},
+		{in: "linux/arm/v7", wantErr: true},
+	} {
+		arch, variant, err := parseArchOverride(tc.in)
+		if (err != nil) != tc.wantErr {
+			t.Errorf("parseArchOverride(%q): expected error %t, got %v", tc.in, tc.wantErr, err)
+			continue
+		}
+		if arch != tc.arch || variant != tc.variant {
+			t.Errorf("parseArchOverride(%q) = %q, %q, want %q, %q", tc.in, arch, variant, tc.arch, tc.variant)
+		}
+	}
+}
+
+func TestDoBuild_ArchOverride(t *testing.T) {
+	srv := httptest.NewServer(registry.New())
+	defer srv.Close()
+	parts := strings.Split(srv.URL, ":")
+	url := fmt.Sprintf("localhost:%s/test", parts[len(parts)-1])
+	base := pushBaseIndex(t, url+"/base",
+		v1.Platform{OS: "linux", Architecture: "amd64"},
+		v1.Platform{OS: "linux", Architecture: "arm64"},
+	)
+
+	opts := buildOptions{
+		ip:           "github.com/ko-build/terraform-provider-ko/cmd/test",
+		workingDir:   ".",
+		imageRepo:    url,
+		platforms:    []string{"linux/amd64"},
+		baseImage:    base,
+		sbom:         "none",
+		archOverride: "arm/v7",
+		forceIndex:   true,
+	}
+	res, _, err := doBuild(context.Background(), opts)
+	if err != nil {
+		t.Fatalf("doBuild: %v", err)
+	}
+	idx, ok := res.(v1.ImageIndex)
+	if !ok {
+		t.Fatalf("expected an index with force_index, got %T", res)
+	}
+	im, err := idx.IndexManifest()
+	if err != nil {
+		t.Fatalf("IndexManifest: %v", err)
+	}
+	if len(im.Manifests) != 1 {
+		t.Fatalf("expected 1 image, got %d", len(im.Manifests))
+	}
+	// The index declares the overridden platform too.
+	if p := im.Manifests[0].Platform; p == nil || p.Architecture != "arm" || p.Variant != "v7" {
+		t.Errorf("expected index platform arm/v7, got %v", p)
+	}
+	img, err := idx.Image(im.Manifests[0].Digest)
+	if err != nil {
+		t.Fatalf("Image: %v", err)
+	}
+	cf, err := img.ConfigFile()
+	if err != nil {
+		t.Fatalf("ConfigFile: %v", err)
+	}
+	if cf.OS != "linux" || cf.Architecture != "arm" || cf.Variant != "v7" {
+		t.Errorf("expected config platform linux/arm/v7, got %s/%s/%s", cf.OS, cf.Architecture, cf.Variant)
+	}
+
+	// The images of an index can't all declare the same platform.
+	opts.platforms = []string{"linux/amd64", "linux/arm64"}
+	if _, _, err := doBuild(context.Background(), opts); err == nil {
+		t.Error("expected an error overriding the architecture of a multi-platform build")
+	}
+}
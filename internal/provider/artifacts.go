@@ -0,0 +1,75 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/ko/pkg/build"
+	"github.com/sigstore/cosign/v2/pkg/oci"
+	"github.com/sigstore/cosign/v2/pkg/oci/walk"
+)
+
+// artifactOptions returns the options to use for requests to o.artifactRepo, with o.artifactAuth in place of the resource's credentials.
+func (o *buildOptions) artifactOptions() buildOptions {
+	ao := *o
+	ao.imageRepo = o.artifactRepo
+	ao.resourceAuth = o.artifactAuth
+	return ao
+}
+
+// artifactRef returns ref, a reference by digest, with its repository replaced by o.artifactRepo if that's set,
+// for naming the tags artifacts of the image are stored at.
+func (o *buildOptions) artifactRef(ref string) (string, error) {
+	if o.artifactRepo == "" {
+		return ref, nil
+	}
+	dig, err := name.NewDigest(ref)
+	if err != nil {
+		return "", err
+	}
+	repo, err := name.NewRepository(o.artifactRepo)
+	if err != nil {
+		return "", err
+	}
+	return repo.Digest(dig.DigestStr()).String(), nil
+}
+
+// uploadSBOMs pushes the SBOMs ko attached to r, and to each image of r if it's an index, to o.artifactRepo,
+// at the tags ko would have pushed them to in the image's repository.
+func uploadSBOMs(ctx context.Context, r build.Result, o buildOptions) error {
+	repo, err := name.NewRepository(o.artifactRepo, o.nameOptions()...)
+	if err != nil {
+		return err
+	}
+	ao := o.artifactOptions()
+	ropts := ao.remoteOptions(ctx)
+
+	upload := func(_ context.Context, se oci.SignedEntity) error {
+		h, err := se.(interface{ Digest() (v1.Hash, error) }).Digest()
+		if err != nil {
+			return err
+		}
+		f, err := se.Attachment("sbom")
+		if err != nil {
+			// Not every level has an SBOM, like the index when ko only generates them for images.
+			return nil
+		}
+		tag := repo.Tag(strings.Replace(h.String(), ":", "-", 1) + ".sbom")
+		if err := remote.Write(tag, f, ropts...); err != nil {
+			return fmt.Errorf("writing SBOM %s: %w", tag, err)
+		}
+		return nil
+	}
+	switch r := r.(type) {
+	case oci.SignedImageIndex:
+		return walk.SignedEntity(ctx, r, upload)
+	case oci.SignedImage:
+		return upload(ctx, r)
+	}
+	// Built without SBOMs.
+	return nil
+}
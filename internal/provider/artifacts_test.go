@@ -0,0 +1,79 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/crane"
+	"github.com/google/go-containerregistry/pkg/registry"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+)
+
+func TestDoPublish_ArtifactRepo(t *testing.T) {
+	// Setup a local registry and have tests push to that.
+	srv := httptest.NewServer(registry.New())
+	defer srv.Close()
+	parts := strings.Split(srv.URL, ":")
+	url := fmt.Sprintf("localhost:%s/test", parts[len(parts)-1])
+	base := pushBaseIndex(t, url+"/base",
+		v1.Platform{OS: "linux", Architecture: "amd64"},
+		v1.Platform{OS: "linux", Architecture: "arm64"},
+	)
+
+	opts := buildOptions{
+		ip:           "github.com/ko-build/terraform-provider-ko/cmd/test",
+		workingDir:   ".",
+		imageRepo:    url + "/images",
+		bare:         true,
+		platforms:    []string{"linux/amd64", "linux/arm64"},
+		baseImage:    base,
+		sbom:         "spdx",
+		artifactRepo: url + "/artifacts",
+	}
+	res, ref, err := doBuild(context.Background(), opts)
+	if err != nil {
+		t.Fatalf("doBuild: %v", err)
+	}
+	got, _, err := doPublish(context.Background(), res, opts)
+	if err != nil {
+		t.Fatalf("doPublish: %v", err)
+	}
+	if got != ref {
+		t.Errorf("expected published ref %q, got %q", ref, got)
+	}
+
+	idx, ok := res.(v1.ImageIndex)
+	if !ok {
+		t.Fatalf("expected an index, got %T", res)
+	}
+	im, err := idx.IndexManifest()
+	if err != nil {
+		t.Fatalf("IndexManifest: %v", err)
+	}
+	// Each image's SBOM is in the artifact repo, and not the image repo.
+	for _, desc := range im.Manifests {
+		sbomTag := strings.Replace(desc.Digest.String(), ":", "-", 1) + ".sbom"
+		if _, err := crane.Digest(opts.artifactRepo + ":" + sbomTag); err != nil {
+			t.Errorf("expected SBOM at %s in the artifact repo: %v", sbomTag, err)
+		}
+		if _, err := crane.Digest(opts.imageRepo + ":" + sbomTag); err == nil {
+			t.Errorf("expected no SBOM at %s in the image repo", sbomTag)
+		}
+	}
+	// The image itself isn't in the artifact repo.
+	dig := strings.Split(ref, "@")[1]
+	if _, err := crane.Digest(opts.artifactRepo + "@" + dig); err == nil {
+		t.Errorf("expected no image %s in the artifact repo", dig)
+	}
+
+	artifactRef, err := opts.artifactRef(ref)
+	if err != nil {
+		t.Fatalf("artifactRef: %v", err)
+	}
+	if want := opts.artifactRepo + "@" + dig; artifactRef != want {
+		t.Errorf("expected artifact ref %q, got %q", want, artifactRef)
+	}
+}
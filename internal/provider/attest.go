@@ -0,0 +1,127 @@
+package provider
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/sigstore/cosign/v2/pkg/oci/static"
+	"github.com/sigstore/cosign/v2/pkg/types"
+	"github.com/sigstore/sigstore/pkg/signature/dsse"
+)
+
+const (
+	// provenancePredicateType is the in-toto predicate type of the provenance attested to by `attest`.
+	provenancePredicateType = "https://slsa.dev/provenance/v0.2"
+	// provenanceBuildType identifies how images are built, for the provenance's buildType.
+	provenanceBuildType = "https://github.com/ko-build/terraform-provider-ko/ko_build@v1"
+)
+
+// provenanceStatement is an in-toto statement with a SLSA v0.2 provenance predicate.
+type provenanceStatement struct {
+	Type          string              `json:"_type"`
+	PredicateType string              `json:"predicateType"`
+	Subject       []provenanceSubject `json:"subject"`
+	Predicate     provenancePredicate `json:"predicate"`
+}
+
+type provenanceSubject struct {
+	Name   string            `json:"name"`
+	Digest map[string]string `json:"digest"`
+}
+
+type provenancePredicate struct {
+	Builder struct {
+		ID string `json:"id"`
+	} `json:"builder"`
+	BuildType  string `json:"buildType"`
+	Invocation struct {
+		Parameters  map[string]interface{} `json:"parameters"`
+		Environment map[string]interface{} `json:"environment"`
+	} `json:"invocation"`
+	Materials []provenanceSubject `json:"materials,omitempty"`
+}
+
+// provenanceOf returns an in-toto statement of the provenance of ref, the published image, built from materials,
+// in the shape of the materials attribute, with opts.
+func provenanceOf(ref string, materials []interface{}, goVersion string, opts buildOptions) (*provenanceStatement, error) {
+	dig, err := name.NewDigest(ref, opts.nameOptions()...)
+	if err != nil {
+		return nil, err
+	}
+	alg, hex, _ := strings.Cut(dig.DigestStr(), ":")
+
+	var pred provenancePredicate
+	pred.Builder.ID = "https://github.com/ko-build/terraform-provider-ko@" + version
+	pred.BuildType = provenanceBuildType
+	pred.Invocation.Parameters = map[string]interface{}{
+		"importpath": opts.ip,
+		"base_image": opts.baseImage,
+		"platforms":  opts.platforms,
+		"ldflags":    opts.ldflags,
+		"build_tags": opts.buildTags,
+	}
+	pred.Invocation.Environment = map[string]interface{}{
+		"env":        opts.env,
+		"go_version": goVersion,
+	}
+	for _, m := range materials {
+		m := m.(map[string]interface{})
+		pm := provenanceSubject{Name: m["uri"].(string), Digest: map[string]string{}}
+		if alg, hex, found := strings.Cut(m["digest"].(string), ":"); found {
+			pm.Digest[alg] = hex
+		}
+		pred.Materials = append(pred.Materials, pm)
+	}
+
+	return &provenanceStatement{
+		Type:          "https://in-toto.io/Statement/v0.1",
+		PredicateType: provenancePredicateType,
+		Subject: []provenanceSubject{{
+			Name:   dig.Context().Name(),
+			Digest: map[string]string{alg: hex},
+		}},
+		Predicate: pred,
+	}, nil
+}
+
+// attestImage signs the provenance of ref, the published image, with o.signKey, as a DSSE envelope like
+// `cosign attest` makes, and pushes it to the cosign attestation tag that attestation_ref names,
+// along with any attestations already there, so `cosign verify-attestation` finds it.
+func attestImage(ctx context.Context, ref string, materials []interface{}, goVersion string, o buildOptions) error {
+	sv, err := loadSigner(o.signKey, o.signPassword)
+	if err != nil {
+		return err
+	}
+	st, err := provenanceOf(ref, materials, goVersion, o)
+	if err != nil {
+		return err
+	}
+	b, err := json.Marshal(st)
+	if err != nil {
+		return err
+	}
+	envelope, err := dsse.WrapSigner(sv, types.IntotoPayloadType).SignMessage(bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	att, err := static.NewAttestation(envelope,
+		static.WithLayerMediaType(types.DssePayloadType),
+		static.WithAnnotations(map[string]string{"predicateType": provenancePredicateType}),
+	)
+	if err != nil {
+		return err
+	}
+
+	artifactRef, err := o.artifactRef(ref)
+	if err != nil {
+		return err
+	}
+	_, attRef, err := cosignRefs(artifactRef)
+	if err != nil {
+		return err
+	}
+	return appendToTag(ctx, attRef, att, o)
+}
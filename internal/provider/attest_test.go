@@ -0,0 +1,184 @@
+package provider
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/elliptic"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/resource"
+	ociremote "github.com/sigstore/cosign/v2/pkg/oci/remote"
+	"github.com/sigstore/cosign/v2/pkg/types"
+	"github.com/sigstore/sigstore/pkg/cryptoutils"
+	"github.com/sigstore/sigstore/pkg/signature"
+	"github.com/sigstore/sigstore/pkg/signature/dsse"
+)
+
+func TestAttestImage(t *testing.T) {
+	srv := httptest.NewServer(registry.New())
+	defer srv.Close()
+	parts := strings.Split(srv.URL, ":")
+	url := fmt.Sprintf("localhost:%s/test", parts[len(parts)-1])
+	base := pushBaseIndex(t, url+"/base", v1.Platform{OS: "linux", Architecture: "amd64"})
+
+	key, pub, err := cryptoutils.GeneratePEMEncodedECDSAKeyPair(elliptic.P256(), cryptoutils.StaticPasswordFunc([]byte("hunter2")))
+	if err != nil {
+		t.Fatalf("GeneratePEMEncodedECDSAKeyPair: %v", err)
+	}
+
+	opts := buildOptions{
+		ip:           "github.com/ko-build/terraform-provider-ko/cmd/test",
+		workingDir:   ".",
+		imageRepo:    url,
+		platforms:    []string{"linux/amd64"},
+		baseImage:    base,
+		sbom:         "none",
+		ldflags:      []string{"-s", "-w"},
+		signKey:      string(key),
+		signPassword: "hunter2",
+		attest:       true,
+	}
+	res, _, err := doBuild(context.Background(), opts)
+	if err != nil {
+		t.Fatalf("doBuild: %v", err)
+	}
+	ref, _, err := doPublish(context.Background(), res, opts)
+	if err != nil {
+		t.Fatalf("doPublish: %v", err)
+	}
+	info, err := buildInfoOf(res)
+	if err != nil {
+		t.Fatalf("buildInfoOf: %v", err)
+	}
+	materials, err := materialsOf(res, info)
+	if err != nil {
+		t.Fatalf("materialsOf: %v", err)
+	}
+	if err := attestImage(context.Background(), ref, materials, info.GoVersion, opts); err != nil {
+		t.Fatalf("attestImage: %v", err)
+	}
+
+	// The attestation is at the tag attestation_ref names.
+	_, attRef, err := cosignRefs(ref)
+	if err != nil {
+		t.Fatalf("cosignRefs: %v", err)
+	}
+	tag, err := name.NewTag(attRef)
+	if err != nil {
+		t.Fatalf("NewTag: %v", err)
+	}
+	atts, err := ociremote.Signatures(tag)
+	if err != nil {
+		t.Fatalf("Signatures: %v", err)
+	}
+	got, err := atts.Get()
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if len(got) != 1 {
+		t.Fatalf("expected 1 attestation, got %d", len(got))
+	}
+	if mt, err := got[0].MediaType(); err != nil || mt != types.DssePayloadType {
+		t.Errorf("expected media type %s, got %s (%v)", types.DssePayloadType, mt, err)
+	}
+	ann, err := got[0].Annotations()
+	if err != nil {
+		t.Fatalf("Annotations: %v", err)
+	}
+	if ann["predicateType"] != provenancePredicateType {
+		t.Errorf("expected predicateType annotation %q, got %q", provenancePredicateType, ann["predicateType"])
+	}
+
+	// The envelope verifies with the public key.
+	envelope, err := got[0].Payload()
+	if err != nil {
+		t.Fatalf("Payload: %v", err)
+	}
+	pk, err := cryptoutils.UnmarshalPEMToPublicKey(pub)
+	if err != nil {
+		t.Fatalf("UnmarshalPEMToPublicKey: %v", err)
+	}
+	v, err := signature.LoadVerifier(pk, crypto.SHA256)
+	if err != nil {
+		t.Fatalf("LoadVerifier: %v", err)
+	}
+	if err := dsse.WrapVerifier(v).VerifySignature(bytes.NewReader(envelope), nil); err != nil {
+		t.Errorf("attestation doesn't verify: %v", err)
+	}
+
+	// The statement is about the image, and records the base image by digest.
+	var env struct {
+		PayloadType string `json:"payloadType"`
+		Payload     string `json:"payload"`
+	}
+	if err := json.Unmarshal(envelope, &env); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	if env.PayloadType != types.IntotoPayloadType {
+		t.Errorf("expected payload type %s, got %s", types.IntotoPayloadType, env.PayloadType)
+	}
+	b, err := base64.StdEncoding.DecodeString(env.Payload)
+	if err != nil {
+		t.Fatalf("DecodeString: %v", err)
+	}
+	var st provenanceStatement
+	if err := json.Unmarshal(b, &st); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	dig, err := name.NewDigest(ref)
+	if err != nil {
+		t.Fatalf("NewDigest: %v", err)
+	}
+	if len(st.Subject) != 1 || st.Subject[0].Name != dig.Context().Name() || "sha256:"+st.Subject[0].Digest["sha256"] != dig.DigestStr() {
+		t.Errorf("expected subject %s, got %+v", dig, st.Subject)
+	}
+	if st.Predicate.Invocation.Parameters["importpath"] != opts.ip {
+		t.Errorf("expected importpath parameter %q, got %v", opts.ip, st.Predicate.Invocation.Parameters["importpath"])
+	}
+	var baseDigest string
+	for _, m := range materials {
+		if m := m.(map[string]interface{}); m["type"] == "base_image" {
+			baseDigest = m["digest"].(string)
+		}
+	}
+	if baseDigest == "" {
+		t.Fatalf("no base image in materials %v", materials)
+	}
+	found := false
+	for _, m := range st.Predicate.Materials {
+		if m.Name == base+":latest" && "sha256:"+m.Digest["sha256"] == baseDigest {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("expected base image digest %s in materials, got %+v", baseDigest, st.Predicate.Materials)
+	}
+}
+
+func TestAccResourceKoBuild_AttestRequiresSign(t *testing.T) {
+	t.Setenv("KO_DOCKER_REPO", "example.com/repo")
+
+	resource.Test(t, resource.TestCase{
+		ProviderFactories: providerFactories,
+		Steps: []resource.TestStep{{
+			Config: `
+			resource "ko_build" "foo" {
+			  importpath = "github.com/ko-build/terraform-provider-ko/cmd/test"
+			  attest     = true
+			}
+			`,
+			PlanOnly:    true,
+			ExpectError: regexp.MustCompile(`attest requires sign`),
+		}},
+	})
+}
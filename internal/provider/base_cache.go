@@ -0,0 +1,131 @@
+package provider
+
+import (
+	"container/list"
+	"fmt"
+	"sync"
+	"time"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/ko/pkg/build"
+)
+
+// baseCache is an in-process cache of base image lookups, evicting the least recently used entries once it holds more than size entries.
+// Entries for moving tags expire after ttl, so they are re-resolved; entries pinned by digest never expire.
+//
+// A nil *baseCache is valid and caches nothing.
+type baseCache struct {
+	mu      sync.Mutex
+	size    int           // Maximum number of entries, or zero for no limit.
+	ttl     time.Duration // How long unpinned entries are cached for, or zero for forever.
+	entries map[string]*list.Element
+	lru     *list.List       // Front is most recently used.
+	now     func() time.Time // Overridden in tests.
+}
+
+type baseCacheEntry struct {
+	key    string
+	res    build.Result
+	pinned bool
+	stored time.Time
+}
+
+func newBaseCache(size int, ttl time.Duration) *baseCache {
+	return &baseCache{
+		size:    size,
+		ttl:     ttl,
+		entries: map[string]*list.Element{},
+		lru:     list.New(),
+		now:     time.Now,
+	}
+}
+
+func (c *baseCache) Load(key string) (build.Result, bool) {
+	if c == nil {
+		return nil, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, found := c.entries[key]
+	if !found {
+		return nil, false
+	}
+	entry := e.Value.(*baseCacheEntry)
+	if !entry.pinned && c.ttl > 0 && c.now().Sub(entry.stored) > c.ttl {
+		c.lru.Remove(e)
+		delete(c.entries, key)
+		return nil, false
+	}
+	c.lru.MoveToFront(e)
+	return entry.res, true
+}
+
+// Store caches res for key. If pinned is true, key refers to an immutable digest and the entry never expires.
+func (c *baseCache) Store(key string, res build.Result, pinned bool) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if e, found := c.entries[key]; found {
+		e.Value = &baseCacheEntry{key: key, res: res, pinned: pinned, stored: c.now()}
+		c.lru.MoveToFront(e)
+		return
+	}
+	c.entries[key] = c.lru.PushFront(&baseCacheEntry{key: key, res: res, pinned: pinned, stored: c.now()})
+	for c.size > 0 && c.lru.Len() > c.size {
+		oldest := c.lru.Back()
+		c.lru.Remove(oldest)
+		delete(c.entries, oldest.Value.(*baseCacheEntry).key)
+	}
+}
+
+// warmIndex is a base image index whose images have already been fetched, so that builds reuse them
+// instead of fetching each image's manifest and config again.
+type warmIndex struct {
+	imageIndex
+	images map[v1.Hash]v1.Image
+}
+
+func (w warmIndex) Image(h v1.Hash) (v1.Image, error) {
+	if img, found := w.images[h]; found {
+		return img, nil
+	}
+	return w.imageIndex.Image(h)
+}
+
+// warmBase fetches the manifest and config of the base image, or of each image in the base index,
+// and returns the base with them held in memory. Layers are left to be fetched as needed.
+func warmBase(base build.Result) (build.Result, error) {
+	switch b := base.(type) {
+	case v1.ImageIndex:
+		im, err := b.IndexManifest()
+		if err != nil {
+			return nil, err
+		}
+		images := map[v1.Hash]v1.Image{}
+		for _, desc := range im.Manifests {
+			if !desc.MediaType.IsImage() {
+				continue
+			}
+			img, err := b.Image(desc.Digest)
+			if err != nil {
+				return nil, fmt.Errorf("reading image %s: %w", desc.Digest, err)
+			}
+			if _, err := img.ConfigFile(); err != nil {
+				return nil, fmt.Errorf("reading config of image %s: %w", desc.Digest, err)
+			}
+			images[desc.Digest] = img
+		}
+		return warmIndex{imageIndex: b, images: images}, nil
+	case v1.Image:
+		if _, err := b.ConfigFile(); err != nil {
+			return nil, fmt.Errorf("reading config: %w", err)
+		}
+		return b, nil
+	default:
+		return nil, fmt.Errorf("unexpected base image %T", base)
+	}
+}
@@ -0,0 +1,245 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/crane"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/ko/pkg/build"
+	specsv1 "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+func TestBaseCache(t *testing.T) {
+	img, err := random.Image(1024, 1)
+	if err != nil {
+		t.Fatalf("random.Image: %v", err)
+	}
+
+	c := newBaseCache(2, 0)
+	c.Store("a", img, false)
+	c.Store("b", img, false)
+	if _, found := c.Load("a"); !found { // a is now more recently used than b.
+		t.Fatal("expected a to be cached")
+	}
+	c.Store("c", img, false)
+	if _, found := c.Load("b"); found {
+		t.Error("expected b to be evicted")
+	}
+	for _, key := range []string{"a", "c"} {
+		if got, found := c.Load(key); !found || got != img {
+			t.Errorf("expected %s to be cached", key)
+		}
+	}
+}
+
+func TestBaseCache_Unbounded(t *testing.T) {
+	img, err := random.Image(1024, 1)
+	if err != nil {
+		t.Fatalf("random.Image: %v", err)
+	}
+
+	c := newBaseCache(0, 0)
+	keys := []string{"a", "b", "c", "d", "e"}
+	for _, key := range keys {
+		c.Store(key, img, false)
+	}
+	for _, key := range keys {
+		if _, found := c.Load(key); !found {
+			t.Errorf("expected %s to be cached", key)
+		}
+	}
+}
+
+func TestBaseCache_Disabled(t *testing.T) {
+	img, err := random.Image(1024, 1)
+	if err != nil {
+		t.Fatalf("random.Image: %v", err)
+	}
+
+	var c *baseCache
+	c.Store("a", img, false)
+	if _, found := c.Load("a"); found {
+		t.Error("expected nil cache to cache nothing")
+	}
+}
+
+func TestBaseCache_TTL(t *testing.T) {
+	img, err := random.Image(1024, 1)
+	if err != nil {
+		t.Fatalf("random.Image: %v", err)
+	}
+
+	now := time.Now()
+	c := newBaseCache(0, time.Minute)
+	c.now = func() time.Time { return now }
+	c.Store("example.com/base:latest", img, false)
+	c.Store("example.com/base@sha256:abc", img, true)
+
+	now = now.Add(30 * time.Second)
+	for _, key := range []string{"example.com/base:latest", "example.com/base@sha256:abc"} {
+		if _, found := c.Load(key); !found {
+			t.Errorf("expected %s to be cached before the ttl elapsed", key)
+		}
+	}
+
+	now = now.Add(time.Minute)
+	if _, found := c.Load("example.com/base:latest"); found {
+		t.Error("expected tag to expire after the ttl elapsed")
+	}
+	if _, found := c.Load("example.com/base@sha256:abc"); !found {
+		t.Error("expected digest to stay cached after the ttl elapsed")
+	}
+}
+
+func TestFetchBase_TTL(t *testing.T) {
+	// Setup a local registry to serve the base image.
+	srv := httptest.NewServer(registry.New())
+	defer srv.Close()
+	parts := strings.Split(srv.URL, ":")
+	url := fmt.Sprintf("localhost:%s/test", parts[len(parts)-1])
+	base := url + "/base:latest"
+	ref, err := name.ParseReference(base)
+	if err != nil {
+		t.Fatalf("ParseReference: %v", err)
+	}
+	// push points the tag at a new random image and returns its digest.
+	push := func() v1.Hash {
+		t.Helper()
+		img, err := random.Image(1024, 1)
+		if err != nil {
+			t.Fatalf("random.Image: %v", err)
+		}
+		if err := remote.Write(ref, img); err != nil {
+			t.Fatalf("pushing base: %v", err)
+		}
+		h, err := img.Digest()
+		if err != nil {
+			t.Fatalf("Digest: %v", err)
+		}
+		return h
+	}
+
+	now := time.Now()
+	cache := newBaseCache(0, 5*time.Minute)
+	cache.now = func() time.Time { return now }
+	opts := buildOptions{baseImage: base, platforms: []string{"linux/amd64"}, baseCache: cache}
+	fetch := func() v1.Hash {
+		t.Helper()
+		_, res, err := opts.fetchBase()
+		if err != nil {
+			t.Fatalf("fetchBase: %v", err)
+		}
+		h, err := res.(v1.Image).Digest()
+		if err != nil {
+			t.Fatalf("Digest: %v", err)
+		}
+		return h
+	}
+
+	first := push()
+	if got := fetch(); got != first {
+		t.Fatalf("expected %s, got %s", first, got)
+	}
+
+	// The tag is pushed again, but until the ttl elapses the cached lookup is used.
+	second := push()
+	now = now.Add(time.Minute)
+	if got := fetch(); got != first {
+		t.Errorf("expected the cached %s before the ttl elapsed, got %s", first, got)
+	}
+
+	now = now.Add(5 * time.Minute)
+	if got := fetch(); got != second {
+		t.Errorf("expected the re-pushed %s after the ttl elapsed, got %s", second, got)
+	}
+}
+
+func TestDoBuild_BaseCachePlatforms(t *testing.T) {
+	// Setup a local registry to serve the base image.
+	srv := httptest.NewServer(registry.New())
+	defer srv.Close()
+	parts := strings.Split(srv.URL, ":")
+	url := fmt.Sprintf("localhost:%s/test", parts[len(parts)-1])
+	base := url + "/base:latest"
+
+	// The base starts out as a single linux/amd64 image.
+	img, err := random.Image(1024, 1)
+	if err != nil {
+		t.Fatalf("random.Image: %v", err)
+	}
+	cf, err := img.ConfigFile()
+	if err != nil {
+		t.Fatalf("ConfigFile: %v", err)
+	}
+	cf.OS, cf.Architecture = "linux", "amd64"
+	if img, err = mutate.ConfigFile(img, cf); err != nil {
+		t.Fatalf("mutate.ConfigFile: %v", err)
+	}
+	ref, err := name.ParseReference(base)
+	if err != nil {
+		t.Fatalf("ParseReference: %v", err)
+	}
+	if err := remote.Write(ref, img); err != nil {
+		t.Fatalf("pushing base: %v", err)
+	}
+
+	cache := newBaseCache(0, 0)
+	buildFor := func(platform string) build.Result {
+		t.Helper()
+		res, _, err := doBuild(context.Background(), buildOptions{
+			ip:         "github.com/ko-build/terraform-provider-ko/cmd/test",
+			workingDir: ".",
+			imageRepo:  url,
+			platforms:  []string{platform},
+			baseImage:  base,
+			sbom:       "none",
+			baseCache:  cache,
+		})
+		if err != nil {
+			t.Fatalf("doBuild(%s): %v", platform, err)
+		}
+		return res
+	}
+	buildFor("linux/amd64")
+
+	// Once the tag moves to a multi-platform index, a build for another platform looks the base up again
+	// instead of reusing the single image cached for linux/amd64.
+	pushBaseIndex(t, base,
+		v1.Platform{OS: "linux", Architecture: "amd64"},
+		v1.Platform{OS: "linux", Architecture: "arm64"},
+	)
+	// ko records the digest of the image it picked from the index.
+	armDigest, err := crane.Digest(base, crane.WithPlatform(&v1.Platform{OS: "linux", Architecture: "arm64"}))
+	if err != nil {
+		t.Fatalf("crane.Digest: %v", err)
+	}
+	res := buildFor("linux/arm64")
+	got, ok := res.(v1.Image)
+	if !ok {
+		t.Fatalf("expected an image, got %T", res)
+	}
+	cf, err = got.ConfigFile()
+	if err != nil {
+		t.Fatalf("ConfigFile: %v", err)
+	}
+	if cf.Architecture != "arm64" {
+		t.Errorf("expected a linux/arm64 image, got %s", cf.Platform())
+	}
+	m, err := got.Manifest()
+	if err != nil {
+		t.Fatalf("Manifest: %v", err)
+	}
+	if d := m.Annotations[specsv1.AnnotationBaseImageDigest]; d != armDigest {
+		t.Errorf("expected base image digest %s, got %s", armDigest, d)
+	}
+}
@@ -0,0 +1,201 @@
+package provider
+
+import (
+	"archive/tar"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/tarball"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+)
+
+// remoteBuildCache is a Go build cache stored as an image between runs of the provider. It's pulled once into a
+// directory that all of the provider's builds share, and pushed again after builds that create images.
+type remoteBuildCache struct {
+	ref string
+
+	once sync.Once
+	dir  string
+	err  error
+
+	mu sync.Mutex // Serializes pushes, so that each pushes the cache as a whole.
+}
+
+func newRemoteBuildCache(ref string) *remoteBuildCache {
+	return &remoteBuildCache{ref: ref}
+}
+
+// restore returns the directory to use as GOCACHE, pulling the cache into it the first time it's called.
+// The cache only makes builds faster, so failing to pull it is logged, and builds start from an empty cache.
+func (c *remoteBuildCache) restore(ctx context.Context, opts buildOptions) (string, error) {
+	c.once.Do(func() {
+		if c.dir, c.err = os.MkdirTemp("", "ko-gocache-"); c.err != nil {
+			return
+		}
+		if err := restoreBuildCache(ctx, c.ref, c.dir, opts); err != nil {
+			log.Printf("[WARN] restoring Go build cache from %s: %v", c.ref, err)
+		}
+	})
+	return c.dir, c.err
+}
+
+// save pushes the cache, logging rather than returning any error, since builds don't depend on it.
+func (c *remoteBuildCache) save(ctx context.Context, opts buildOptions) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := saveBuildCache(ctx, c.ref, c.dir, opts); err != nil {
+		log.Printf("[WARN] saving Go build cache to %s: %v", c.ref, err)
+	}
+}
+
+// restoreBuildCache extracts the Go build cache stored as a single-layer image at ref into dir.
+func restoreBuildCache(ctx context.Context, ref, dir string, opts buildOptions) error {
+	r, err := name.ParseReference(ref, opts.nameOptions()...)
+	if err != nil {
+		return err
+	}
+	img, err := remote.Image(r, opts.remoteOptions(ctx)...)
+	if err != nil {
+		return err
+	}
+	layers, err := img.Layers()
+	if err != nil {
+		return err
+	}
+	if len(layers) != 1 {
+		return fmt.Errorf("expected 1 layer, got %d", len(layers))
+	}
+	rc, err := layers[0].Uncompressed()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	tr := tar.NewReader(rc)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if !filepath.IsLocal(filepath.FromSlash(hdr.Name)) {
+			return fmt.Errorf("unexpected path %q", hdr.Name)
+		}
+		path := filepath.Join(dir, filepath.FromSlash(hdr.Name))
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(path, 0o755); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+				return err
+			}
+			f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o644)
+			if err != nil {
+				return err
+			}
+			if _, err := io.Copy(f, tr); err != nil { //nolint: gosec // The cache is written by this provider.
+				f.Close()
+				return err
+			}
+			if err := f.Close(); err != nil {
+				return err
+			}
+			// Keep the times the files were last used, which Go relies on to trim the cache.
+			if err := os.Chtimes(path, hdr.AccessTime, hdr.ModTime); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// saveBuildCache pushes the Go build cache in dir to ref as a single-layer image.
+func saveBuildCache(ctx context.Context, ref, dir string, opts buildOptions) error {
+	r, err := name.ParseReference(ref, opts.nameOptions()...)
+	if err != nil {
+		return err
+	}
+
+	// The cache can be large, so write the layer to a file rather than holding it in memory.
+	f, err := os.CreateTemp("", "ko-gocache-*.tar")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if err := tarDir(f, dir); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	layer, err := tarball.LayerFromFile(f.Name(), tarball.WithMediaType(types.OCILayer))
+	if err != nil {
+		return err
+	}
+	img, err := mutate.Append(mutate.MediaType(empty.Image, types.OCIManifestSchema1), mutate.Addendum{Layer: layer})
+	if err != nil {
+		return err
+	}
+	return remote.Write(r, img, opts.remoteOptions(ctx)...)
+}
+
+// tarDir writes the regular files and directories in dir to w as a tarball, with paths relative to dir.
+func tarDir(w io.Writer, dir string) error {
+	tw := tar.NewWriter(w)
+	if err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil || rel == "." {
+			return err
+		}
+		if !d.IsDir() && !d.Type().IsRegular() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		hdr, err := tar.FileInfoHeader(info, "")
+		if err != nil {
+			return err
+		}
+		hdr.Name = filepath.ToSlash(rel)
+		if d.IsDir() {
+			hdr.Name += "/"
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		_, err = io.Copy(tw, f)
+		return err
+	}); err != nil {
+		return err
+	}
+	return tw.Close()
+}
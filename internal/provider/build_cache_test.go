@@ -0,0 +1,140 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/registry"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+)
+
+func TestBuildCache(t *testing.T) {
+	// Setup a local registry and have tests push to that.
+	srv := httptest.NewServer(registry.New())
+	defer srv.Close()
+	parts := strings.Split(srv.URL, ":")
+	ref := fmt.Sprintf("localhost:%s/test/gocache:main", parts[len(parts)-1])
+	opts := buildOptions{imageRepo: ref}
+
+	// Restoring a cache that was never saved fails, so the build carries on with an empty cache.
+	if err := restoreBuildCache(context.Background(), ref, t.TempDir(), opts); err == nil {
+		t.Error("expected restoring a missing cache to fail")
+	}
+
+	src := t.TempDir()
+	files := map[string]string{
+		"README":          "This directory holds cached build artifacts from the Go build system.",
+		"trim.txt":        "1700000000",
+		"0a/0a1b-a":       "action",
+		"ff/ff2c-d":       "output",
+		"ff/nested/entry": "nested",
+	}
+	for path, content := range files {
+		path = filepath.Join(src, path)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatalf("MkdirAll: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatalf("WriteFile: %v", err)
+		}
+	}
+	if err := os.MkdirAll(filepath.Join(src, "empty"), 0o755); err != nil {
+		t.Fatalf("MkdirAll: %v", err)
+	}
+	used := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	if err := os.Chtimes(filepath.Join(src, "0a/0a1b-a"), used, used); err != nil {
+		t.Fatalf("Chtimes: %v", err)
+	}
+
+	if err := saveBuildCache(context.Background(), ref, src, opts); err != nil {
+		t.Fatalf("saveBuildCache: %v", err)
+	}
+	dst := t.TempDir()
+	if err := restoreBuildCache(context.Background(), ref, dst, opts); err != nil {
+		t.Fatalf("restoreBuildCache: %v", err)
+	}
+	for path, want := range files {
+		got, err := os.ReadFile(filepath.Join(dst, path))
+		if err != nil {
+			t.Errorf("ReadFile(%s): %v", path, err)
+		} else if string(got) != want {
+			t.Errorf("expected %s to contain %q, got %q", path, want, got)
+		}
+	}
+	if fi, err := os.Stat(filepath.Join(dst, "empty")); err != nil || !fi.IsDir() {
+		t.Errorf("expected empty directory to be restored, got %v", err)
+	}
+	// Go trims cache entries by when they were last used, so restored entries keep their times.
+	if fi, err := os.Stat(filepath.Join(dst, "0a/0a1b-a")); err != nil || !fi.ModTime().Equal(used) {
+		t.Errorf("expected the entry's modification time to be restored as %v, got %v", used, fi.ModTime())
+	}
+}
+
+func TestDoBuild_RemoteBuildCache(t *testing.T) {
+	// Setup a local registry and have tests push to that, counting pushes of the build cache.
+	reg := registry.New()
+	var pushes atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPut && strings.HasSuffix(r.URL.Path, "/gocache/manifests/main") {
+			pushes.Add(1)
+		}
+		reg.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+	parts := strings.Split(srv.URL, ":")
+	url := fmt.Sprintf("localhost:%s/test", parts[len(parts)-1])
+	ref := url + "/gocache:main"
+	base := pushBaseIndex(t, url+"/base", v1.Platform{OS: "linux", Architecture: "amd64"})
+
+	cache := newRemoteBuildCache(ref)
+	opts := buildOptions{
+		ip:               "github.com/ko-build/terraform-provider-ko/cmd/test",
+		workingDir:       ".",
+		imageRepo:        url,
+		platforms:        []string{"linux/amd64"},
+		baseImage:        base,
+		sbom:             "none",
+		remoteBuildCache: cache,
+	}
+	t.Cleanup(func() { os.RemoveAll(cache.dir) })
+
+	// Builds that don't create an image, like refreshing one, use the cache without pushing it.
+	if _, _, err := doBuild(context.Background(), opts); err != nil {
+		t.Fatalf("doBuild: %v", err)
+	}
+	dir := cache.dir
+	if got := pushes.Load(); got != 0 {
+		t.Errorf("expected the build cache not to be pushed, got %d pushes", got)
+	}
+
+	// Builds that create an image push the cache, from the same directory.
+	opts.saveBuildCache = true
+	if _, _, err := doBuild(context.Background(), opts); err != nil {
+		t.Fatalf("doBuild: %v", err)
+	}
+	if got := pushes.Load(); got != 1 {
+		t.Errorf("expected the build cache to be pushed once, got %d pushes", got)
+	}
+	if cache.dir != dir {
+		t.Errorf("expected builds to share the cache directory %s, got %s", dir, cache.dir)
+	}
+
+	// Another run of the provider starts from the pushed cache.
+	restored := newRemoteBuildCache(ref)
+	got, err := restored.restore(context.Background(), opts)
+	if err != nil {
+		t.Fatalf("restore: %v", err)
+	}
+	defer os.RemoveAll(got)
+	if _, err := os.Stat(filepath.Join(got, "README")); err != nil {
+		t.Errorf("expected the pushed cache to be restored: %v", err)
+	}
+}
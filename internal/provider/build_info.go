@@ -0,0 +1,119 @@
+package provider
+
+import (
+	"archive/tar"
+	"bytes"
+	"debug/buildinfo"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"runtime/debug"
+	"strings"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/ko/pkg/build"
+)
+
+// buildInfoOf returns the Go build info embedded in the binary of the image built by ko, the same data ko reports in its go.version-m SBOM.
+// For a multi-platform image, the first image in the index is used; the Go version and module versions are the same for every platform.
+func buildInfoOf(res build.Result) (*debug.BuildInfo, error) {
+	b, err := binaryOf(res)
+	if err != nil {
+		return nil, err
+	}
+	return buildinfo.Read(bytes.NewReader(b))
+}
+
+// binaryOf returns the contents of the binary ko built into the image, or into the first image of an index.
+func binaryOf(res build.Result) ([]byte, error) {
+	var img v1.Image
+	switch r := res.(type) {
+	case v1.ImageIndex:
+		m, err := r.IndexManifest()
+		if err != nil {
+			return nil, err
+		}
+		if len(m.Manifests) == 0 {
+			return nil, errors.New("image index contains no images")
+		}
+		if img, err = r.Image(m.Manifests[0].Digest); err != nil {
+			return nil, err
+		}
+	case v1.Image:
+		img = r
+	default:
+		return nil, fmt.Errorf("unexpected build result %T", res)
+	}
+
+	cf, err := img.ConfigFile()
+	if err != nil {
+		return nil, err
+	}
+	if len(cf.Config.Entrypoint) == 0 {
+		return nil, errors.New("image has no entrypoint")
+	}
+	// The binary is the last element of the entrypoint, after any entrypoint_prefix,
+	// and is /ko-app/<name> on Linux and C:\ko-app\<name>.exe on Windows.
+	// If an entrypoint override doesn't end with it, look for whatever binary is in ko-app.
+	ep := strings.ReplaceAll(cf.Config.Entrypoint[len(cf.Config.Entrypoint)-1], `\`, "/")
+	bin := path.Base(ep)
+	if path.Base(path.Dir(ep)) != "ko-app" {
+		bin = ""
+	}
+
+	layers, err := img.Layers()
+	if err != nil {
+		return nil, err
+	}
+	// ko adds the binary in one of the last layers, so search from the top.
+	for i := len(layers) - 1; i >= 0; i-- {
+		b, err := findBinary(layers[i], bin)
+		if err != nil {
+			return nil, err
+		}
+		if b != nil {
+			return b, nil
+		}
+	}
+	return nil, fmt.Errorf("binary %s not found in image", ep)
+}
+
+// findBinary returns the contents of the ko-app binary named bin, or of any ko-app binary if bin is empty, in layer,
+// or nil if the layer doesn't contain it.
+func findBinary(layer v1.Layer, bin string) ([]byte, error) {
+	rc, err := layer.Uncompressed()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	tr := tar.NewReader(rc)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if (bin == "" || path.Base(hdr.Name) == bin) && path.Base(path.Dir(hdr.Name)) == "ko-app" && hdr.Typeflag == tar.TypeReg {
+			return io.ReadAll(tr)
+		}
+	}
+}
+
+// modulesOf returns the module dependencies from info, using the replacement's version for replaced modules.
+func modulesOf(info *debug.BuildInfo) []interface{} {
+	out := make([]interface{}, 0, len(info.Deps))
+	for _, dep := range info.Deps {
+		version := dep.Version
+		if dep.Replace != nil {
+			version = dep.Replace.Version
+		}
+		out = append(out, map[string]interface{}{
+			"module":  dep.Path,
+			"version": version,
+		})
+	}
+	return out
+}
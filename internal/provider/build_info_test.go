@@ -0,0 +1,63 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/registry"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+)
+
+func TestBuildInfoOf(t *testing.T) {
+	// Setup a local registry to serve the base image.
+	srv := httptest.NewServer(registry.New())
+	defer srv.Close()
+	parts := strings.Split(srv.URL, ":")
+	url := fmt.Sprintf("localhost:%s/test", parts[len(parts)-1])
+	base := pushBaseIndex(t, url+"/base",
+		v1.Platform{OS: "linux", Architecture: "amd64"},
+		v1.Platform{OS: "linux", Architecture: "arm64"},
+	)
+
+	for _, platforms := range [][]string{{"linux/amd64"}, {"linux/amd64", "linux/arm64"}} {
+		t.Run(strings.Join(platforms, ","), func(t *testing.T) {
+			res, _, err := doBuild(context.Background(), buildOptions{
+				ip:         "github.com/ko-build/terraform-provider-ko/cmd/test-lambda",
+				workingDir: ".",
+				imageRepo:  url,
+				platforms:  platforms,
+				baseImage:  base,
+				sbom:       "none",
+			})
+			if err != nil {
+				t.Fatalf("doBuild: %v", err)
+			}
+			info, err := buildInfoOf(res)
+			if err != nil {
+				t.Fatalf("buildInfoOf: %v", err)
+			}
+			if !strings.HasPrefix(info.GoVersion, "go") {
+				t.Errorf("expected a go version, got %q", info.GoVersion)
+			}
+			if info.Path != "github.com/ko-build/terraform-provider-ko/cmd/test-lambda" {
+				t.Errorf("unexpected main package path %q", info.Path)
+			}
+			found := false
+			for _, m := range modulesOf(info) {
+				m := m.(map[string]interface{})
+				if m["module"] == "github.com/aws/aws-lambda-go" {
+					found = true
+					if v := m["version"].(string); !strings.HasPrefix(v, "v") {
+						t.Errorf("expected a version for %s, got %q", m["module"], v)
+					}
+				}
+			}
+			if !found {
+				t.Errorf("expected github.com/aws/aws-lambda-go in modules, got %v", modulesOf(info))
+			}
+		})
+	}
+}
@@ -0,0 +1,40 @@
+package provider
+
+import "context"
+
+// buildLimiter bounds how many builds run at once across all the resources of the provider,
+// so a config with many images doesn't start more go builds than the machine can run.
+//
+// A nil *buildLimiter is valid and doesn't limit anything.
+type buildLimiter struct {
+	slots chan struct{}
+}
+
+// newBuildLimiter returns a limiter allowing n builds at once, or nil to not limit builds if n isn't positive.
+func newBuildLimiter(n int) *buildLimiter {
+	if n <= 0 {
+		return nil
+	}
+	return &buildLimiter{slots: make(chan struct{}, n)}
+}
+
+// acquire waits until a build may start, or ctx is done. Each successful acquire must be followed by a release.
+func (l *buildLimiter) acquire(ctx context.Context) error {
+	if l == nil {
+		return nil
+	}
+	select {
+	case l.slots <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// release lets another build start.
+func (l *buildLimiter) release() {
+	if l == nil {
+		return
+	}
+	<-l.slots
+}
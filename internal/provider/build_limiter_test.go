@@ -0,0 +1,61 @@
+package provider
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestBuildLimiter(t *testing.T) {
+	const limit, builds = 3, 20
+	l := newBuildLimiter(limit)
+
+	var running, peak atomic.Int32
+	var wg sync.WaitGroup
+	for range builds {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := l.acquire(context.Background()); err != nil {
+				t.Errorf("acquire: %v", err)
+				return
+			}
+			defer l.release()
+			n := running.Add(1)
+			for {
+				p := peak.Load()
+				if n <= p || peak.CompareAndSwap(p, n) {
+					break
+				}
+			}
+			time.Sleep(10 * time.Millisecond) // Stand in for a go build.
+			running.Add(-1)
+		}()
+	}
+	wg.Wait()
+	if got := peak.Load(); got != limit {
+		t.Errorf("expected at most, and eventually exactly, %d builds at once, got %d", limit, got)
+	}
+
+	// Waiting for a slot stops when the context is done.
+	full := newBuildLimiter(1)
+	if err := full.acquire(context.Background()); err != nil {
+		t.Fatalf("acquire: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := full.acquire(ctx); err == nil {
+		t.Error("expected acquire to fail once the context is done")
+	}
+
+	// A nil limiter doesn't limit anything.
+	var none *buildLimiter
+	for range builds {
+		if err := none.acquire(context.Background()); err != nil {
+			t.Fatalf("acquire: %v", err)
+		}
+	}
+	none.release()
+}
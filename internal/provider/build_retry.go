@@ -0,0 +1,48 @@
+package provider
+
+import (
+	"regexp"
+	"strings"
+	"time"
+)
+
+// buildRetryDelay is how long to wait before the first retry of a build; each later retry waits that much longer again.
+var buildRetryDelay = 2 * time.Second
+
+// transientBuildErrors are substrings, in lower case, of go toolchain output for failures that may succeed on retry,
+// like network errors downloading modules.
+var transientBuildErrors = []string{
+	"dial tcp",
+	"i/o timeout",
+	"tls handshake timeout",
+	"connection reset by peer",
+	"connection refused",
+	"no such host",
+	"temporary failure in name resolution",
+	"server misbehaving",
+	"unexpected eof",
+	"429 too many requests",
+	"500 internal server error",
+	"502 bad gateway",
+	"503 service unavailable",
+	"504 gateway timeout",
+}
+
+// compileErrorRE matches the file:line:column positions the go toolchain reports compile errors at.
+var compileErrorRE = regexp.MustCompile(`\.go:\d+:\d+: `)
+
+// isTransientBuildError reports whether err, from building an image, looks like a transient failure of the go toolchain,
+// rather than an error in the code being built. Compile errors are never transient, even if the output also mentions network errors.
+func isTransientBuildError(err error) bool {
+	msg := err.Error()
+	if compileErrorRE.MatchString(msg) {
+		return false
+	}
+	msg = strings.ToLower(msg)
+	for _, s := range transientBuildErrors {
+		if strings.Contains(msg, s) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,103 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/registry"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+)
+
+func TestIsTransientBuildError(t *testing.T) {
+	for msg, want := range map[string]bool{
+		`go build: exit status 1: go: example.com/dep@v1.0.0: Get "https://proxy.golang.org/example.com/dep/@v/v1.0.0.zip": dial tcp: lookup proxy.golang.org: i/o timeout`: true,
+		`go build: exit status 1: go: example.com/dep@v1.0.0: reading https://proxy.golang.org/example.com/dep/@v/v1.0.0.mod: 502 Bad Gateway`:                              true,
+		`go build: exit status 1: # example.com/app
+./main.go:3:1: syntax error: non-declaration statement outside function body`: false,
+		`go build: exit status 1: main.go:4:2: no required module provides package example.com/missing; to add it:
+	go get example.com/missing`: false,
+		`go build: exit status 1: go: example.com/dep@v1.0.0: verifying module: checksum mismatch`: false,
+	} {
+		if got := isTransientBuildError(errors.New(msg)); got != want {
+			t.Errorf("isTransientBuildError(%q) = %t, want %t", msg, got, want)
+		}
+	}
+}
+
+func TestDoBuild_Retries(t *testing.T) {
+	srv := httptest.NewServer(registry.New())
+	defer srv.Close()
+	parts := strings.Split(srv.URL, ":")
+	url := fmt.Sprintf("localhost:%s/test", parts[len(parts)-1])
+	base := pushBaseIndex(t, url+"/base", v1.Platform{OS: "linux", Architecture: "amd64"})
+
+	realGo, err := exec.LookPath("go")
+	if err != nil {
+		t.Fatalf("LookPath: %v", err)
+	}
+	delay := buildRetryDelay
+	buildRetryDelay = 0
+	t.Cleanup(func() { buildRetryDelay = delay })
+
+	for _, tc := range []struct {
+		desc         string
+		failures     int
+		message      string
+		retries      int
+		wantErr      bool
+		wantAttempts int
+	}{
+		{"transient error retried", 2, "dial tcp: lookup proxy.golang.org: i/o timeout", 2, false, 3},
+		{"out of retries", 2, "dial tcp: lookup proxy.golang.org: i/o timeout", 1, true, 2},
+		{"compile error not retried", 2, "./main.go:3:1: syntax error", 2, true, 1},
+		{"no retries by default", 1, "dial tcp: lookup proxy.golang.org: i/o timeout", 0, true, 1},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			// A go binary that fails the first builds with the message, and otherwise runs the real go.
+			dir := t.TempDir()
+			count := filepath.Join(dir, "count")
+			script := filepath.Join(dir, "go")
+			if err := os.WriteFile(script, []byte(fmt.Sprintf(`#!/bin/sh
+if [ "$1" = build ]; then
+  n=$(($(cat %[1]q 2>/dev/null || echo 0) + 1))
+  echo $n > %[1]q
+  if [ $n -le %[2]d ]; then
+    echo %[3]q >&2
+    exit 1
+  fi
+fi
+exec %[4]q "$@"
+`, count, tc.failures, tc.message, realGo)), 0o700); err != nil {
+				t.Fatalf("WriteFile: %v", err)
+			}
+			t.Setenv("KO_GO_PATH", script)
+
+			_, _, err := doBuild(context.Background(), buildOptions{
+				ip:           "github.com/ko-build/terraform-provider-ko/cmd/test",
+				workingDir:   ".",
+				imageRepo:    url,
+				platforms:    []string{"linux/amd64"},
+				baseImage:    base,
+				sbom:         "none",
+				buildRetries: tc.retries,
+			})
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("doBuild: expected error %t, got %v", tc.wantErr, err)
+			}
+			b, err := os.ReadFile(count)
+			if err != nil {
+				t.Fatalf("ReadFile: %v", err)
+			}
+			if got := strings.TrimSpace(string(b)); got != fmt.Sprint(tc.wantAttempts) {
+				t.Errorf("expected %d builds, got %s", tc.wantAttempts, got)
+			}
+		})
+	}
+}
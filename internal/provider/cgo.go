@@ -0,0 +1,54 @@
+package provider
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"slices"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+)
+
+// staticBaseImage is ko's default base image, which has no libc for cgo binaries to link against.
+const staticBaseImage = "cgr.dev/chainguard/static"
+
+// cgoEnabled returns whether the build uses cgo, with cgo_enabled, race, or CGO_ENABLED=1 in env.
+func (o *buildOptions) cgoEnabled() bool {
+	return o.cgo || o.race || slices.Contains(o.env, "CGO_ENABLED=1")
+}
+
+// cgoDiagnostics returns warnings about the usual problems with cgo builds: a base image without libc,
+// and, if the build failed with buildErr, building for other platforms without a C cross-compiler.
+func cgoDiagnostics(opts buildOptions, buildErr error) diag.Diagnostics {
+	if !opts.cgoEnabled() {
+		return nil
+	}
+	var diags diag.Diagnostics
+	if ref, err := name.ParseReference(opts.baseImage); err == nil && ref.Context().Name() == staticBaseImage {
+		diags = append(diags, diag.Diagnostic{
+			Severity: diag.Warning,
+			Summary:  "Base image without libc for a cgo build",
+			Detail:   fmt.Sprintf("the binary is built with cgo, so it's dynamically linked against libc, but the base image %s doesn't provide it and the binary won't start. Use a base image with libc, such as cgr.dev/chainguard/glibc-dynamic.", opts.baseImage),
+		})
+	}
+	if buildErr == nil || os.Getenv("CC") != "" || slices.ContainsFunc(opts.env, func(e string) bool { return strings.HasPrefix(e, "CC=") }) {
+		return diags
+	}
+	host := runtime.GOOS + "/" + runtime.GOARCH
+	var cross []string
+	for _, p := range opts.platforms {
+		if parts := strings.SplitN(p, "/", 3); len(parts) < 2 || parts[0]+"/"+parts[1] != host {
+			cross = append(cross, p)
+		}
+	}
+	if len(cross) > 0 {
+		diags = append(diags, diag.Diagnostic{
+			Severity: diag.Warning,
+			Summary:  "cgo build for other platforms without a C cross-compiler",
+			Detail:   fmt.Sprintf("building with cgo for %s, which isn't the platform of this machine (%s), needs a C compiler for the target platform. Set CC, and CXX for C++, in env to one, or only build for %s.", strings.Join(cross, ", "), host, host),
+		})
+	}
+	return diags
+}
@@ -0,0 +1,104 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http/httptest"
+	"os/exec"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/registry"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+)
+
+func TestCgoDiagnostics(t *testing.T) {
+	t.Setenv("CC", "")
+	host := runtime.GOOS + "/" + runtime.GOARCH
+	other := "linux/s390x"
+	if host == other {
+		other = "linux/amd64"
+	}
+	buildErr := errors.New("build failed")
+	for _, tc := range []struct {
+		desc     string
+		opts     buildOptions
+		buildErr error
+		want     []string
+	}{{
+		desc: "no cgo",
+		opts: buildOptions{baseImage: staticBaseImage + ":latest", platforms: []string{other}},
+		want: nil,
+	}, {
+		desc: "static base",
+		opts: buildOptions{cgo: true, baseImage: staticBaseImage + ":latest", platforms: []string{host}},
+		want: []string{"Base image without libc for a cgo build"},
+	}, {
+		desc: "cgo from env",
+		opts: buildOptions{env: []string{"CGO_ENABLED=1"}, baseImage: staticBaseImage, platforms: []string{host}},
+		want: []string{"Base image without libc for a cgo build"},
+	}, {
+		desc:     "cross-compiling without CC",
+		opts:     buildOptions{cgo: true, baseImage: "cgr.dev/chainguard/glibc-dynamic", platforms: []string{host, other}},
+		buildErr: buildErr,
+		want:     []string{"cgo build for other platforms without a C cross-compiler"},
+	}, {
+		desc: "cross-compiling succeeded",
+		opts: buildOptions{cgo: true, baseImage: "cgr.dev/chainguard/glibc-dynamic", platforms: []string{other}},
+		want: nil,
+	}, {
+		desc:     "cross-compiling with CC",
+		opts:     buildOptions{cgo: true, baseImage: "cgr.dev/chainguard/glibc-dynamic", platforms: []string{other}, env: []string{"CC=cross-gcc"}},
+		buildErr: buildErr,
+		want:     nil,
+	}} {
+		t.Run(tc.desc, func(t *testing.T) {
+			var got []string
+			for _, d := range cgoDiagnostics(tc.opts, tc.buildErr) {
+				got = append(got, d.Summary)
+			}
+			if fmt.Sprint(got) != fmt.Sprint(tc.want) {
+				t.Errorf("expected %v, got %v", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestDoBuild_Cgo(t *testing.T) {
+	if _, err := exec.LookPath("gcc"); err != nil {
+		t.Skip("cgo builds require a C compiler")
+	}
+
+	// Setup a local registry to serve the base image.
+	srv := httptest.NewServer(registry.New())
+	defer srv.Close()
+	parts := strings.Split(srv.URL, ":")
+	url := fmt.Sprintf("localhost:%s/test", parts[len(parts)-1])
+	base := pushBaseIndex(t, url+"/base", v1.Platform{OS: "linux", Architecture: runtime.GOARCH})
+
+	res, _, err := doBuild(context.Background(), buildOptions{
+		ip:         "github.com/ko-build/terraform-provider-ko/cmd/test-cgo",
+		workingDir: ".",
+		imageRepo:  url,
+		platforms:  []string{"linux/" + runtime.GOARCH},
+		baseImage:  base,
+		sbom:       "none",
+		cgo:        true,
+	})
+	if err != nil {
+		t.Fatalf("doBuild: %v", err)
+	}
+	info, err := buildInfoOf(res)
+	if err != nil {
+		t.Fatalf("buildInfoOf: %v", err)
+	}
+	settings := map[string]string{}
+	for _, s := range info.Settings {
+		settings[s.Key] = s.Value
+	}
+	if settings["CGO_ENABLED"] != "1" {
+		t.Errorf("expected a build with cgo enabled, got settings %v", settings)
+	}
+}
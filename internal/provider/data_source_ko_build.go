@@ -0,0 +1,135 @@
+package provider
+
+import (
+	"context"
+
+	"github.com/hashicorp/go-cty/cty"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+)
+
+func dataSourceBuild() *schema.Resource {
+	return &schema.Resource{
+		Description: "Builds a Go program into an image at plan time and returns its reference by digest, without keeping a resource in state, for passing the digest to other resources. The image is only published if `push` is true; otherwise, `image_ref` is where it would be published. Builds use the provider's defaults, like `ko_build`.",
+
+		ReadContext: dataSourceBuildRead,
+
+		Schema: map[string]*schema.Schema{
+			"importpath": {
+				Description: "import path to build",
+				Type:        schema.TypeString,
+				Required:    true,
+			},
+			"working_dir": {
+				Description: "working directory for the build",
+				Type:        schema.TypeString,
+				Optional:    true,
+				Default:     ".",
+			},
+			"platforms": {
+				Description: "Which platform to use when pulling a multi-platform base. Format: all | <os>/<arch>[/<variant>], one platform per entry.",
+				Type:        schema.TypeList,
+				Elem: &schema.Schema{
+					Type: schema.TypeString,
+					ValidateDiagFunc: func(data interface{}, _ cty.Path) diag.Diagnostics {
+						if err := checkPlatform(data.(string)); err != nil {
+							return diag.Errorf("Invalid platform: %v", err)
+						}
+						return nil
+					},
+				},
+				Optional: true,
+			},
+			"base_image": {
+				Description: "base image to use",
+				Type:        schema.TypeString,
+				Optional:    true,
+			},
+			"repo": {
+				Description: "Container repository to publish images to. Defaults to `KO_DOCKER_REPO` env var",
+				Type:        schema.TypeString,
+				Optional:    true,
+			},
+			"sbom": {
+				Description: "The SBOM media type to use (none will disable SBOM synthesis and upload). SBOMs don't change the image digest, and are only uploaded if `push` is true.",
+				Type:        schema.TypeString,
+				Optional:    true,
+				Default:     "spdx",
+				ValidateDiagFunc: func(data interface{}, _ cty.Path) diag.Diagnostics {
+					v := data.(string)
+					if _, found := validTypes[v]; !found {
+						return diag.Errorf("Invalid sbom type: %q", v)
+					}
+					return nil
+				},
+			},
+			"push": {
+				Description: "If true, publish the image to the registry, with the `latest` tag like `ko_build`, each time the data source is read. Otherwise, the image is only built.",
+				Type:        schema.TypeBool,
+				Optional:    true,
+				Default:     false,
+			},
+			"image_ref": {
+				Description: "built image reference by digest",
+				Type:        schema.TypeString,
+				Computed:    true,
+			},
+		},
+	}
+}
+
+func dataSourceBuildRead(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	po, err := NewProviderOpts(meta)
+	if err != nil {
+		return diag.Errorf("configuring provider: %v", err)
+	}
+
+	platforms, err := toStringSlice(d.Get("platforms").([]interface{}))
+	if err != nil {
+		return diag.Errorf("read platforms: %v", err)
+	}
+	ip := d.Get("importpath").(string)
+	workingDir := d.Get("working_dir").(string)
+	repo, bare, err := imageRepo(ctx, po, d.Get("repo").(string), ip, workingDir)
+	if err != nil {
+		return diag.Errorf("read imageRepo: %v", err)
+	}
+	opts := po.registryOptions(buildOptions{
+		ip:           ip,
+		workingDir:   workingDir,
+		imageRepo:    repo,
+		bare:         bare,
+		platforms:    defaultPlatform(platforms),
+		baseImage:    getString(d, "base_image", po.bo.BaseImage),
+		sbom:         d.Get("sbom").(string),
+		ldflags:      po.ldflags,
+		env:          po.env,
+		noSBOMUpload: !po.sbomUpload,
+		buildRetries: po.buildRetries,
+		timeout:      po.timeout,
+
+		lenientSourceDateEpoch: po.lenientSourceDateEpoch,
+		remoteBuildCache:       po.remoteBuildCache,
+	})
+
+	buildCtx, cancel := opts.withTimeout(ctx)
+	res, ref, err := doBuild(buildCtx, opts)
+	err = opts.timeoutError(buildCtx, "build", err)
+	cancel()
+	if err != nil {
+		return diag.Errorf("read doBuild: %v", err)
+	}
+	if d.Get("push").(bool) {
+		publishCtx, cancel := opts.withTimeout(ctx)
+		ref, _, err = doPublish(publishCtx, res, opts)
+		err = opts.timeoutError(publishCtx, "publish", err)
+		cancel()
+		if err != nil {
+			return diag.Errorf("read doPublish: %v", err)
+		}
+	}
+
+	_ = d.Set("image_ref", ref)
+	d.SetId(ref)
+	return sourceDateEpochWarnings(opts)
+}
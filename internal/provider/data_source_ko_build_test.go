@@ -0,0 +1,98 @@
+package provider
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/crane"
+	"github.com/google/go-containerregistry/pkg/registry"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/resource"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+)
+
+func TestAccDataSourceKoBuild(t *testing.T) {
+	// Setup a local registry and have tests push to that.
+	srv := httptest.NewServer(registry.New())
+	defer srv.Close()
+	parts := strings.Split(srv.URL, ":")
+	url := fmt.Sprintf("localhost:%s/test", parts[len(parts)-1])
+	t.Setenv("KO_DOCKER_REPO", url)
+
+	imageRefRE := regexp.MustCompile("^" + url + "/github.com/ko-build/terraform-provider-ko/cmd/test@sha256:")
+	resource.Test(t, resource.TestCase{
+		ProviderFactories: providerFactories,
+		Steps: []resource.TestStep{{
+			// Without push, the image is only built.
+			Config: `
+			data "ko_build" "foo" {
+			  importpath = "github.com/ko-build/terraform-provider-ko/cmd/test"
+			}
+			`,
+			Check: resource.ComposeTestCheckFunc(
+				resource.TestMatchResourceAttr("data.ko_build.foo", "image_ref", imageRefRE),
+				resource.TestCheckResourceAttrWith("data.ko_build.foo", "image_ref", func(v string) error {
+					if _, err := crane.Head(v); err == nil {
+						return fmt.Errorf("expected %s not to be pushed", v)
+					}
+					return nil
+				}),
+			),
+		}, {
+			// The digest matches the ko_build resource with the same inputs, which pushes the image.
+			Config: `
+			data "ko_build" "foo" {
+			  importpath = "github.com/ko-build/terraform-provider-ko/cmd/test"
+			}
+
+			resource "ko_build" "foo" {
+			  importpath = "github.com/ko-build/terraform-provider-ko/cmd/test"
+			}
+			`,
+			Check: resource.ComposeTestCheckFunc(
+				resource.TestCheckResourceAttrPair("data.ko_build.foo", "image_ref", "ko_build.foo", "image_ref"),
+			),
+		}},
+	})
+
+	resource.Test(t, resource.TestCase{
+		ProviderFactories: providerFactories,
+		Steps: []resource.TestStep{{
+			Config: fmt.Sprintf(`
+			data "ko_build" "foo" {
+			  importpath = "github.com/ko-build/terraform-provider-ko/cmd/test"
+			  repo       = %q
+			  platforms  = ["linux/amd64", "linux/arm64"]
+			  push       = true
+			}
+			`, url+"/pushed"),
+			Check: resource.ComposeTestCheckFunc(
+				resource.TestMatchResourceAttr("data.ko_build.foo", "image_ref", regexp.MustCompile("^"+url+"/pushed@sha256:")),
+				resource.TestCheckResourceAttrWith("data.ko_build.foo", "image_ref", func(v string) error {
+					_, err := crane.Head(v)
+					return err
+				}),
+			),
+		}},
+	})
+}
+
+func TestSBOMValidation(t *testing.T) {
+	// The data source rejects an invalid sbom when validating its config, like the resource.
+	for name, s := range map[string]*schema.Resource{
+		"ko_build resource":    resourceBuild(),
+		"ko_build data source": dataSourceBuild(),
+	} {
+		validate := s.Schema["sbom"].ValidateDiagFunc
+		for _, v := range []string{"spdx", "none"} {
+			if diags := validate(v, nil); diags.HasError() {
+				t.Errorf("%s: expected sbom %q to be valid, got %v", name, v, diags)
+			}
+		}
+		if diags := validate("cyclonedx", nil); !diags.HasError() {
+			t.Errorf("%s: expected sbom %q to be invalid", name, "cyclonedx")
+		}
+	}
+}
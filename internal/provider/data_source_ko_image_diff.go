@@ -0,0 +1,234 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+)
+
+func dataSourceImageDiff() *schema.Resource {
+	return &schema.Resource{
+		Description: "Compares the config and layers of two images, for example to check that an image being promoted differs from the currently deployed image only in expected ways.",
+
+		ReadContext: dataSourceImageDiffRead,
+
+		Schema: map[string]*schema.Schema{
+			"from": {
+				Description: "Reference of the image to compare from",
+				Type:        schema.TypeString,
+				Required:    true,
+			},
+			"to": {
+				Description: "Reference of the image to compare to",
+				Type:        schema.TypeString,
+				Required:    true,
+			},
+			"platform": {
+				Description: "Platform to compare if either reference is a multi-platform index. Format: <os>[/<arch>[/<variant>]]",
+				Type:        schema.TypeString,
+				Optional:    true,
+				Default:     "linux/amd64",
+			},
+			"identical": {
+				Description: "Whether both references resolve to the same image digest",
+				Type:        schema.TypeBool,
+				Computed:    true,
+			},
+			"env_added": {
+				Description: "Environment variables in `to` that are not in `from`",
+				Type:        schema.TypeList,
+				Elem:        &schema.Schema{Type: schema.TypeString},
+				Computed:    true,
+			},
+			"env_removed": {
+				Description: "Environment variables in `from` that are not in `to`",
+				Type:        schema.TypeList,
+				Elem:        &schema.Schema{Type: schema.TypeString},
+				Computed:    true,
+			},
+			"entrypoint_changed": {
+				Description: "Whether the entrypoint differs",
+				Type:        schema.TypeBool,
+				Computed:    true,
+			},
+			"cmd_changed": {
+				Description: "Whether the cmd differs",
+				Type:        schema.TypeBool,
+				Computed:    true,
+			},
+			"labels_added": {
+				Description: "Labels in `to` that are not in `from`",
+				Type:        schema.TypeMap,
+				Elem:        &schema.Schema{Type: schema.TypeString},
+				Computed:    true,
+			},
+			"labels_removed": {
+				Description: "Labels in `from` that are not in `to`",
+				Type:        schema.TypeMap,
+				Elem:        &schema.Schema{Type: schema.TypeString},
+				Computed:    true,
+			},
+			"labels_changed": {
+				Description: "Labels in both images whose value differs, with the value in `to`",
+				Type:        schema.TypeMap,
+				Elem:        &schema.Schema{Type: schema.TypeString},
+				Computed:    true,
+			},
+			"layers_added": {
+				Description: "Layer digests in `to` that are not in `from`",
+				Type:        schema.TypeList,
+				Elem:        &schema.Schema{Type: schema.TypeString},
+				Computed:    true,
+			},
+			"layers_removed": {
+				Description: "Layer digests in `from` that are not in `to`",
+				Type:        schema.TypeList,
+				Elem:        &schema.Schema{Type: schema.TypeString},
+				Computed:    true,
+			},
+		},
+	}
+}
+
+// imageDiff is the difference between two images' configs and layers.
+type imageDiff struct {
+	envAdded, envRemoved          []string
+	entrypointChanged, cmdChanged bool
+	labelsAdded, labelsRemoved    map[string]string
+	labelsChanged                 map[string]string
+	layersAdded, layersRemoved    []string
+}
+
+func diffImages(from, to v1.Image) (*imageDiff, error) {
+	fcf, err := from.ConfigFile()
+	if err != nil {
+		return nil, fmt.Errorf("from config: %w", err)
+	}
+	tcf, err := to.ConfigFile()
+	if err != nil {
+		return nil, fmt.Errorf("to config: %w", err)
+	}
+	fl, err := layerDigests(from)
+	if err != nil {
+		return nil, fmt.Errorf("from layers: %w", err)
+	}
+	tl, err := layerDigests(to)
+	if err != nil {
+		return nil, fmt.Errorf("to layers: %w", err)
+	}
+
+	d := &imageDiff{
+		envAdded:          missingFrom(tcf.Config.Env, fcf.Config.Env),
+		envRemoved:        missingFrom(fcf.Config.Env, tcf.Config.Env),
+		entrypointChanged: !slices.Equal(fcf.Config.Entrypoint, tcf.Config.Entrypoint),
+		cmdChanged:        !slices.Equal(fcf.Config.Cmd, tcf.Config.Cmd),
+		labelsAdded:       map[string]string{},
+		labelsRemoved:     map[string]string{},
+		labelsChanged:     map[string]string{},
+		layersAdded:       missingFrom(tl, fl),
+		layersRemoved:     missingFrom(fl, tl),
+	}
+	for k, v := range tcf.Config.Labels {
+		if fv, found := fcf.Config.Labels[k]; !found {
+			d.labelsAdded[k] = v
+		} else if fv != v {
+			d.labelsChanged[k] = v
+		}
+	}
+	for k, v := range fcf.Config.Labels {
+		if _, found := tcf.Config.Labels[k]; !found {
+			d.labelsRemoved[k] = v
+		}
+	}
+	return d, nil
+}
+
+func layerDigests(img v1.Image) ([]string, error) {
+	layers, err := img.Layers()
+	if err != nil {
+		return nil, err
+	}
+	out := make([]string, 0, len(layers))
+	for _, l := range layers {
+		dig, err := l.Digest()
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, dig.String())
+	}
+	return out, nil
+}
+
+// missingFrom returns the elements of a that are not in b, in the order they appear in a.
+func missingFrom(a, b []string) []string {
+	out := []string{}
+	for _, s := range a {
+		if !slices.Contains(b, s) {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+func dataSourceImageDiffRead(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	po, err := NewProviderOpts(meta)
+	if err != nil {
+		return diag.Errorf("configuring provider: %v", err)
+	}
+
+	platform, err := v1.ParsePlatform(d.Get("platform").(string))
+	if err != nil {
+		return diag.Errorf("parsing platform: %v", err)
+	}
+	opts := po.registryOptions(buildOptions{imageRepo: po.po.DockerRepo})
+	if po.po.DockerRepo == "" {
+		// The provider's auth is for its repo, so there's nothing to use it for without one.
+		opts.auth = nil
+	}
+	ropts := append(opts.remoteOptions(ctx), remote.WithPlatform(*platform))
+
+	var imgs []v1.Image
+	var refs []string
+	var digests []v1.Hash
+	for _, key := range []string{"from", "to"} {
+		ref, err := name.ParseReference(d.Get(key).(string), opts.nameOptions()...)
+		if err != nil {
+			return diag.Errorf("parsing %s: %v", key, err)
+		}
+		img, err := remote.Image(ref, ropts...)
+		if err != nil {
+			return diag.Errorf("fetching %s: %v", key, err)
+		}
+		dig, err := img.Digest()
+		if err != nil {
+			return diag.Errorf("digest of %s: %v", key, err)
+		}
+		imgs = append(imgs, img)
+		refs = append(refs, ref.Context().Digest(dig.String()).String())
+		digests = append(digests, dig)
+	}
+
+	diff, err := diffImages(imgs[0], imgs[1])
+	if err != nil {
+		return diag.Errorf("diffing images: %v", err)
+	}
+
+	_ = d.Set("identical", digests[0] == digests[1])
+	_ = d.Set("env_added", diff.envAdded)
+	_ = d.Set("env_removed", diff.envRemoved)
+	_ = d.Set("entrypoint_changed", diff.entrypointChanged)
+	_ = d.Set("cmd_changed", diff.cmdChanged)
+	_ = d.Set("labels_added", diff.labelsAdded)
+	_ = d.Set("labels_removed", diff.labelsRemoved)
+	_ = d.Set("labels_changed", diff.labelsChanged)
+	_ = d.Set("layers_added", diff.layersAdded)
+	_ = d.Set("layers_removed", diff.layersRemoved)
+	d.SetId(refs[0] + ".." + refs[1])
+	return nil
+}
@@ -0,0 +1,111 @@
+package provider
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/crane"
+	"github.com/google/go-containerregistry/pkg/registry"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/resource"
+)
+
+func TestDiffImages(t *testing.T) {
+	base, err := random.Image(1024, 1)
+	if err != nil {
+		t.Fatalf("random.Image: %v", err)
+	}
+	from, err := mutate.Config(base, v1.Config{
+		Env:        []string{"A=1", "B=2"},
+		Entrypoint: []string{"/app"},
+		Labels:     map[string]string{"keep": "x", "change": "old", "drop": "y"},
+	})
+	if err != nil {
+		t.Fatalf("mutate.Config: %v", err)
+	}
+	layer, err := random.Layer(1024, "")
+	if err != nil {
+		t.Fatalf("random.Layer: %v", err)
+	}
+	to, err := mutate.AppendLayers(from, layer)
+	if err != nil {
+		t.Fatalf("mutate.AppendLayers: %v", err)
+	}
+	to, err = mutate.Config(to, v1.Config{
+		Env:        []string{"A=1", "C=3"},
+		Entrypoint: []string{"/app"},
+		Cmd:        []string{"--flag"},
+		Labels:     map[string]string{"keep": "x", "change": "new", "add": "z"},
+	})
+	if err != nil {
+		t.Fatalf("mutate.Config: %v", err)
+	}
+
+	d, err := diffImages(from, to)
+	if err != nil {
+		t.Fatalf("diffImages: %v", err)
+	}
+	ld, err := layer.Digest()
+	if err != nil {
+		t.Fatalf("Digest: %v", err)
+	}
+	if !slices.Equal(d.envAdded, []string{"C=3"}) || !slices.Equal(d.envRemoved, []string{"B=2"}) {
+		t.Errorf("env: got added=%v removed=%v", d.envAdded, d.envRemoved)
+	}
+	if d.entrypointChanged || !d.cmdChanged {
+		t.Errorf("got entrypointChanged=%t cmdChanged=%t", d.entrypointChanged, d.cmdChanged)
+	}
+	if d.labelsAdded["add"] != "z" || d.labelsRemoved["drop"] != "y" || d.labelsChanged["change"] != "new" || len(d.labelsChanged) != 1 {
+		t.Errorf("labels: got added=%v removed=%v changed=%v", d.labelsAdded, d.labelsRemoved, d.labelsChanged)
+	}
+	if !slices.Equal(d.layersAdded, []string{ld.String()}) || len(d.layersRemoved) != 0 {
+		t.Errorf("layers: got added=%v removed=%v", d.layersAdded, d.layersRemoved)
+	}
+}
+
+func TestAccDataSourceKoImageDiff(t *testing.T) {
+	// Setup a local registry and push two images to it.
+	srv := httptest.NewServer(registry.New())
+	defer srv.Close()
+	parts := strings.Split(srv.URL, ":")
+	url := fmt.Sprintf("localhost:%s/test", parts[len(parts)-1])
+
+	img, err := random.Image(1024, 1)
+	if err != nil {
+		t.Fatalf("random.Image: %v", err)
+	}
+	if err := crane.Push(img, url+"/diff:from"); err != nil {
+		t.Fatalf("crane.Push: %v", err)
+	}
+	img, err = mutate.Config(img, v1.Config{Env: []string{"FOO=bar"}})
+	if err != nil {
+		t.Fatalf("mutate.Config: %v", err)
+	}
+	if err := crane.Push(img, url+"/diff:to"); err != nil {
+		t.Fatalf("crane.Push: %v", err)
+	}
+
+	resource.Test(t, resource.TestCase{
+		ProviderFactories: providerFactories,
+		Steps: []resource.TestStep{{
+			Config: fmt.Sprintf(`
+			data "ko_image_diff" "foo" {
+			  from = "%[1]s/diff:from"
+			  to   = "%[1]s/diff:to"
+			}
+			`, url),
+			Check: resource.ComposeTestCheckFunc(
+				resource.TestCheckResourceAttr("data.ko_image_diff.foo", "identical", "false"),
+				resource.TestCheckResourceAttr("data.ko_image_diff.foo", "env_added.#", "1"),
+				resource.TestCheckResourceAttr("data.ko_image_diff.foo", "env_added.0", "FOO=bar"),
+				resource.TestCheckResourceAttr("data.ko_image_diff.foo", "env_removed.#", "0"),
+				resource.TestCheckResourceAttr("data.ko_image_diff.foo", "layers_added.#", "0"),
+			),
+		}},
+	})
+}
@@ -0,0 +1,162 @@
+package provider
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+)
+
+func dataSourcePreflight() *schema.Resource {
+	return &schema.Resource{
+		Description: "Checks that the provider is configured correctly without creating any resources: that a repo is configured, the registry is reachable and accepts pushes with the configured credentials, and that Go programs can be built. Reference it early in a configuration to fail fast on misconfiguration.",
+
+		ReadContext: dataSourcePreflightRead,
+
+		Schema: map[string]*schema.Schema{
+			"importpath": {
+				Description: "If set, also build this import path (without publishing it) to check that builds succeed",
+				Type:        schema.TypeString,
+				Optional:    true,
+			},
+			"working_dir": {
+				Description: "working directory for the build",
+				Type:        schema.TypeString,
+				Optional:    true,
+				Default:     ".",
+			},
+			"fail_on_error": {
+				Description: "If true, any failed check is reported as an error. Otherwise failures are only reported in `errors`.",
+				Type:        schema.TypeBool,
+				Optional:    true,
+				Default:     true,
+			},
+			"repo": {
+				Description: "The container repository images will be published to",
+				Type:        schema.TypeString,
+				Computed:    true,
+			},
+			"push_permitted": {
+				Description: "Whether the registry accepted the configured credentials to push to `repo`",
+				Type:        schema.TypeBool,
+				Computed:    true,
+			},
+			"go_version": {
+				Description: "Version of the Go toolchain that will be used for builds",
+				Type:        schema.TypeString,
+				Computed:    true,
+			},
+			"build_succeeded": {
+				Description: "Whether building `importpath` succeeded, if set",
+				Type:        schema.TypeBool,
+				Computed:    true,
+			},
+			"healthy": {
+				Description: "Whether all checks passed",
+				Type:        schema.TypeBool,
+				Computed:    true,
+			},
+			"errors": {
+				Description: "Descriptions of any failed checks",
+				Type:        schema.TypeList,
+				Elem:        &schema.Schema{Type: schema.TypeString},
+				Computed:    true,
+			},
+		},
+	}
+}
+
+func dataSourcePreflightRead(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	po, err := NewProviderOpts(meta)
+	if err != nil {
+		return diag.Errorf("configuring provider: %v", err)
+	}
+
+	var errs []error
+	repo := po.po.DockerRepo
+	pushPermitted := false
+	var nameOpts []name.Option
+	if po.insecure {
+		nameOpts = append(nameOpts, name.Insecure)
+	}
+	if repo == "" {
+		errs = append(errs, errors.New("one of KO_DOCKER_REPO env var, or provider `repo` must be set"))
+	} else if r, err := name.NewRepository(repo, nameOpts...); err != nil {
+		errs = append(errs, fmt.Errorf("parsing repo %q: %w", repo, err))
+	} else {
+		t := po.transport
+		if t == nil {
+			t = remote.DefaultTransport
+		}
+		opts := po.registryOptions(buildOptions{imageRepo: repo})
+		if err := remote.CheckPushPermission(r.Tag("latest"), opts.authKeychain(), t); err != nil {
+			errs = append(errs, fmt.Errorf("checking push permission to %s: %w", repo, err))
+		} else {
+			pushPermitted = true
+		}
+	}
+
+	goVersion, err := goToolchainVersion(ctx)
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	buildSucceeded := false
+	if ip := d.Get("importpath").(string); ip != "" && repo != "" {
+		if _, _, err := doBuild(ctx, po.registryOptions(buildOptions{
+			ip:         ip,
+			workingDir: d.Get("working_dir").(string),
+			imageRepo:  repo,
+			platforms:  defaultPlatform(nil),
+			baseImage:  po.bo.BaseImage,
+			sbom:       "none",
+			ldflags:    po.ldflags,
+			env:        po.env,
+		})); err != nil {
+			errs = append(errs, fmt.Errorf("building %s: %w", ip, err))
+		} else {
+			buildSucceeded = true
+		}
+	}
+
+	msgs := make([]string, 0, len(errs))
+	for _, err := range errs {
+		msgs = append(msgs, err.Error())
+	}
+	_ = d.Set("repo", repo)
+	_ = d.Set("push_permitted", pushPermitted)
+	_ = d.Set("go_version", goVersion)
+	_ = d.Set("build_succeeded", buildSucceeded)
+	_ = d.Set("healthy", len(errs) == 0)
+	_ = d.Set("errors", msgs)
+	d.SetId(repo)
+
+	if len(errs) > 0 && d.Get("fail_on_error").(bool) {
+		return diag.Errorf("preflight checks failed: %v", errors.Join(errs...))
+	}
+	return nil
+}
+
+// goToolchainVersion returns the version of the go toolchain ko will build with, respecting KO_GO_PATH like ko does.
+func goToolchainVersion(ctx context.Context) (string, error) {
+	gobin := os.Getenv("KO_GO_PATH")
+	if gobin == "" {
+		gobin = "go"
+	}
+	var out bytes.Buffer
+	cmd := exec.CommandContext(ctx, gobin, "env", "GOVERSION")
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("running %s env GOVERSION: %w: %s", gobin, err, out.String())
+	}
+	return strings.TrimSpace(out.String()), nil
+}
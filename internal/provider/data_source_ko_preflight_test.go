@@ -0,0 +1,185 @@
+package provider
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/ko/pkg/commands/options"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/resource"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+)
+
+func TestGoToolchainVersion(t *testing.T) {
+	v, err := goToolchainVersion(context.Background())
+	if err != nil {
+		t.Fatalf("goToolchainVersion: %v", err)
+	}
+	if !strings.HasPrefix(v, "go") {
+		t.Errorf("expected a go version, got %q", v)
+	}
+}
+
+func TestAccDataSourceKoPreflight(t *testing.T) {
+	// Setup a local registry and have tests push to that.
+	srv := httptest.NewServer(registry.New())
+	defer srv.Close()
+	parts := strings.Split(srv.URL, ":")
+	url := fmt.Sprintf("localhost:%s/test", parts[len(parts)-1])
+	t.Setenv("KO_DOCKER_REPO", url)
+
+	resource.Test(t, resource.TestCase{
+		ProviderFactories: providerFactories,
+		Steps: []resource.TestStep{{
+			Config: `
+			data "ko_preflight" "check" {
+			  importpath = "github.com/ko-build/terraform-provider-ko/cmd/test"
+			}
+			`,
+			Check: resource.ComposeTestCheckFunc(
+				resource.TestCheckResourceAttr("data.ko_preflight.check", "healthy", "true"),
+				resource.TestCheckResourceAttr("data.ko_preflight.check", "repo", url),
+				resource.TestCheckResourceAttr("data.ko_preflight.check", "push_permitted", "true"),
+				resource.TestCheckResourceAttr("data.ko_preflight.check", "build_succeeded", "true"),
+				resource.TestMatchResourceAttr("data.ko_preflight.check", "go_version", regexp.MustCompile("^go")),
+			),
+		}},
+	})
+
+	// A build failure is reported as an error by default, or in `errors` if fail_on_error is false.
+	resource.Test(t, resource.TestCase{
+		ProviderFactories: providerFactories,
+		Steps: []resource.TestStep{{
+			Config: `
+			data "ko_preflight" "check" {
+			  importpath = "github.com/ko-build/terraform-provider-ko/cmd/not-found"
+			}
+			`,
+			ExpectError: regexp.MustCompile("preflight checks failed"),
+		}, {
+			Config: `
+			data "ko_preflight" "check" {
+			  importpath    = "github.com/ko-build/terraform-provider-ko/cmd/not-found"
+			  fail_on_error = false
+			}
+			`,
+			Check: resource.ComposeTestCheckFunc(
+				resource.TestCheckResourceAttr("data.ko_preflight.check", "healthy", "false"),
+				resource.TestCheckResourceAttr("data.ko_preflight.check", "push_permitted", "true"),
+				resource.TestCheckResourceAttr("data.ko_preflight.check", "build_succeeded", "false"),
+				resource.TestCheckResourceAttr("data.ko_preflight.check", "errors.#", "1"),
+			),
+		}},
+	})
+}
+
+func TestPreflight_Insecure(t *testing.T) {
+	// Setup a local registry serving TLS with a self-signed certificate, named with a host that isn't
+	// assumed to be insecure the way localhost is, and send requests for it to the test server.
+	srv := httptest.NewTLSServer(registry.New())
+	defer srv.Close()
+	addr := srv.Listener.Addr().String()
+	_, port, _ := strings.Cut(addr, ":")
+	dialer := remote.DefaultTransport.(*http.Transport).Clone()
+	dialer.DialContext = func(ctx context.Context, network, _ string) (net.Conn, error) {
+		return (&net.Dialer{}).DialContext(ctx, network, addr)
+	}
+	transport := insecureTransport(dialer)
+	repo := "registry.example:" + port + "/test"
+	base := pushPreflightBase(t, repo+"/base:latest", transport)
+
+	d := preflight(t, &Opts{
+		bo:        &options.BuildOptions{BaseImage: base},
+		po:        &options.PublishOptions{DockerRepo: repo},
+		transport: transport,
+		insecure:  true,
+	})
+	if !d.Get("push_permitted").(bool) || !d.Get("build_succeeded").(bool) {
+		t.Errorf("expected preflight to push and build with insecure, got errors %v", d.Get("errors"))
+	}
+}
+
+func TestPreflight_ClientCert(t *testing.T) {
+	// Setup a local registry serving TLS that requires client certificates, named with a host that
+	// isn't assumed to be insecure the way localhost is, and send requests for it to the test server.
+	cert, certPEM, keyPEM := newClientCert(t)
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(cert)
+	srv := httptest.NewUnstartedServer(registry.New())
+	srv.TLS = &tls.Config{ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: clientCAs} //nolint: gosec
+	srv.StartTLS()
+	defer srv.Close()
+	addr := srv.Listener.Addr().String()
+	_, port, _ := strings.Cut(addr, ":")
+	caTr, err := caTransport(string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw})))
+	if err != nil {
+		t.Fatalf("caTransport: %v", err)
+	}
+	caTr.(*http.Transport).DialContext = func(ctx context.Context, network, _ string) (net.Conn, error) {
+		return (&net.Dialer{}).DialContext(ctx, network, addr)
+	}
+	// The registry's certificate is for 127.0.0.1, so verify it as that rather than the name it's reached by.
+	caTr.(*http.Transport).TLSClientConfig.ServerName = "127.0.0.1"
+	transport, err := clientCertTransport(caTr, certPEM, keyPEM)
+	if err != nil {
+		t.Fatalf("clientCertTransport: %v", err)
+	}
+	repo := "registry.example:" + port + "/test"
+	base := pushPreflightBase(t, repo+"/base:latest", transport)
+
+	d := preflight(t, &Opts{
+		bo:        &options.BuildOptions{BaseImage: base},
+		po:        &options.PublishOptions{DockerRepo: repo},
+		transport: transport,
+	})
+	if !d.Get("push_permitted").(bool) || !d.Get("build_succeeded").(bool) {
+		t.Errorf("expected preflight to push and build with the client certificate, got errors %v", d.Get("errors"))
+	}
+}
+
+// pushPreflightBase pushes a linux/amd64 base image to ref with transport, and returns its reference.
+func pushPreflightBase(t *testing.T, ref string, transport http.RoundTripper) string {
+	t.Helper()
+	img, err := random.Image(1024, 1)
+	if err != nil {
+		t.Fatalf("random.Image: %v", err)
+	}
+	if img, err = mutate.ConfigFile(img, &v1.ConfigFile{OS: "linux", Architecture: "amd64"}); err != nil {
+		t.Fatalf("mutate.ConfigFile: %v", err)
+	}
+	r, err := name.ParseReference(ref, name.Insecure)
+	if err != nil {
+		t.Fatalf("ParseReference: %v", err)
+	}
+	if err := remote.Write(r, img, remote.WithTransport(transport)); err != nil {
+		t.Fatalf("pushing base image: %v", err)
+	}
+	return ref
+}
+
+// preflight runs the ko_preflight checks of cmd/test with the provider options po, without failing on errors.
+func preflight(t *testing.T, po *Opts) *schema.ResourceData {
+	t.Helper()
+	d := schema.TestResourceDataRaw(t, dataSourcePreflight().Schema, map[string]interface{}{
+		"importpath":    "github.com/ko-build/terraform-provider-ko/cmd/test",
+		"fail_on_error": false,
+	})
+	if diags := dataSourcePreflightRead(context.Background(), d, po); diags.HasError() {
+		t.Fatalf("dataSourcePreflightRead: %v", diags)
+	}
+	return d
+}
@@ -0,0 +1,101 @@
+package provider
+
+import (
+	"fmt"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+	"github.com/google/ko/pkg/build"
+)
+
+// dockerLayerTypes maps layer media types to their Docker schema 2 equivalents.
+// Layers compressed with zstd, and uncompressed non-distributable layers, have none.
+var dockerLayerTypes = map[types.MediaType]types.MediaType{
+	types.OCILayer:                types.DockerLayer,
+	types.OCIUncompressedLayer:    types.DockerUncompressedLayer,
+	types.OCIRestrictedLayer:      types.DockerForeignLayer,
+	types.DockerLayer:             types.DockerLayer,
+	types.DockerUncompressedLayer: types.DockerUncompressedLayer,
+	types.DockerForeignLayer:      types.DockerForeignLayer,
+}
+
+// withDockerMediaTypes returns the built image or index using only Docker schema 2 media types, for runtimes that reject OCI media types:
+// a manifest list of Docker manifests, each with a Docker config and Docker layers. The layers themselves are unchanged.
+func withDockerMediaTypes(res build.Result) (build.Result, error) {
+	switch r := res.(type) {
+	case v1.ImageIndex:
+		im, err := r.IndexManifest()
+		if err != nil {
+			return nil, err
+		}
+		adds := make([]mutate.IndexAddendum, 0, len(im.Manifests))
+		for _, desc := range im.Manifests {
+			if !desc.MediaType.IsImage() {
+				return nil, fmt.Errorf("index entry %s has media type %s, which has no Docker equivalent", desc.Digest, desc.MediaType)
+			}
+			img, err := r.Image(desc.Digest)
+			if err != nil {
+				return nil, fmt.Errorf("reading image %s: %w", desc.Digest, err)
+			}
+			if img, err = dockerImage(img); err != nil {
+				return nil, fmt.Errorf("image %s: %w", desc.Digest, err)
+			}
+			adds = append(adds, mutate.IndexAddendum{
+				Add: img,
+				Descriptor: v1.Descriptor{
+					MediaType:   types.DockerManifestSchema2,
+					URLs:        desc.URLs,
+					Annotations: desc.Annotations,
+					Platform:    desc.Platform,
+				},
+			})
+		}
+		idx := mutate.IndexMediaType(empty.Index, types.DockerManifestList)
+		if len(im.Annotations) > 0 {
+			idx = mutate.Annotations(idx, im.Annotations).(v1.ImageIndex)
+		}
+		return mutate.AppendManifests(idx, adds...), nil
+	case v1.Image:
+		return dockerImage(r)
+	default:
+		return nil, fmt.Errorf("unexpected build result %T", res)
+	}
+}
+
+// dockerImage returns img with a Docker schema 2 manifest, config and layer media types, and the same config, layers and annotations.
+func dockerImage(img v1.Image) (v1.Image, error) {
+	layers, err := img.Layers()
+	if err != nil {
+		return nil, err
+	}
+	m, err := img.Manifest()
+	if err != nil {
+		return nil, err
+	}
+	cf, err := img.ConfigFile()
+	if err != nil {
+		return nil, err
+	}
+
+	out := mutate.ConfigMediaType(mutate.MediaType(empty.Image, types.DockerManifestSchema2), types.DockerConfigJSON)
+	adds := make([]mutate.Addendum, len(layers))
+	for i, layer := range layers {
+		mt, ok := dockerLayerTypes[m.Layers[i].MediaType]
+		if !ok {
+			return nil, fmt.Errorf("layer %s has media type %s, which has no Docker equivalent", m.Layers[i].Digest, m.Layers[i].MediaType)
+		}
+		adds[i] = mutate.Addendum{Layer: layer, URLs: m.Layers[i].URLs, MediaType: mt}
+	}
+	if out, err = mutate.Append(out, adds...); err != nil {
+		return nil, err
+	}
+	if out, err = mutate.ConfigFile(out, cf); err != nil {
+		return nil, err
+	}
+	if len(m.Annotations) > 0 {
+		out = mutate.Annotations(out, m.Annotations).(v1.Image)
+	}
+	return out, nil
+}
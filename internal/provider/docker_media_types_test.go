@@ -0,0 +1,157 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/registry"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+)
+
+// ociImage returns a random image with only OCI media types and an annotation.
+func ociImage(t *testing.T) v1.Image {
+	t.Helper()
+	layer, err := random.Layer(1024, types.OCILayer)
+	if err != nil {
+		t.Fatalf("random.Layer: %v", err)
+	}
+	img := mutate.ConfigMediaType(mutate.MediaType(empty.Image, types.OCIManifestSchema1), types.OCIConfigJSON)
+	if img, err = mutate.Append(img, mutate.Addendum{Layer: layer, MediaType: types.OCILayer}); err != nil {
+		t.Fatalf("mutate.Append: %v", err)
+	}
+	return mutate.Annotations(img, map[string]string{"foo": "bar"}).(v1.Image)
+}
+
+func checkDockerImage(t *testing.T, img v1.Image) {
+	t.Helper()
+	m, err := img.Manifest()
+	if err != nil {
+		t.Fatalf("Manifest: %v", err)
+	}
+	if m.MediaType != types.DockerManifestSchema2 {
+		t.Errorf("expected manifest media type %s, got %s", types.DockerManifestSchema2, m.MediaType)
+	}
+	if m.Config.MediaType != types.DockerConfigJSON {
+		t.Errorf("expected config media type %s, got %s", types.DockerConfigJSON, m.Config.MediaType)
+	}
+	for _, l := range m.Layers {
+		if l.MediaType != types.DockerLayer {
+			t.Errorf("expected layer media type %s, got %s", types.DockerLayer, l.MediaType)
+		}
+	}
+	if m.Annotations["foo"] != "bar" {
+		t.Errorf("expected annotations to be kept, got %v", m.Annotations)
+	}
+}
+
+func TestWithDockerMediaTypes(t *testing.T) {
+	img := ociImage(t)
+	res, err := withDockerMediaTypes(img)
+	if err != nil {
+		t.Fatalf("withDockerMediaTypes(image): %v", err)
+	}
+	got, ok := res.(v1.Image)
+	if !ok {
+		t.Fatalf("expected an image, got %T", res)
+	}
+	checkDockerImage(t, got)
+	// The config and layers themselves are unchanged.
+	wantCfg, _ := img.RawConfigFile()
+	gotCfg, _ := got.RawConfigFile()
+	if string(wantCfg) != string(gotCfg) {
+		t.Errorf("config changed:\nwant %s\ngot  %s", wantCfg, gotCfg)
+	}
+
+	p := v1.Platform{OS: "linux", Architecture: "arm64"}
+	idx := mutate.AppendManifests(mutate.IndexMediaType(empty.Index, types.OCIImageIndex), mutate.IndexAddendum{
+		Add:        img,
+		Descriptor: v1.Descriptor{Platform: &p},
+	})
+	res, err = withDockerMediaTypes(idx)
+	if err != nil {
+		t.Fatalf("withDockerMediaTypes(index): %v", err)
+	}
+	gotIdx, ok := res.(v1.ImageIndex)
+	if !ok {
+		t.Fatalf("expected an index, got %T", res)
+	}
+	im, err := gotIdx.IndexManifest()
+	if err != nil {
+		t.Fatalf("IndexManifest: %v", err)
+	}
+	if im.MediaType != types.DockerManifestList {
+		t.Errorf("expected index media type %s, got %s", types.DockerManifestList, im.MediaType)
+	}
+	if len(im.Manifests) != 1 {
+		t.Fatalf("expected 1 image, got %d", len(im.Manifests))
+	}
+	desc := im.Manifests[0]
+	if desc.MediaType != types.DockerManifestSchema2 {
+		t.Errorf("expected descriptor media type %s, got %s", types.DockerManifestSchema2, desc.MediaType)
+	}
+	if desc.Platform == nil || !desc.Platform.Equals(p) {
+		t.Errorf("expected platform %v, got %v", p, desc.Platform)
+	}
+	child, err := gotIdx.Image(desc.Digest)
+	if err != nil {
+		t.Fatalf("Image: %v", err)
+	}
+	checkDockerImage(t, child)
+
+	// zstd layers have no Docker media type.
+	zstd, err := random.Layer(1024, types.OCILayerZStd)
+	if err != nil {
+		t.Fatalf("random.Layer: %v", err)
+	}
+	bad, err := mutate.Append(img, mutate.Addendum{Layer: zstd, MediaType: types.OCILayerZStd})
+	if err != nil {
+		t.Fatalf("mutate.Append: %v", err)
+	}
+	if _, err := withDockerMediaTypes(bad); err == nil {
+		t.Error("expected an error for a zstd layer")
+	}
+}
+
+func TestDoBuild_DockerMediaTypes(t *testing.T) {
+	srv := httptest.NewServer(registry.New())
+	defer srv.Close()
+	parts := strings.Split(srv.URL, ":")
+	url := fmt.Sprintf("localhost:%s/test", parts[len(parts)-1])
+	base := pushBaseIndex(t, url+"/base",
+		v1.Platform{OS: "linux", Architecture: "amd64"},
+	)
+
+	opts := buildOptions{
+		ip:               "github.com/ko-build/terraform-provider-ko/cmd/test",
+		workingDir:       ".",
+		imageRepo:        url,
+		platforms:        []string{"linux/amd64"},
+		baseImage:        base,
+		sbom:             "none",
+		dockerMediaTypes: true,
+		forceIndex:       true,
+	}
+	res, _, err := doBuild(context.Background(), opts)
+	if err != nil {
+		t.Fatalf("doBuild: %v", err)
+	}
+	idx, ok := res.(v1.ImageIndex)
+	if !ok {
+		t.Fatalf("expected an index with force_index, got %T", res)
+	}
+	// force_index wraps the converted image in a Docker manifest list.
+	mt, err := idx.MediaType()
+	if err != nil {
+		t.Fatalf("MediaType: %v", err)
+	}
+	if mt != types.DockerManifestList {
+		t.Errorf("expected index media type %s, got %s", types.DockerManifestList, mt)
+	}
+}
@@ -0,0 +1,31 @@
+package provider
+
+import (
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/ko/pkg/build"
+)
+
+// withEntrypointPrefix returns the built image or index with prefix prepended to the entrypoint ko set for each image,
+// so that prefix runs with the path of the Go binary as its last argument.
+func withEntrypointPrefix(res build.Result, prefix []string) (build.Result, error) {
+	return mapImages(res, func(img v1.Image) (v1.Image, error) {
+		return mutateConfig(img, func(c *v1.Config) {
+			c.Entrypoint = append(append([]string{}, prefix...), c.Entrypoint...)
+		})
+	})
+}
+
+// withEntrypoint returns the built image or index with the entrypoint of each image replaced by entrypoint, if set,
+// and its command set to args, if set.
+func withEntrypoint(res build.Result, entrypoint, args []string) (build.Result, error) {
+	return mapImages(res, func(img v1.Image) (v1.Image, error) {
+		return mutateConfig(img, func(c *v1.Config) {
+			if len(entrypoint) > 0 {
+				c.Entrypoint = append([]string{}, entrypoint...)
+			}
+			if len(args) > 0 {
+				c.Cmd = append([]string{}, args...)
+			}
+		})
+	})
+}
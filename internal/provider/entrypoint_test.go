@@ -0,0 +1,150 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"net/http/httptest"
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/registry"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/resource"
+	specsv1 "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+func TestDoBuild_EntrypointPrefix(t *testing.T) {
+	srv := httptest.NewServer(registry.New())
+	defer srv.Close()
+	parts := strings.Split(srv.URL, ":")
+	url := fmt.Sprintf("localhost:%s/test", parts[len(parts)-1])
+
+	base := pushBaseIndex(t, url+"/base",
+		v1.Platform{OS: "linux", Architecture: "amd64"},
+		v1.Platform{OS: "linux", Architecture: "arm64"},
+	)
+
+	res, _, err := doBuild(context.Background(), buildOptions{
+		ip:               "github.com/ko-build/terraform-provider-ko/cmd/test",
+		workingDir:       ".",
+		imageRepo:        url,
+		platforms:        []string{"linux/amd64", "linux/arm64"},
+		baseImage:        base,
+		sbom:             "none",
+		entrypointPrefix: []string{"/tini", "--"},
+	})
+	if err != nil {
+		t.Fatalf("doBuild: %v", err)
+	}
+	idx, ok := res.(v1.ImageIndex)
+	if !ok {
+		t.Fatalf("expected an image index, got %T", res)
+	}
+	im, err := idx.IndexManifest()
+	if err != nil {
+		t.Fatalf("IndexManifest: %v", err)
+	}
+	// ko's annotations on the index are kept.
+	if got := im.Annotations[specsv1.AnnotationBaseImageName]; got != base+":latest" {
+		t.Errorf("expected base image name annotation %q, got %q", base+":latest", got)
+	}
+	if len(im.Manifests) != 2 {
+		t.Fatalf("expected 2 images, got %d", len(im.Manifests))
+	}
+	for _, desc := range im.Manifests {
+		img, err := idx.Image(desc.Digest)
+		if err != nil {
+			t.Fatalf("Image: %v", err)
+		}
+		cf, err := img.ConfigFile()
+		if err != nil {
+			t.Fatalf("ConfigFile: %v", err)
+		}
+		if want := []string{"/tini", "--", "/ko-app/test"}; !slices.Equal(cf.Config.Entrypoint, want) {
+			t.Errorf("expected entrypoint %v for %s, got %v", want, desc.Platform, cf.Config.Entrypoint)
+		}
+	}
+
+	// The binary is still found after the prefix.
+	if _, err := buildInfoOf(res); err != nil {
+		t.Errorf("buildInfoOf: %v", err)
+	}
+}
+
+func TestDoBuild_Entrypoint(t *testing.T) {
+	srv := httptest.NewServer(registry.New())
+	defer srv.Close()
+	parts := strings.Split(srv.URL, ":")
+	url := fmt.Sprintf("localhost:%s/test", parts[len(parts)-1])
+
+	base := pushBaseIndex(t, url+"/base",
+		v1.Platform{OS: "linux", Architecture: "amd64"},
+		v1.Platform{OS: "linux", Architecture: "arm64"},
+	)
+
+	res, _, err := doBuild(context.Background(), buildOptions{
+		ip:         "github.com/ko-build/terraform-provider-ko/cmd/test",
+		workingDir: ".",
+		imageRepo:  url,
+		platforms:  []string{"linux/amd64", "linux/arm64"},
+		baseImage:  base,
+		sbom:       "none",
+		entrypoint: []string{"/bin/sh", "-c"},
+		args:       []string{"exec /ko-app/test --flag"},
+	})
+	if err != nil {
+		t.Fatalf("doBuild: %v", err)
+	}
+	idx, ok := res.(v1.ImageIndex)
+	if !ok {
+		t.Fatalf("expected an image index, got %T", res)
+	}
+	im, err := idx.IndexManifest()
+	if err != nil {
+		t.Fatalf("IndexManifest: %v", err)
+	}
+	if len(im.Manifests) != 2 {
+		t.Fatalf("expected 2 images, got %d", len(im.Manifests))
+	}
+	for _, desc := range im.Manifests {
+		img, err := idx.Image(desc.Digest)
+		if err != nil {
+			t.Fatalf("Image: %v", err)
+		}
+		cf, err := img.ConfigFile()
+		if err != nil {
+			t.Fatalf("ConfigFile: %v", err)
+		}
+		if want := []string{"/bin/sh", "-c"}; !slices.Equal(cf.Config.Entrypoint, want) {
+			t.Errorf("expected entrypoint %v for %s, got %v", want, desc.Platform, cf.Config.Entrypoint)
+		}
+		if want := []string{"exec /ko-app/test --flag"}; !slices.Equal(cf.Config.Cmd, want) {
+			t.Errorf("expected cmd %v for %s, got %v", want, desc.Platform, cf.Config.Cmd)
+		}
+	}
+
+	// The binary is still found when the entrypoint no longer names it.
+	if _, err := buildInfoOf(res); err != nil {
+		t.Errorf("buildInfoOf: %v", err)
+	}
+}
+
+func TestAccResourceKoBuild_EntrypointPrefixRequiresNoSBOM(t *testing.T) {
+	t.Setenv("KO_DOCKER_REPO", "example.com/repo")
+
+	resource.Test(t, resource.TestCase{
+		ProviderFactories: providerFactories,
+		Steps: []resource.TestStep{{
+			Config: `
+			resource "ko_build" "foo" {
+			  importpath        = "github.com/ko-build/terraform-provider-ko/cmd/test"
+			  entrypoint_prefix = ["/tini", "--"]
+			}
+			`,
+			PlanOnly:    true,
+			ExpectError: regexp.MustCompile(`entrypoint_prefix requires sbom = "none"`),
+		}},
+	})
+}
@@ -0,0 +1,28 @@
+package provider
+
+import (
+	"maps"
+	"slices"
+	"strings"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/ko/pkg/build"
+)
+
+// withImageEnv returns the built image or index with env set in the Env of the config of each of its images,
+// replacing the values of the same variables that ko kept from the base image's config.
+func withImageEnv(res build.Result, env map[string]string) (build.Result, error) {
+	keys := slices.Sorted(maps.Keys(env))
+	return mapImages(res, func(img v1.Image) (v1.Image, error) {
+		return mutateConfig(img, func(c *v1.Config) {
+			c.Env = slices.DeleteFunc(slices.Clone(c.Env), func(kv string) bool {
+				k, _, _ := strings.Cut(kv, "=")
+				_, found := env[k]
+				return found
+			})
+			for _, k := range keys {
+				c.Env = append(c.Env, k+"="+env[k])
+			}
+		})
+	})
+}
@@ -0,0 +1,90 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+)
+
+func TestDoBuild_ImageEnv(t *testing.T) {
+	srv := httptest.NewServer(registry.New())
+	defer srv.Close()
+	parts := strings.Split(srv.URL, ":")
+	url := fmt.Sprintf("localhost:%s/test", parts[len(parts)-1])
+
+	base := pushBaseIndex(t, url+"/base", v1.Platform{OS: "linux", Architecture: "amd64"})
+
+	opts := buildOptions{
+		ip:         "github.com/ko-build/terraform-provider-ko/cmd/test",
+		workingDir: ".",
+		imageRepo:  url,
+		platforms:  []string{"linux/amd64"},
+		baseImage:  base,
+		sbom:       "none",
+		imageEnv:   map[string]string{"LOG_LEVEL": "debug", "GREETING": "hello world"},
+	}
+	res, _, err := doBuild(context.Background(), opts)
+	if err != nil {
+		t.Fatalf("doBuild: %v", err)
+	}
+	ref, _, err := doPublish(context.Background(), res, opts)
+	if err != nil {
+		t.Fatalf("doPublish: %v", err)
+	}
+
+	// Read the config back from the registry.
+	r, err := name.ParseReference(ref)
+	if err != nil {
+		t.Fatalf("ParseReference: %v", err)
+	}
+	img, err := remote.Image(r)
+	if err != nil {
+		t.Fatalf("remote.Image: %v", err)
+	}
+	cf, err := img.ConfigFile()
+	if err != nil {
+		t.Fatalf("ConfigFile: %v", err)
+	}
+	for _, want := range []string{"GREETING=hello world", "LOG_LEVEL=debug", "KO_DATA_PATH=/var/run/ko"} {
+		if !slices.Contains(cf.Config.Env, want) {
+			t.Errorf("expected Env to contain %q, got %v", want, cf.Config.Env)
+		}
+	}
+}
+
+func TestWithImageEnv(t *testing.T) {
+	img, err := random.Image(1024, 1)
+	if err != nil {
+		t.Fatalf("random.Image: %v", err)
+	}
+	cf, err := img.ConfigFile()
+	if err != nil {
+		t.Fatalf("ConfigFile: %v", err)
+	}
+	cf.Config.Env = []string{"PATH=/usr/bin", "LOG_LEVEL=info"}
+	if img, err = mutate.ConfigFile(img, cf); err != nil {
+		t.Fatalf("mutate.ConfigFile: %v", err)
+	}
+
+	res, err := withImageEnv(img, map[string]string{"LOG_LEVEL": "debug", "EMPTY": ""})
+	if err != nil {
+		t.Fatalf("withImageEnv: %v", err)
+	}
+	if cf, err = res.(v1.Image).ConfigFile(); err != nil {
+		t.Fatalf("ConfigFile: %v", err)
+	}
+	// The base image's value is replaced, and the others are kept.
+	if want := []string{"PATH=/usr/bin", "EMPTY=", "LOG_LEVEL=debug"}; !slices.Equal(cf.Config.Env, want) {
+		t.Errorf("expected Env %v, got %v", want, cf.Config.Env)
+	}
+}
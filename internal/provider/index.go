@@ -0,0 +1,60 @@
+package provider
+
+import (
+	"fmt"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+	"github.com/google/ko/pkg/build"
+	ocimutate "github.com/sigstore/cosign/v2/pkg/oci/mutate"
+	"github.com/sigstore/cosign/v2/pkg/oci/signed"
+)
+
+// wrapInIndex returns res as is if it's already an index, otherwise an index containing only the image res,
+// with the image's annotations, in the index media type matching the image's manifest media type.
+// The image keeps its digest and any SBOM ko attached to it, so publishing the index still uploads the SBOM.
+func wrapInIndex(res build.Result) (build.Result, error) {
+	img, ok := res.(v1.Image)
+	if !ok {
+		return res, nil
+	}
+	m, err := img.Manifest()
+	if err != nil {
+		return nil, err
+	}
+	mt, err := img.MediaType()
+	if err != nil {
+		return nil, err
+	}
+	cf, err := img.ConfigFile()
+	if err != nil {
+		return nil, err
+	}
+
+	indexType := types.OCIImageIndex
+	if mt == types.DockerManifestSchema2 {
+		indexType = types.DockerManifestList
+	}
+	idx := mutate.IndexMediaType(empty.Index, indexType)
+	if len(m.Annotations) > 0 {
+		idx = mutate.Annotations(idx, m.Annotations).(v1.ImageIndex)
+	}
+	// Images without attachments, such as those built without an SBOM, need wrapping to be added.
+	add, ok := img.(ocimutate.Appendable)
+	if !ok {
+		add = signed.Image(img)
+	}
+	out := ocimutate.AppendManifests(idx, ocimutate.IndexAddendum{
+		Add: add,
+		Descriptor: v1.Descriptor{
+			MediaType: mt,
+			Platform:  cf.Platform(),
+		},
+	})
+	if _, err := out.IndexManifest(); err != nil {
+		return nil, fmt.Errorf("building index: %w", err)
+	}
+	return out, nil
+}
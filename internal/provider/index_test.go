@@ -0,0 +1,88 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/crane"
+	"github.com/google/go-containerregistry/pkg/registry"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	specsv1 "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+func TestDoBuild_ForceIndex(t *testing.T) {
+	// Setup a local registry and have tests push to that.
+	srv := httptest.NewServer(registry.New())
+	defer srv.Close()
+	parts := strings.Split(srv.URL, ":")
+	url := fmt.Sprintf("localhost:%s/test", parts[len(parts)-1])
+	base := pushBaseIndex(t, url+"/base",
+		v1.Platform{OS: "linux", Architecture: "amd64"},
+		v1.Platform{OS: "linux", Architecture: "arm64"},
+	)
+
+	opts := buildOptions{
+		ip:         "github.com/ko-build/terraform-provider-ko/cmd/test",
+		workingDir: ".",
+		imageRepo:  url + "/force-index",
+		bare:       true,
+		platforms:  []string{"linux/arm64"},
+		baseImage:  base,
+		sbom:       "spdx",
+	}
+	res, _, err := doBuild(context.Background(), opts)
+	if err != nil {
+		t.Fatalf("doBuild: %v", err)
+	}
+	img, ok := res.(v1.Image)
+	if !ok {
+		t.Fatalf("expected an image without force_index, got %T", res)
+	}
+	imgDigest, err := img.Digest()
+	if err != nil {
+		t.Fatalf("Digest: %v", err)
+	}
+
+	opts.forceIndex = true
+	res, ref, err := doBuild(context.Background(), opts)
+	if err != nil {
+		t.Fatalf("doBuild: %v", err)
+	}
+	idx, ok := res.(v1.ImageIndex)
+	if !ok {
+		t.Fatalf("expected an index with force_index, got %T", res)
+	}
+	if mt, err := idx.MediaType(); err != nil || !mt.IsIndex() {
+		t.Errorf("expected an index media type, got %q (%v)", mt, err)
+	}
+	im, err := idx.IndexManifest()
+	if err != nil {
+		t.Fatalf("IndexManifest: %v", err)
+	}
+	if len(im.Manifests) != 1 {
+		t.Fatalf("expected 1 image in the index, got %d", len(im.Manifests))
+	}
+	// The index wraps the same image that's built without force_index.
+	if got := im.Manifests[0]; got.Digest != imgDigest || got.Platform == nil || got.Platform.Architecture != "arm64" {
+		t.Errorf("expected the arm64 image %s, got %s for %v", imgDigest, got.Digest, got.Platform)
+	}
+	if got := im.Annotations[specsv1.AnnotationBaseImageName]; got != base+":latest" {
+		t.Errorf("expected base image name annotation %q, got %q", base+":latest", got)
+	}
+
+	got, _, err := doPublish(context.Background(), res, opts)
+	if err != nil {
+		t.Fatalf("doPublish: %v", err)
+	}
+	if got != ref {
+		t.Errorf("expected published ref %q, got %q", ref, got)
+	}
+	// The image's SBOM is still uploaded.
+	sbomTag := strings.Replace(imgDigest.String(), ":", "-", 1) + ".sbom"
+	if _, err := crane.Digest(opts.imageRepo + ":" + sbomTag); err != nil {
+		t.Errorf("expected SBOM at %s: %v", sbomTag, err)
+	}
+}
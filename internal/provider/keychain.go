@@ -0,0 +1,161 @@
+package provider
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/docker/cli/cli/config"
+	"github.com/docker/cli/cli/config/configfile"
+	"github.com/docker/cli/cli/config/types"
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+)
+
+// configFileKeychain is a keychain that resolves credentials from a docker config file, like the one in a Kubernetes dockerconfigjson secret.
+type configFileKeychain struct {
+	cf *configfile.ConfigFile
+}
+
+// parseDockerConfigJSON parses a docker config file, either as JSON or base64-encoded JSON.
+func parseDockerConfigJSON(s string) (*configfile.ConfigFile, error) {
+	b := []byte(strings.TrimSpace(s))
+	if !bytes.HasPrefix(b, []byte("{")) {
+		decoded, err := base64.StdEncoding.DecodeString(string(b))
+		if err != nil {
+			return nil, fmt.Errorf("expected JSON or base64-encoded JSON: %w", err)
+		}
+		b = decoded
+	}
+	cf, err := config.LoadFromReader(bytes.NewReader(b))
+	if err != nil {
+		return nil, err
+	}
+	if cf.CredentialsStore != "" || len(cf.CredentialHelpers) > 0 {
+		return nil, fmt.Errorf("credential stores and helpers are not supported, only auths")
+	}
+	return cf, nil
+}
+
+// loadDockerConfigDir loads the docker config file in dir, the way the docker CLI does with DOCKER_CONFIG set to dir.
+func loadDockerConfigDir(dir string) (*configfile.ConfigFile, error) {
+	if _, err := os.Stat(filepath.Join(dir, config.ConfigFileName)); err != nil {
+		return nil, err
+	}
+	return config.Load(dir)
+}
+
+func (k configFileKeychain) Resolve(target authn.Resource) (authn.Authenticator, error) {
+	var cfg, empty types.AuthConfig
+	for _, key := range []string{
+		target.String(),
+		target.RegistryStr(),
+	} {
+		if key == name.DefaultRegistry {
+			key = authn.DefaultAuthKey
+		}
+
+		var err error
+		cfg, err = k.cf.GetAuthConfig(key)
+		if err != nil {
+			return nil, err
+		}
+		// GetAuthConfig sets ServerAddress, which we don't use, so clear it to check if cfg is empty.
+		cfg.ServerAddress = ""
+		if cfg != empty {
+			break
+		}
+	}
+	if cfg == empty {
+		return authn.Anonymous, nil
+	}
+
+	return authn.FromConfig(authn.AuthConfig{
+		Username:      cfg.Username,
+		Password:      cfg.Password,
+		Auth:          cfg.Auth,
+		IdentityToken: cfg.IdentityToken,
+		RegistryToken: cfg.RegistryToken,
+	}), nil
+}
+
+// namedKeychain is a keychain with a name to report as the source of the credentials it provides.
+type namedKeychain struct {
+	name string
+	authn.Keychain
+}
+
+// keychainsByName returns the keychains of the provider's default keychain with names, in the order of names.
+func keychainsByName(names []string) ([]namedKeychain, error) {
+	kc := make([]namedKeychain, 0, len(names))
+	for _, n := range names {
+		i := slices.IndexFunc(keychain, func(k namedKeychain) bool { return k.name == n })
+		if i < 0 {
+			known := make([]string, len(keychain))
+			for j, k := range keychain {
+				known[j] = k.name
+			}
+			return nil, fmt.Errorf("unknown keychain %q, expected one of %s", n, strings.Join(known, ", "))
+		}
+		if slices.ContainsFunc(kc, func(k namedKeychain) bool { return k.name == n }) {
+			return nil, fmt.Errorf("keychain %q is listed more than once", n)
+		}
+		kc = append(kc, keychain[i])
+	}
+	return kc, nil
+}
+
+// multiKeychain resolves credentials from the first of its keychains that provides them, like authn.NewMultiKeychain,
+// and logs which keychain that was, recording it in sources if set.
+type multiKeychain struct {
+	keychains []namedKeychain
+	sources   *authSources
+}
+
+func (k multiKeychain) Resolve(target authn.Resource) (authn.Authenticator, error) {
+	for _, kc := range k.keychains {
+		auth, err := kc.Resolve(target)
+		if err != nil {
+			return nil, fmt.Errorf("resolving credentials from %s keychain: %w", kc.name, err)
+		}
+		if auth != authn.Anonymous {
+			log.Printf("[DEBUG] using credentials from %s keychain for %s", kc.name, target.RegistryStr())
+			k.sources.set(target.RegistryStr(), kc.name)
+			return auth, nil
+		}
+	}
+	log.Printf("[DEBUG] no keychain provided credentials for %s, using anonymous access", target.RegistryStr())
+	k.sources.set(target.RegistryStr(), "anonymous")
+	return authn.Anonymous, nil
+}
+
+// authSources records the name of the keychain that provided credentials for each registry.
+type authSources struct {
+	mu sync.Mutex
+	m  map[string]string
+}
+
+func (s *authSources) set(registry, source string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.m == nil {
+		s.m = map[string]string{}
+	}
+	s.m[registry] = source
+}
+
+// get returns the name of the keychain that provided credentials for registry, or "" if none were resolved for it.
+func (s *authSources) get(registry string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.m[registry]
+}
@@ -0,0 +1,182 @@
+package provider
+
+import (
+	"encoding/base64"
+	"slices"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+)
+
+func TestConfigFileKeychain(t *testing.T) {
+	auth := base64.StdEncoding.EncodeToString([]byte("user:pass"))
+	js := `{"auths": {"registry.example.com": {"auth": "` + auth + `"}}}`
+
+	for _, tc := range []struct {
+		name, in string
+	}{
+		{"json", js},
+		{"base64", base64.StdEncoding.EncodeToString([]byte(js))},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			cf, err := parseDockerConfigJSON(tc.in)
+			if err != nil {
+				t.Fatalf("parseDockerConfigJSON: %v", err)
+			}
+			kc := configFileKeychain{cf}
+
+			reg, err := name.NewRegistry("registry.example.com")
+			if err != nil {
+				t.Fatalf("NewRegistry: %v", err)
+			}
+			a, err := kc.Resolve(reg)
+			if err != nil {
+				t.Fatalf("Resolve: %v", err)
+			}
+			cfg, err := a.Authorization()
+			if err != nil {
+				t.Fatalf("Authorization: %v", err)
+			}
+			if cfg.Username != "user" || cfg.Password != "pass" {
+				t.Errorf("got %s:%s, want user:pass", cfg.Username, cfg.Password)
+			}
+
+			other, err := name.NewRegistry("other.example.com")
+			if err != nil {
+				t.Fatalf("NewRegistry: %v", err)
+			}
+			if a, err := kc.Resolve(other); err != nil || a != authn.Anonymous {
+				t.Errorf("expected anonymous for other registry, got %v, %v", a, err)
+			}
+		})
+	}
+}
+
+func TestParseDockerConfigJSON_Invalid(t *testing.T) {
+	for _, in := range []string{
+		"not base64!",
+		`{"auths": `,
+		`{"credsStore": "desktop"}`,
+	} {
+		if _, err := parseDockerConfigJSON(in); err == nil {
+			t.Errorf("parseDockerConfigJSON(%q): expected error", in)
+		}
+	}
+}
+
+func TestMultiKeychain(t *testing.T) {
+	js := `{"auths": {"registry.example.com": {"auth": "` + base64.StdEncoding.EncodeToString([]byte("user:pass")) + `"}}}`
+	cf, err := parseDockerConfigJSON(js)
+	if err != nil {
+		t.Fatalf("parseDockerConfigJSON: %v", err)
+	}
+	opts := buildOptions{
+		imageRepo:   "basic.example.com/app",
+		auth:        &authn.AuthConfig{Username: "basic", Password: "pass"},
+		keychain:    []namedKeychain{{"docker_config_json", configFileKeychain{cf}}},
+		authSources: &authSources{},
+	}
+	kc := opts.authKeychain()
+
+	for registry, want := range map[string]string{
+		"basic.example.com":    "basic_auth",
+		"registry.example.com": "docker_config_json",
+		"other.example.com":    "anonymous",
+	} {
+		reg, err := name.NewRegistry(registry)
+		if err != nil {
+			t.Fatalf("NewRegistry: %v", err)
+		}
+		if _, err := kc.Resolve(reg); err != nil {
+			t.Fatalf("Resolve(%s): %v", registry, err)
+		}
+		if got := opts.authSources.get(registry); got != want {
+			t.Errorf("expected credentials for %s from %q, got %q", registry, want, got)
+		}
+	}
+	if got := authSourceOf(opts, "registry.example.com/app@sha256:0000000000000000000000000000000000000000000000000000000000000000"); got != "docker_config_json" {
+		t.Errorf("expected auth source %q, got %q", "docker_config_json", got)
+	}
+}
+
+func TestResourceAuth(t *testing.T) {
+	js := `{"auths": {"registry.example.com": {"auth": "` + base64.StdEncoding.EncodeToString([]byte("user:pass")) + `"}}}`
+	cf, err := parseDockerConfigJSON(js)
+	if err != nil {
+		t.Fatalf("parseDockerConfigJSON: %v", err)
+	}
+	opts := buildOptions{
+		imageRepo:    "basic.example.com/app",
+		auth:         &authn.AuthConfig{Username: "basic", Password: "pass"},
+		resourceAuth: &authn.AuthConfig{RegistryToken: "token"},
+		keychain:     []namedKeychain{{"docker_config_json", configFileKeychain{cf}}},
+		authSources:  &authSources{},
+	}
+	kc := opts.authKeychain()
+
+	// The resource's credentials are used for its registry ahead of the provider's basic_auth.
+	reg, err := name.NewRegistry("basic.example.com")
+	if err != nil {
+		t.Fatalf("NewRegistry: %v", err)
+	}
+	a, err := kc.Resolve(reg)
+	if err != nil {
+		t.Fatalf("Resolve: %v", err)
+	}
+	cfg, err := a.Authorization()
+	if err != nil {
+		t.Fatalf("Authorization: %v", err)
+	}
+	if cfg.RegistryToken != "token" {
+		t.Errorf("expected the resource's token, got %+v", cfg)
+	}
+	if got := opts.authSources.get("basic.example.com"); got != "resource_auth" {
+		t.Errorf("expected credentials from %q, got %q", "resource_auth", got)
+	}
+
+	// Other registries still use the provider's keychain.
+	if reg, err = name.NewRegistry("registry.example.com"); err != nil {
+		t.Fatalf("NewRegistry: %v", err)
+	}
+	if _, err := kc.Resolve(reg); err != nil {
+		t.Fatalf("Resolve: %v", err)
+	}
+	if got := opts.authSources.get("registry.example.com"); got != "docker_config_json" {
+		t.Errorf("expected credentials from %q, got %q", "docker_config_json", got)
+	}
+}
+
+func TestKeychainsByName(t *testing.T) {
+	for _, tc := range []struct {
+		names []string
+		want  []string
+	}{
+		{[]string{"google", "default", "ecr"}, []string{"google", "default", "ecr"}},
+		{[]string{"default"}, []string{"default"}},
+		{[]string{}, []string{}},
+	} {
+		kc, err := keychainsByName(tc.names)
+		if err != nil {
+			t.Fatalf("keychainsByName(%v): %v", tc.names, err)
+		}
+		// The multi-keychain the provider resolves credentials with uses them in the same order.
+		mk, ok := (&buildOptions{keychain: kc}).authKeychain().(multiKeychain)
+		if !ok {
+			t.Fatalf("authKeychain returned %T, want multiKeychain", (&buildOptions{keychain: kc}).authKeychain())
+		}
+		got := make([]string, len(mk.keychains))
+		for i, k := range mk.keychains {
+			got[i] = k.name
+		}
+		if !slices.Equal(got, tc.want) {
+			t.Errorf("keychainsByName(%v) = %v, want %v", tc.names, got, tc.want)
+		}
+	}
+
+	for _, names := range [][]string{{"env"}, {"google", "google"}} {
+		if _, err := keychainsByName(names); err == nil {
+			t.Errorf("keychainsByName(%v): expected error", names)
+		}
+	}
+}
@@ -0,0 +1,41 @@
+package provider
+
+import (
+	"github.com/google/ko/pkg/build"
+	"github.com/google/ko/pkg/commands/options"
+)
+
+// koConfig is what ko's `.ko.yaml` config file says about building one importpath.
+type koConfig struct {
+	baseImage string       // The base image from baseImageOverrides for the importpath, or defaultBaseImage, or ko's default base image.
+	platforms []string     // defaultPlatforms, if set.
+	build     build.Config // The builds entry for the importpath, with defaultEnv, defaultFlags and defaultLdflags for any it doesn't set.
+}
+
+// loadKoConfig reads the `.ko.yaml` in workingDir, or at KO_CONFIG_PATH if that's set, the way the ko CLI does,
+// and returns its settings for building ip. Without a config file, it returns ko's defaults.
+func loadKoConfig(workingDir, ip string) (*koConfig, error) {
+	bo := options.BuildOptions{WorkingDirectory: workingDir}
+	if err := bo.LoadConfig(); err != nil {
+		return nil, err
+	}
+	kc := &koConfig{
+		baseImage: bo.BaseImage,
+		platforms: bo.DefaultPlatforms,
+		build:     bo.BuildConfigs[ip],
+	}
+	if b, ok := bo.BaseImageOverrides[ip]; ok {
+		kc.baseImage = b
+	}
+	// Like ko, each of these falls back to the default separately when the build doesn't set it.
+	if len(kc.build.Env) == 0 {
+		kc.build.Env = bo.DefaultEnv
+	}
+	if len(kc.build.Flags) == 0 {
+		kc.build.Flags = bo.DefaultFlags
+	}
+	if len(kc.build.Ldflags) == 0 {
+		kc.build.Ldflags = bo.DefaultLdflags
+	}
+	return kc, nil
+}
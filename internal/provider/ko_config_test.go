@@ -0,0 +1,141 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/registry"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+)
+
+// writeKoConfig writes config to a file and points KO_CONFIG_PATH at it for the rest of the test.
+func writeKoConfig(t *testing.T, config string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), ".ko.yaml")
+	if err := os.WriteFile(path, []byte(config), 0o644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	t.Setenv("KO_CONFIG_PATH", path)
+}
+
+func TestLoadKoConfig(t *testing.T) {
+	// Without a config file, ko's defaults apply.
+	kc, err := loadKoConfig(t.TempDir(), "example.com/foo")
+	if err != nil {
+		t.Fatalf("loadKoConfig: %v", err)
+	}
+	if kc.baseImage != "cgr.dev/chainguard/static:latest" || len(kc.platforms) != 0 || len(kc.build.Flags) != 0 {
+		t.Errorf("expected ko's defaults, got %+v", kc)
+	}
+
+	writeKoConfig(t, `
+defaultBaseImage: example.com/default
+defaultPlatforms: [linux/arm64, linux/amd64]
+defaultLdflags: [-s]
+defaultEnv: [FOO=default]
+baseImageOverrides:
+  github.com/ko-build/terraform-provider-ko/cmd/test-tags: example.com/override
+builds:
+- id: tags
+  dir: ../../cmd/test-tags
+  flags: [-tags=loud]
+  env: [FOO=build]
+`)
+	for _, tc := range []struct {
+		ip        string
+		baseImage string
+		flags     []string
+		ldflags   []string
+		env       []string
+	}{{
+		// The builds entry takes precedence over the defaults, except for ldflags it doesn't set.
+		ip:        "github.com/ko-build/terraform-provider-ko/cmd/test-tags",
+		baseImage: "example.com/override",
+		flags:     []string{"-tags=loud"},
+		ldflags:   []string{"-s"},
+		env:       []string{"FOO=build"},
+	}, {
+		ip:        "github.com/ko-build/terraform-provider-ko/cmd/test",
+		baseImage: "example.com/default",
+		ldflags:   []string{"-s"},
+		env:       []string{"FOO=default"},
+	}} {
+		kc, err := loadKoConfig(".", tc.ip)
+		if err != nil {
+			t.Fatalf("loadKoConfig(%s): %v", tc.ip, err)
+		}
+		if kc.baseImage != tc.baseImage {
+			t.Errorf("%s: expected base image %s, got %s", tc.ip, tc.baseImage, kc.baseImage)
+		}
+		if want := []string{"linux/arm64", "linux/amd64"}; !slices.Equal(kc.platforms, want) {
+			t.Errorf("%s: expected platforms %v, got %v", tc.ip, want, kc.platforms)
+		}
+		if !slices.Equal(kc.build.Flags, tc.flags) || !slices.Equal(kc.build.Ldflags, tc.ldflags) || !slices.Equal(kc.build.Env, tc.env) {
+			t.Errorf("%s: expected flags %v, ldflags %v, env %v, got %v, %v, %v", tc.ip, tc.flags, tc.ldflags, tc.env, kc.build.Flags, kc.build.Ldflags, kc.build.Env)
+		}
+	}
+
+	writeKoConfig(t, "defaultBaseImage: 'not a reference!'\n")
+	if _, err := loadKoConfig(".", "example.com/foo"); err == nil {
+		t.Error("expected an error for an invalid defaultBaseImage")
+	}
+}
+
+func TestDoBuild_KoConfig(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("running the built binary requires a linux host")
+	}
+
+	// Setup a local registry to serve the base image.
+	srv := httptest.NewServer(registry.New())
+	defer srv.Close()
+	parts := strings.Split(srv.URL, ":")
+	url := fmt.Sprintf("localhost:%s/test", parts[len(parts)-1])
+	base := pushBaseIndex(t, url+"/base", v1.Platform{OS: "linux", Architecture: runtime.GOARCH})
+
+	writeKoConfig(t, `
+builds:
+- dir: ../../cmd/test-tags
+  flags: [-tags=loud]
+`)
+	kc, err := loadKoConfig(".", "github.com/ko-build/terraform-provider-ko/cmd/test-tags")
+	if err != nil {
+		t.Fatalf("loadKoConfig: %v", err)
+	}
+	res, _, err := doBuild(context.Background(), buildOptions{
+		ip:         "github.com/ko-build/terraform-provider-ko/cmd/test-tags",
+		workingDir: ".",
+		imageRepo:  url,
+		platforms:  []string{"linux/" + runtime.GOARCH},
+		baseImage:  base,
+		sbom:       "none",
+		koBuild:    kc.build,
+	})
+	if err != nil {
+		t.Fatalf("doBuild: %v", err)
+	}
+	b, err := binaryOf(res)
+	if err != nil {
+		t.Fatalf("binaryOf: %v", err)
+	}
+	bin := filepath.Join(t.TempDir(), "test-tags")
+	if err := os.WriteFile(bin, b, 0o755); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	out, err := exec.Command(bin).Output()
+	if err != nil {
+		t.Fatalf("running binary: %v", err)
+	}
+	// The flags from the config file built the binary with the loud tag.
+	if got := strings.TrimSpace(string(out)); got != "HELLO" {
+		t.Errorf("expected the binary to print %q, got %q", "HELLO", got)
+	}
+}
@@ -0,0 +1,89 @@
+package provider
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// largestKodataFiles is how many of the largest files a kodata size warning lists.
+const largestKodataFiles = 5
+
+// kodataSizeWarning returns a warning listing the largest files in the kodata directory if the files that go into the image
+// total more than o.kodataWarnSize bytes, or "" if they don't.
+func (o *buildOptions) kodataSizeWarning(ctx context.Context) (string, error) {
+	dir, err := kodataDir(ctx, *o)
+	if err != nil {
+		return "", err
+	}
+	ignore, err := readKoignore(dir)
+	if err != nil {
+		return "", fmt.Errorf("reading %s: %w", koignoreFile, err)
+	}
+
+	type file struct {
+		path string
+		size int64
+	}
+	var files []file
+	var total int64
+	if err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if ignore != nil && koignored(ignore, rel) {
+			return nil
+		}
+		// ko follows symlinks, so count the size of what they point to.
+		info, err := os.Stat(path)
+		if err != nil {
+			return err
+		}
+		files = append(files, file{rel, info.Size()})
+		total += info.Size()
+		return nil
+	}); errors.Is(err, fs.ErrNotExist) {
+		return "", nil
+	} else if err != nil {
+		return "", err
+	}
+	if total <= o.kodataWarnSize {
+		return "", nil
+	}
+
+	slices.SortFunc(files, func(a, b file) int { return cmp.Compare(b.size, a.size) })
+	var largest []string
+	for _, f := range files[:min(len(files), largestKodataFiles)] {
+		largest = append(largest, fmt.Sprintf("%s (%s)", f.path, humanSize(f.size)))
+	}
+	return fmt.Sprintf("the kodata directory %s adds %s to the image, more than kodata_warn_size (%s). The largest files are: %s. Remove files that don't need to be in the image, or list them in kodata/%s.",
+		dir, humanSize(total), humanSize(o.kodataWarnSize), strings.Join(largest, ", "), koignoreFile), nil
+}
+
+// humanSize formats n bytes using binary units, like 1.5 MiB.
+func humanSize(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,85 @@
+package provider
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestKodataSizeWarning(t *testing.T) {
+	dir := t.TempDir()
+	write := func(path, content string) {
+		t.Helper()
+		path = filepath.Join(dir, path)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatalf("MkdirAll: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatalf("WriteFile: %v", err)
+		}
+	}
+	write("go.mod", "module example.com/app\n\ngo 1.21\n")
+	write("main.go", "package main\n\nfunc main() {}\n")
+	t.Setenv("GOWORK", "off")
+
+	opts := buildOptions{
+		ip:             "example.com/app",
+		workingDir:     dir,
+		kodataWarnSize: 2048,
+	}
+	warning := func() string {
+		t.Helper()
+		msg, err := opts.kodataSizeWarning(context.Background())
+		if err != nil {
+			t.Fatalf("kodataSizeWarning: %v", err)
+		}
+		return msg
+	}
+
+	// No kodata directory, no warning.
+	if msg := warning(); msg != "" {
+		t.Errorf("expected no warning without kodata, got %q", msg)
+	}
+
+	// Under the threshold, no warning.
+	write("kodata/index.html", strings.Repeat("x", 1024))
+	if msg := warning(); msg != "" {
+		t.Errorf("expected no warning under the threshold, got %q", msg)
+	}
+
+	// Ignored files don't count.
+	write("kodata/dump.bin", strings.Repeat("x", 4096))
+	write("kodata/.koignore", "*.bin\n")
+	if msg := warning(); msg != "" {
+		t.Errorf("expected ignored files not to count, got %q", msg)
+	}
+
+	// Over the threshold, the largest files are listed, largest first.
+	write("kodata/static/video.mp4", strings.Repeat("x", 3<<20))
+	msg := warning()
+	for _, want := range []string{"adds 3.0 MiB", "kodata_warn_size (2.0 KiB)", "static/video.mp4 (3.0 MiB), index.html (1.0 KiB)"} {
+		if !strings.Contains(msg, want) {
+			t.Errorf("expected warning to contain %q, got %q", want, msg)
+		}
+	}
+	if strings.Contains(msg, "dump.bin") {
+		t.Errorf("expected warning not to list ignored files, got %q", msg)
+	}
+}
+
+func TestHumanSize(t *testing.T) {
+	for n, want := range map[int64]string{
+		0:         "0 B",
+		1023:      "1023 B",
+		1024:      "1.0 KiB",
+		1536:      "1.5 KiB",
+		5 << 20:   "5.0 MiB",
+		3<<30 + 1: "3.0 GiB",
+	} {
+		if got := humanSize(n); got != want {
+			t.Errorf("humanSize(%d) = %q, want %q", n, got, want)
+		}
+	}
+}
@@ -0,0 +1,227 @@
+package provider
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/tarball"
+	"github.com/google/ko/pkg/build"
+)
+
+// koignoreFile is the name of the file in the kodata directory that lists files to leave out of the image.
+const koignoreFile = ".koignore"
+
+// kodataRoot is where ko puts kodata in the image.
+const kodataRoot = "/var/run/ko"
+
+// kodataComment is the history comment ko gives the kodata layer.
+const kodataComment = "kodata contents, at $KO_DATA_PATH"
+
+// kodataDir returns the path of the kodata directory of the package opts.ip, whether or not it exists.
+func kodataDir(ctx context.Context, opts buildOptions) (string, error) {
+	gobin := os.Getenv("KO_GO_PATH")
+	if gobin == "" {
+		gobin = "go"
+	}
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, gobin, "list", "-f", "{{.Dir}}", strings.TrimPrefix(opts.ip, "ko://")) //nolint: gosec // Same go invocation ko makes.
+	cmd.Dir = opts.workingDir
+	cmd.Env = append(os.Environ(), opts.env...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("go list %s: %w: %s", opts.ip, err, stderr.String())
+	}
+	return filepath.Join(strings.TrimSpace(stdout.String()), "kodata"), nil
+}
+
+// readKoignore returns the patterns in the .koignore file in the kodata directory dir, or nil if there isn't one.
+// Blank lines and lines starting with # are skipped.
+func readKoignore(dir string) ([]string, error) {
+	f, err := os.Open(filepath.Join(dir, koignoreFile))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var patterns []string
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		switch {
+		case line == "", strings.HasPrefix(line, "#"):
+			continue
+		case strings.HasPrefix(line, "!"):
+			return nil, fmt.Errorf("%s: negated pattern %q is not supported", koignoreFile, line)
+		}
+		if _, err := path.Match(strings.Trim(line, "/"), ""); err != nil {
+			return nil, fmt.Errorf("%s: invalid pattern %q: %w", koignoreFile, line, err)
+		}
+		patterns = append(patterns, line)
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	// Only return patterns if there's a .koignore, even if it's empty, so it's still left out of the image.
+	return append(patterns, "/"+koignoreFile), nil
+}
+
+// koignored reports whether the file at rel, relative to the kodata directory, matches any of patterns.
+// Like .gitignore, a pattern containing a / matches the whole path from the kodata directory, a pattern without one matches
+// the name of a file or directory at any depth, and a pattern ending in / only matches directories. Ignoring a directory ignores everything in it.
+func koignored(patterns []string, rel string) bool {
+	elems := strings.Split(rel, "/")
+	for i := range elems {
+		isDir := i < len(elems)-1
+		for _, p := range patterns {
+			dirOnly := strings.HasSuffix(p, "/")
+			if dirOnly && !isDir {
+				continue
+			}
+			p = strings.TrimSuffix(p, "/")
+			var matched bool
+			if strings.Contains(p, "/") {
+				matched, _ = path.Match(strings.TrimPrefix(p, "/"), strings.Join(elems[:i+1], "/"))
+			} else {
+				matched, _ = path.Match(p, elems[i])
+			}
+			if matched {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// withKoignore returns the built image or index with the files matching patterns removed from the kodata layer of each image.
+func withKoignore(res build.Result, patterns []string) (build.Result, error) {
+	return mapImages(res, func(img v1.Image) (v1.Image, error) {
+		cf, err := img.ConfigFile()
+		if err != nil {
+			return nil, err
+		}
+		// History entries for layers line up with the layers, skipping entries that didn't create one.
+		i := -1
+		for _, h := range cf.History {
+			if h.EmptyLayer {
+				continue
+			}
+			i++
+			if h.Comment == kodataComment {
+				break
+			}
+		}
+		layers, err := img.Layers()
+		if err != nil {
+			return nil, err
+		}
+		if i < 0 || i >= len(layers) {
+			return nil, errors.New("kodata layer not found")
+		}
+		filtered, err := filterKodata(layers[i], patterns)
+		if err != nil {
+			return nil, fmt.Errorf("filtering kodata: %w", err)
+		}
+		return replaceLayer(img, i, filtered)
+	})
+}
+
+// filterKodata returns a copy of the kodata layer without the files matching patterns.
+func filterKodata(l v1.Layer, patterns []string) (v1.Layer, error) {
+	rc, err := l.Uncompressed()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	tr := tar.NewReader(rc)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		// ko puts kodata at /var/run/ko on Linux, and Files/var/run/ko on Windows.
+		name := strings.TrimPrefix(strings.TrimPrefix(hdr.Name, "/"), "Files/")
+		if rel, ok := strings.CutPrefix(name, strings.TrimPrefix(kodataRoot, "/")+"/"); ok && hdr.Typeflag != tar.TypeDir && koignored(patterns, rel) {
+			continue
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return nil, err
+		}
+		if _, err := io.Copy(tw, tr); err != nil { //nolint: gosec // The layer was just built by ko from local files.
+			return nil, err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return nil, err
+	}
+
+	mt, err := l.MediaType()
+	if err != nil {
+		return nil, err
+	}
+	b := buf.Bytes()
+	return tarball.LayerFromOpener(func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(b)), nil
+	}, tarball.WithCompressedCaching, tarball.WithMediaType(mt))
+}
+
+// replaceLayer returns img with its i'th layer replaced by l, keeping its config, history and manifest annotations.
+func replaceLayer(img v1.Image, i int, l v1.Layer) (v1.Image, error) {
+	layers, err := img.Layers()
+	if err != nil {
+		return nil, err
+	}
+	m, err := img.Manifest()
+	if err != nil {
+		return nil, err
+	}
+	cf, err := img.ConfigFile()
+	if err != nil {
+		return nil, err
+	}
+	cf = cf.DeepCopy()
+	if cf.RootFS.DiffIDs[i], err = l.DiffID(); err != nil {
+		return nil, err
+	}
+
+	out := mutate.ConfigMediaType(mutate.MediaType(empty.Image, m.MediaType), m.Config.MediaType)
+	adds := make([]mutate.Addendum, len(layers))
+	for j, layer := range layers {
+		if j == i {
+			layer = l
+		}
+		adds[j] = mutate.Addendum{Layer: layer, URLs: m.Layers[j].URLs}
+	}
+	if out, err = mutate.Append(out, adds...); err != nil {
+		return nil, err
+	}
+	if out, err = mutate.ConfigFile(out, cf); err != nil {
+		return nil, err
+	}
+	if len(m.Annotations) > 0 {
+		out = mutate.Annotations(out, m.Annotations).(v1.Image)
+	}
+	return out, nil
+}
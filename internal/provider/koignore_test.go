@@ -0,0 +1,113 @@
+package provider
+
+import (
+	"archive/tar"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/registry"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+)
+
+func TestKoignored(t *testing.T) {
+	patterns := []string{"*.md", "/secret.txt", "tmp/", "docs/*.draft"}
+	for rel, want := range map[string]bool{
+		"index.html":          false,
+		"README.md":           true,
+		"static/README.md":    true,
+		"secret.txt":          true,
+		"static/secret.txt":   false,
+		"tmp/cache":           true,
+		"static/tmp/cache":    true,
+		"tmp":                 false, // tmp/ only matches directories.
+		"docs/a.draft":        true,
+		"static/docs/a.draft": false,
+	} {
+		if got := koignored(patterns, rel); got != want {
+			t.Errorf("koignored(%q) = %t, want %t", rel, got, want)
+		}
+	}
+}
+
+func TestDoBuild_Koignore(t *testing.T) {
+	srv := httptest.NewServer(registry.New())
+	defer srv.Close()
+	parts := strings.Split(srv.URL, ":")
+	url := fmt.Sprintf("localhost:%s/test", parts[len(parts)-1])
+
+	base := pushBaseIndex(t, url+"/base", v1.Platform{OS: "linux", Architecture: "amd64"})
+
+	dir := t.TempDir()
+	write := func(path, content string) {
+		t.Helper()
+		path = filepath.Join(dir, path)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatalf("MkdirAll: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatalf("WriteFile: %v", err)
+		}
+	}
+	write("go.mod", "module example.com/app\n\ngo 1.21\n")
+	write("main.go", "package main\n\nfunc main() {}\n")
+	write("kodata/index.html", "hello")
+	write("kodata/notes.md", "notes")
+	write("kodata/tmp/cache", "cache")
+	write("kodata/.koignore", "# Not served.\n*.md\ntmp/\n")
+	t.Setenv("GOWORK", "off")
+
+	opts := buildOptions{
+		ip:         "example.com/app",
+		workingDir: dir,
+		imageRepo:  url,
+		platforms:  []string{"linux/amd64"},
+		baseImage:  base,
+		sbom:       "none",
+	}
+	res, _, err := doBuild(context.Background(), opts)
+	if err != nil {
+		t.Fatalf("doBuild: %v", err)
+	}
+	img, ok := res.(v1.Image)
+	if !ok {
+		t.Fatalf("expected an image, got %T", res)
+	}
+
+	var got []string
+	tr := tar.NewReader(mutate.Extract(img))
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Next: %v", err)
+		}
+		if rel, ok := strings.CutPrefix(strings.TrimPrefix(hdr.Name, "/"), "var/run/ko/"); ok && hdr.Typeflag == tar.TypeReg {
+			got = append(got, rel)
+		}
+	}
+	if want := []string{"index.html"}; !slices.Equal(got, want) {
+		t.Errorf("expected kodata files %v, got %v", want, got)
+	}
+
+	// The rewritten image is still consistent, so it can be pushed.
+	if _, _, err := doPublish(context.Background(), res, opts); err != nil {
+		t.Fatalf("doPublish: %v", err)
+	}
+
+	// ko's SBOM would describe the image before files were removed.
+	opts.sbom = "spdx"
+	if _, _, err := doBuild(context.Background(), opts); err == nil || !strings.Contains(err.Error(), `requires sbom = "none"`) {
+		t.Errorf("expected an error requiring sbom = \"none\", got %v", err)
+	}
+}
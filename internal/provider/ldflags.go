@@ -0,0 +1,72 @@
+package provider
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+)
+
+// platformTemplateCond returns a Go template condition that holds when ko is building for platform.
+// ko builds every platform with the same build.Config, but templates ldflags with the build's environment,
+// which includes the GOOS, GOARCH and GOARM or GOAMD64 it derived from the platform.
+func platformTemplateCond(platform string) (string, error) {
+	p, err := v1.ParsePlatform(platform)
+	if err != nil {
+		return "", fmt.Errorf("parsing platform %q: %w", platform, err)
+	}
+	if p.OS == "all" || p.OS == "" || p.Architecture == "" {
+		return "", fmt.Errorf("platform %q must be of the form <os>/<arch>[/<variant>]", platform)
+	}
+	conds := []string{
+		fmt.Sprintf(`(eq (index .Env "GOOS") %q)`, p.OS),
+		fmt.Sprintf(`(eq (index .Env "GOARCH") %q)`, p.Architecture),
+	}
+	switch {
+	case p.Variant == "":
+	case p.Architecture == "arm":
+		goarm, err := strconv.Atoi(strings.TrimPrefix(p.Variant, "v"))
+		if err != nil {
+			return "", fmt.Errorf("parsing arm variant of platform %q: %w", platform, err)
+		}
+		if goarm >= 5 { // Like ko, which only sets GOARM for v5 and up, and caps it at 7.
+			conds = append(conds, fmt.Sprintf(`(eq (index .Env "GOARM") "%d")`, min(goarm, 7)))
+		}
+	case p.Architecture == "amd64":
+		conds = append(conds, fmt.Sprintf(`(eq (index .Env "GOAMD64") %q)`, p.Variant))
+	}
+	return "(and " + strings.Join(conds, " ") + ")", nil
+}
+
+// perPlatformLdflags returns ldflags that apply the per-platform ldflags when building for a platform in byPlatform,
+// and the default ldflags when building for any other platform.
+func perPlatformLdflags(defaults []string, byPlatform map[string][]string) ([]string, error) {
+	if len(byPlatform) == 0 {
+		return defaults, nil
+	}
+	platforms := make([]string, 0, len(byPlatform))
+	for p := range byPlatform {
+		platforms = append(platforms, p)
+	}
+	sort.Strings(platforms)
+
+	conds := make([]string, 0, len(platforms))
+	var out []string
+	for _, p := range platforms {
+		cond, err := platformTemplateCond(p)
+		if err != nil {
+			return nil, err
+		}
+		conds = append(conds, cond)
+		for _, f := range byPlatform[p] {
+			out = append(out, "{{if "+cond+"}}"+f+"{{end}}")
+		}
+	}
+	other := "(not (or " + strings.Join(conds, " ") + "))"
+	for _, f := range defaults {
+		out = append(out, "{{if "+other+"}}"+f+"{{end}}")
+	}
+	return out, nil
+}
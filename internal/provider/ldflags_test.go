@@ -0,0 +1,108 @@
+package provider
+
+import (
+	"bytes"
+	"context"
+	"debug/elf"
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"text/template"
+
+	"github.com/google/go-containerregistry/pkg/registry"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+)
+
+func TestPerPlatformLdflags(t *testing.T) {
+	ldflags, err := perPlatformLdflags([]string{"-s"}, map[string][]string{
+		"linux/arm64":  {"-w", "-X main.arch=arm64"},
+		"linux/arm/v7": {"-X main.arch=armv7"},
+	})
+	if err != nil {
+		t.Fatalf("perPlatformLdflags: %v", err)
+	}
+
+	// Render the ldflags the way ko does, with the environment ko builds each platform with.
+	render := func(env map[string]string) string {
+		var out []string
+		for _, f := range ldflags {
+			var buf bytes.Buffer
+			if err := template.Must(template.New("").Option("missingkey=error").Parse(f)).Execute(&buf, map[string]interface{}{"Env": env}); err != nil {
+				t.Fatalf("executing %q: %v", f, err)
+			}
+			out = append(out, buf.String())
+		}
+		return strings.Join(strings.Fields(strings.Join(out, " ")), " ")
+	}
+	for _, tc := range []struct {
+		env  map[string]string
+		want string
+	}{
+		{map[string]string{"GOOS": "linux", "GOARCH": "amd64"}, "-s"},
+		{map[string]string{"GOOS": "linux", "GOARCH": "arm64"}, "-w -X main.arch=arm64"},
+		{map[string]string{"GOOS": "linux", "GOARCH": "arm", "GOARM": "7"}, "-X main.arch=armv7"},
+		{map[string]string{"GOOS": "linux", "GOARCH": "arm", "GOARM": "6"}, "-s"},
+		{map[string]string{"GOOS": "windows", "GOARCH": "arm64"}, "-s"},
+	} {
+		if got := render(tc.env); got != tc.want {
+			t.Errorf("ldflags for %v = %q, want %q", tc.env, got, tc.want)
+		}
+	}
+
+	if _, err := perPlatformLdflags(nil, map[string][]string{"all": {"-s"}}); err == nil {
+		t.Error(`expected error for platform "all"`)
+	}
+}
+
+func TestDoBuild_PlatformLdflags(t *testing.T) {
+	// Setup a local registry to serve the base image.
+	srv := httptest.NewServer(registry.New())
+	defer srv.Close()
+	parts := strings.Split(srv.URL, ":")
+	url := fmt.Sprintf("localhost:%s/test", parts[len(parts)-1])
+	base := pushBaseIndex(t, url+"/base",
+		v1.Platform{OS: "linux", Architecture: "amd64"},
+		v1.Platform{OS: "linux", Architecture: "arm64"},
+	)
+
+	res, _, err := doBuild(context.Background(), buildOptions{
+		ip:              "github.com/ko-build/terraform-provider-ko/cmd/test",
+		workingDir:      ".",
+		imageRepo:       url,
+		platforms:       []string{"linux/amd64", "linux/arm64"},
+		baseImage:       base,
+		sbom:            "none",
+		ldflags:         []string{"-s"},
+		platformLdflags: map[string][]string{"linux/arm64": {"-w"}},
+	})
+	if err != nil {
+		t.Fatalf("doBuild: %v", err)
+	}
+	idx := res.(v1.ImageIndex)
+	digests, err := platformDigests(res)
+	if err != nil {
+		t.Fatalf("platformDigests: %v", err)
+	}
+	// -s strips the symbol table, and -w only strips DWARF.
+	for platform, wantSymtab := range map[string]bool{"linux/amd64": false, "linux/arm64": true} {
+		img, err := idx.Image(digests[platform])
+		if err != nil {
+			t.Fatalf("Image: %v", err)
+		}
+		b, err := binaryOf(img)
+		if err != nil {
+			t.Fatalf("binaryOf: %v", err)
+		}
+		f, err := elf.NewFile(bytes.NewReader(b))
+		if err != nil {
+			t.Fatalf("elf.NewFile: %v", err)
+		}
+		if got := f.Section(".symtab") != nil; got != wantSymtab {
+			t.Errorf("expected symbol table %t for %s, got %t", wantSymtab, platform, got)
+		}
+		if f.Section(".debug_info") != nil {
+			t.Errorf("expected no DWARF for %s", platform)
+		}
+	}
+}
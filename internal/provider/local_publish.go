@@ -0,0 +1,72 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/ko/pkg/build"
+	"github.com/google/ko/pkg/publish"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+)
+
+// isLocalPublish reports whether the image is published somewhere other than the registry.
+func (o *buildOptions) isLocalPublish() bool {
+	return o.publishMode != "" && o.publishMode != "registry"
+}
+
+// publishLocal publishes the built image somewhere other than the registry, according to opts.publishMode:
+// it loads it into the local Docker daemon, or writes it to a tarball at opts.tarballPath that `docker load` can read.
+// It returns the reference the daemon loaded the image as, or ref for a tarball, whose images are named for the registry.
+func publishLocal(ctx context.Context, res build.Result, ref string, opts buildOptions) (string, error) {
+	tags := opts.tags
+	if len(tags) == 0 {
+		tags = []string{"latest"} // ko's default tag.
+	}
+	switch opts.publishMode {
+	case "daemon":
+		p, err := publish.NewDaemon(namer(opts), tags)
+		if err != nil {
+			return "", fmt.Errorf("NewDaemon: %w", err)
+		}
+		local, err := p.Publish(ctx, res, opts.ip)
+		if err != nil {
+			return "", fmt.Errorf("loading into the Docker daemon: %w", err)
+		}
+		return local.String(), nil
+	case "tarball":
+		if _, ok := res.(v1.ImageIndex); ok {
+			return "", errors.New(`publish_mode = "tarball" can only save a single-platform image; set a single entry in platforms`)
+		}
+		p := publish.NewTarball(opts.tarballPath, opts.imageRepo, namer(opts), tags)
+		if _, err := p.Publish(ctx, res, opts.ip); err != nil {
+			return "", fmt.Errorf("publish: %w", err)
+		}
+		if err := p.Close(); err != nil {
+			return "", fmt.Errorf("writing %s: %w", opts.tarballPath, err)
+		}
+		return ref, nil
+	default:
+		return "", fmt.Errorf("unknown publish_mode %q", opts.publishMode)
+	}
+}
+
+// validatePublishMode is a CustomizeDiffFunc that checks `tarball_path` is set exactly when publishing to a tarball,
+// and rejects the options that don't publish anywhere along with a local publish_mode.
+func validatePublishMode(_ context.Context, d *schema.ResourceDiff, _ interface{}) error {
+	mode := d.Get("publish_mode").(string)
+	switch {
+	case mode == "tarball" && d.NewValueKnown("tarball_path") && d.Get("tarball_path").(string) == "":
+		return errors.New(`publish_mode = "tarball" requires tarball_path`)
+	case mode != "tarball" && d.Get("tarball_path").(string) != "":
+		return errors.New(`tarball_path requires publish_mode = "tarball"`)
+	case mode == "registry":
+		return nil
+	case d.NewValueKnown("push") && !d.Get("push").(bool):
+		return fmt.Errorf("publish_mode = %q can't be set when push = false, since the image isn't published anywhere", mode)
+	case d.Get("oci_layout_dir").(string) != "":
+		return fmt.Errorf("publish_mode = %q can't be set with oci_layout_dir, which saves the image instead of publishing it", mode)
+	}
+	return nil
+}
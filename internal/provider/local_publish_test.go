@@ -0,0 +1,167 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"net/http/httptest"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/crane"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/tarball"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/resource"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/terraform"
+)
+
+func TestPublishLocal_Tarball(t *testing.T) {
+	// Setup a local registry to serve the base image.
+	srv := httptest.NewServer(registry.New())
+	defer srv.Close()
+	parts := strings.Split(srv.URL, ":")
+	url := fmt.Sprintf("localhost:%s/test", parts[len(parts)-1])
+	base := pushBaseIndex(t, url+"/base", v1.Platform{OS: "linux", Architecture: "amd64"})
+
+	for _, tags := range [][]string{nil, {"v1", "stable"}} {
+		t.Run(fmt.Sprintf("tags=%v", tags), func(t *testing.T) {
+			opts := buildOptions{
+				ip:          "github.com/ko-build/terraform-provider-ko/cmd/test",
+				workingDir:  ".",
+				imageRepo:   url,
+				platforms:   []string{"linux/amd64"},
+				baseImage:   base,
+				sbom:        "none",
+				tags:        tags,
+				publishMode: "tarball",
+				tarballPath: filepath.Join(t.TempDir(), "image.tar"),
+			}
+			res, ref, err := doBuild(context.Background(), opts)
+			if err != nil {
+				t.Fatalf("doBuild: %v", err)
+			}
+			got, err := publishLocal(context.Background(), res, ref, opts)
+			if err != nil {
+				t.Fatalf("publishLocal: %v", err)
+			}
+			if got != ref {
+				t.Errorf("publishLocal returned %q, want the registry reference %q", got, ref)
+			}
+
+			wantTags := tags
+			if len(wantTags) == 0 {
+				wantTags = []string{"latest"}
+			}
+			want, err := res.(v1.Image).ConfigName()
+			if err != nil {
+				t.Fatalf("ConfigName: %v", err)
+			}
+			dig, err := name.NewDigest(ref)
+			if err != nil {
+				t.Fatalf("NewDigest: %v", err)
+			}
+			for _, tag := range wantTags {
+				tagRef := dig.Context().Tag(tag)
+				img, err := tarball.ImageFromPath(opts.tarballPath, &tagRef)
+				if err != nil {
+					t.Fatalf("reading %s from tarball: %v", tagRef, err)
+				}
+				// Tarballs don't keep the manifest, but the config, and so the image ID, is the same.
+				if got, err := img.ConfigName(); err != nil {
+					t.Fatalf("ConfigName: %v", err)
+				} else if got != want {
+					t.Errorf("tarball image %s has config %s, want %s", tagRef, got, want)
+				}
+			}
+
+			// Nothing was pushed to the registry.
+			if _, err := crane.Head(ref); err == nil {
+				t.Errorf("expected %s not to be pushed", ref)
+			}
+		})
+	}
+}
+
+func TestPublishLocal_TarballIndex(t *testing.T) {
+	srv := httptest.NewServer(registry.New())
+	defer srv.Close()
+	parts := strings.Split(srv.URL, ":")
+	url := fmt.Sprintf("localhost:%s/test", parts[len(parts)-1])
+	base := pushBaseIndex(t, url+"/base",
+		v1.Platform{OS: "linux", Architecture: "amd64"},
+		v1.Platform{OS: "linux", Architecture: "arm64"},
+	)
+
+	opts := buildOptions{
+		ip:          "github.com/ko-build/terraform-provider-ko/cmd/test",
+		workingDir:  ".",
+		imageRepo:   url,
+		platforms:   []string{"linux/amd64", "linux/arm64"},
+		baseImage:   base,
+		sbom:        "none",
+		publishMode: "tarball",
+		tarballPath: filepath.Join(t.TempDir(), "image.tar"),
+	}
+	res, ref, err := doBuild(context.Background(), opts)
+	if err != nil {
+		t.Fatalf("doBuild: %v", err)
+	}
+	if _, err := publishLocal(context.Background(), res, ref, opts); err == nil || !strings.Contains(err.Error(), "single-platform") {
+		t.Errorf("expected an error saving a multi-platform image to a tarball, got %v", err)
+	}
+}
+
+func TestAccResourceKoBuild_PublishTarball(t *testing.T) {
+	// Setup a local registry and have tests push to that.
+	srv := httptest.NewServer(registry.New())
+	defer srv.Close()
+	parts := strings.Split(srv.URL, ":")
+	url := fmt.Sprintf("localhost:%s/test", parts[len(parts)-1])
+	t.Setenv("KO_DOCKER_REPO", url)
+	base := pushBaseIndex(t, url+"/base", v1.Platform{OS: "linux", Architecture: "amd64"})
+	path := filepath.Join(t.TempDir(), "image.tar")
+
+	resource.Test(t, resource.TestCase{
+		ProviderFactories: providerFactories,
+		Steps: []resource.TestStep{{
+			Config: fmt.Sprintf(`
+			resource "ko_build" "foo" {
+			  importpath   = "github.com/ko-build/terraform-provider-ko/cmd/test"
+			  base_image   = %q
+			  sbom         = "none"
+			  publish_mode = "tarball"
+			}
+			`, base),
+			ExpectError: regexp.MustCompile(`requires tarball_path`),
+		}, {
+			Config: fmt.Sprintf(`
+			resource "ko_build" "foo" {
+			  importpath   = "github.com/ko-build/terraform-provider-ko/cmd/test"
+			  base_image   = %q
+			  sbom         = "none"
+			  publish_mode = "tarball"
+			  tarball_path = %q
+			}
+			`, base, path),
+			Check: resource.ComposeTestCheckFunc(
+				resource.TestMatchResourceAttr("ko_build.foo", "image_ref", regexp.MustCompile("^"+url+"/github.com/ko-build/terraform-provider-ko/cmd/test@sha256:")),
+				func(s *terraform.State) error {
+					ref := s.RootModule().Resources["ko_build.foo"].Primary.Attributes["image_ref"]
+					if _, err := crane.Head(ref); err == nil {
+						return fmt.Errorf("expected %s not to be pushed", ref)
+					}
+					dig, err := name.NewDigest(ref)
+					if err != nil {
+						return err
+					}
+					tag := dig.Context().Tag("latest")
+					_, err = tarball.ImageFromPath(path, &tag)
+					return err
+				},
+			),
+		}},
+	})
+}
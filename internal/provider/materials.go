@@ -0,0 +1,56 @@
+package provider
+
+import (
+	"runtime/debug"
+
+	"github.com/google/ko/pkg/build"
+)
+
+// materialsOf returns the inputs res was built from, in the shape of the materials attribute:
+// the base image, the version control revision of the source if the toolchain recorded one and the
+// source had no uncommitted changes, and the Go toolchain.
+func materialsOf(res build.Result, info *debug.BuildInfo) ([]interface{}, error) {
+	var materials []interface{}
+	base, dig, err := baseAnnotationsOf(res)
+	if err != nil {
+		return nil, err
+	}
+	if base != "" {
+		materials = append(materials, map[string]interface{}{
+			"type":   "base_image",
+			"uri":    base,
+			"digest": dig,
+		})
+	}
+
+	settings := map[string]string{}
+	for _, s := range info.Settings {
+		settings[s.Key] = s.Value
+	}
+	if vcs, rev := settings["vcs"], settings["vcs.revision"]; vcs != "" && rev != "" && settings["vcs.modified"] != "true" {
+		materials = append(materials, map[string]interface{}{
+			"type":   "source",
+			"uri":    vcs + "+" + info.Main.Path,
+			"digest": revisionDigest(rev),
+		})
+	}
+
+	materials = append(materials, map[string]interface{}{
+		"type":   "toolchain",
+		"uri":    info.GoVersion,
+		"digest": "",
+	})
+	return materials, nil
+}
+
+// revisionDigest returns a version control revision in algorithm:hex form, like an image digest.
+// Git uses SHA-1 revisions, or SHA-256 for repositories using the newer object format.
+func revisionDigest(rev string) string {
+	if len(rev) == 64 {
+		return "sha256:" + rev
+	}
+	if len(rev) == 40 {
+		return "sha1:" + rev
+	}
+	return rev
+}
@@ -0,0 +1,57 @@
+package provider
+
+import (
+	"reflect"
+	"runtime/debug"
+	"testing"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	specsv1 "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+func TestMaterialsOf(t *testing.T) {
+	img, err := random.Image(1024, 1)
+	if err != nil {
+		t.Fatalf("random.Image: %v", err)
+	}
+	const baseDigest = "sha256:1111111111111111111111111111111111111111111111111111111111111111"
+	img = mutate.Annotations(img, map[string]string{
+		specsv1.AnnotationBaseImageName:   "example.com/base:latest",
+		specsv1.AnnotationBaseImageDigest: baseDigest,
+	}).(v1.Image)
+	const rev = "0123456789abcdef0123456789abcdef01234567"
+
+	base := map[string]interface{}{"type": "base_image", "uri": "example.com/base:latest", "digest": baseDigest}
+	source := map[string]interface{}{"type": "source", "uri": "git+example.com/app", "digest": "sha1:" + rev}
+	toolchain := map[string]interface{}{"type": "toolchain", "uri": "go1.23.4", "digest": ""}
+	for _, tc := range []struct {
+		desc     string
+		settings []debug.BuildSetting
+		want     []interface{}
+	}{{
+		desc:     "clean checkout",
+		settings: []debug.BuildSetting{{Key: "vcs", Value: "git"}, {Key: "vcs.revision", Value: rev}, {Key: "vcs.modified", Value: "false"}},
+		want:     []interface{}{base, source, toolchain},
+	}, {
+		// The revision doesn't describe the source that was built.
+		desc:     "uncommitted changes",
+		settings: []debug.BuildSetting{{Key: "vcs", Value: "git"}, {Key: "vcs.revision", Value: rev}, {Key: "vcs.modified", Value: "true"}},
+		want:     []interface{}{base, toolchain},
+	}, {
+		desc: "no version control",
+		want: []interface{}{base, toolchain},
+	}} {
+		t.Run(tc.desc, func(t *testing.T) {
+			info := &debug.BuildInfo{GoVersion: "go1.23.4", Main: debug.Module{Path: "example.com/app"}, Settings: tc.settings}
+			got, err := materialsOf(img, info)
+			if err != nil {
+				t.Fatalf("materialsOf: %v", err)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("expected materials %v, got %v", tc.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,109 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/ko/pkg/build"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+)
+
+// mapImages returns res with f applied to the image, or to each image of the index, keeping the index's
+// media type, annotations and descriptors. Attachments such as ko's SBOMs are not carried over.
+func mapImages(res build.Result, f func(v1.Image) (v1.Image, error)) (build.Result, error) {
+	switch r := res.(type) {
+	case v1.ImageIndex:
+		im, err := r.IndexManifest()
+		if err != nil {
+			return nil, err
+		}
+		mt, err := r.MediaType()
+		if err != nil {
+			return nil, err
+		}
+		adds := make([]mutate.IndexAddendum, 0, len(im.Manifests))
+		for _, desc := range im.Manifests {
+			img, err := r.Image(desc.Digest)
+			if err != nil {
+				return nil, fmt.Errorf("reading image %s: %w", desc.Digest, err)
+			}
+			if img, err = f(img); err != nil {
+				return nil, err
+			}
+			adds = append(adds, mutate.IndexAddendum{
+				Add: img,
+				Descriptor: v1.Descriptor{
+					URLs:        desc.URLs,
+					MediaType:   desc.MediaType,
+					Annotations: desc.Annotations,
+					Platform:    desc.Platform,
+				},
+			})
+		}
+		idx := mutate.IndexMediaType(empty.Index, mt)
+		if len(im.Annotations) > 0 {
+			idx = mutate.Annotations(idx, im.Annotations).(v1.ImageIndex)
+		}
+		return mutate.AppendManifests(idx, adds...), nil
+	case v1.Image:
+		return f(r)
+	default:
+		return nil, fmt.Errorf("unexpected build result %T", res)
+	}
+}
+
+// mutateConfig returns img with f applied to a copy of its config.
+func mutateConfig(img v1.Image, f func(*v1.Config)) (v1.Image, error) {
+	cf, err := img.ConfigFile()
+	if err != nil {
+		return nil, err
+	}
+	cf = cf.DeepCopy()
+	f(&cf.Config)
+	return mutate.ConfigFile(img, cf)
+}
+
+// sbomIncompatible are the attributes that change the image after ko builds it, which ko's SBOMs,
+// referring to the digest of the image ko built, wouldn't describe.
+var sbomIncompatible = []string{
+	"entrypoint_prefix",
+	"entrypoint",
+	"args",
+	"stop_signal",
+	"ports",
+	"image_env",
+	"arch_override",
+	"compat_docker_media_types",
+}
+
+// validateSBOMCompatible is a CustomizeDiffFunc that rejects any of sbomIncompatible unless SBOMs are disabled.
+func validateSBOMCompatible(_ context.Context, d *schema.ResourceDiff, _ interface{}) error {
+	if !d.NewValueKnown("sbom") || d.Get("sbom").(string) == "none" {
+		return nil
+	}
+	for _, k := range sbomIncompatible {
+		var set bool
+		switch v := d.Get(k).(type) {
+		case bool:
+			set = v
+		case string:
+			set = v != ""
+		case []interface{}:
+			set = len(v) > 0
+		case map[string]interface{}:
+			set = len(v) > 0
+		}
+		if set {
+			return errSBOMIncompatible(k)
+		}
+	}
+	return nil
+}
+
+// errSBOMIncompatible is the error for what changing the image after the build while SBOMs are enabled.
+func errSBOMIncompatible(what string) error {
+	return fmt.Errorf(`%s requires sbom = "none", since the SBOM would describe the image before it's changed`, what)
+}
@@ -0,0 +1,44 @@
+package provider
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/terraform"
+)
+
+func TestValidateSBOMCompatible(t *testing.T) {
+	// Each attribute that changes the image after it's built is rejected unless SBOMs are disabled, and says so.
+	values := map[string]interface{}{
+		"entrypoint_prefix":         []interface{}{"/tini", "--"},
+		"entrypoint":                []interface{}{"/ko-app/test", "-v"},
+		"args":                      []interface{}{"-v"},
+		"stop_signal":               "SIGINT",
+		"ports":                     []interface{}{"8080"},
+		"image_env":                 map[string]interface{}{"FOO": "bar"},
+		"arch_override":             "arm64",
+		"compat_docker_media_types": true,
+	}
+	r := resourceBuild()
+	for _, k := range sbomIncompatible {
+		t.Run(k, func(t *testing.T) {
+			if !strings.Contains(r.Schema[k].Description, "`sbom` to be `none`") {
+				t.Errorf("expected the description of %s to say it requires sbom to be none, got %q", k, r.Schema[k].Description)
+			}
+			for _, sbom := range []string{"spdx", "none"} {
+				config := terraform.NewResourceConfigRaw(map[string]interface{}{
+					"importpath": "github.com/ko-build/terraform-provider-ko/cmd/test",
+					"sbom":       sbom,
+					k:            values[k],
+				})
+				_, err := r.Diff(context.Background(), nil, config, nil)
+				if sbom == "none" && err != nil {
+					t.Errorf("expected %s to be allowed with sbom = %q, got %v", k, sbom, err)
+				} else if sbom != "none" && (err == nil || !strings.Contains(err.Error(), k+` requires sbom = "none"`)) {
+					t.Errorf("expected %s to be rejected with sbom = %q, got %v", k, sbom, err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,35 @@
+package provider
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+)
+
+// knownOS and knownArch are the GOOS and GOARCH values Go can build for, as listed by `go tool dist list`.
+var (
+	knownOS   = []string{"aix", "android", "darwin", "dragonfly", "freebsd", "illumos", "ios", "js", "linux", "netbsd", "openbsd", "plan9", "solaris", "wasip1", "windows"}
+	knownArch = []string{"386", "amd64", "arm", "arm64", "loong64", "mips", "mips64", "mips64le", "mipsle", "ppc64", "ppc64le", "riscv64", "s390x", "wasm"}
+)
+
+// checkPlatform returns an error if p isn't "all" or a platform of the form `<os>/<arch>[/<variant>][:<osversion>]`
+// for an os and arch that Go can build for, so that a typo is reported when planning rather than by ko during the build.
+func checkPlatform(p string) error {
+	if p == "all" {
+		return nil
+	}
+	pl, err := v1.ParsePlatform(p)
+	if err != nil || pl.OS == "" || pl.Architecture == "" || strings.HasSuffix(p, "/") ||
+		strings.TrimSpace(p) != p || strings.Count(p, ":") > 1 {
+		return fmt.Errorf("platform should be \"all\" or <os>/<arch>[/<variant>], got %q", p)
+	}
+	if !slices.Contains(knownOS, pl.OS) {
+		return fmt.Errorf("unknown os %q in platform %q, should be one of %s", pl.OS, p, strings.Join(knownOS, ", "))
+	}
+	if !slices.Contains(knownArch, pl.Architecture) {
+		return fmt.Errorf("unknown arch %q in platform %q, should be one of %s", pl.Architecture, p, strings.Join(knownArch, ", "))
+	}
+	return nil
+}
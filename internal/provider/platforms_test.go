@@ -0,0 +1,58 @@
+package provider
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+)
+
+func TestCheckPlatform(t *testing.T) {
+	for _, c := range []struct {
+		platform string
+		wantErr  string
+	}{
+		{platform: "all"},
+		{platform: "linux/amd64"},
+		{platform: "linux/arm/v7"},
+		{platform: "linux/arm64/v8"},
+		{platform: "windows/amd64:10.0.17763.1234"},
+		{platform: "linux/amd4", wantErr: `unknown arch "amd4"`},
+		{platform: "linx/amd64", wantErr: `unknown os "linx"`},
+		{platform: "windows", wantErr: "should be"},
+		{platform: "linux/", wantErr: "should be"},
+		{platform: "/amd64", wantErr: "should be"},
+		{platform: "linux/arm/v7/", wantErr: "should be"},
+		{platform: "linux/arm/v7/extra", wantErr: "should be"},
+		{platform: "linux/amd64,linux/arm64", wantErr: "unknown arch"},
+		{platform: " linux/amd64", wantErr: "should be"},
+		{platform: "ALL", wantErr: "should be"},
+		{platform: "", wantErr: "should be"},
+	} {
+		err := checkPlatform(c.platform)
+		if c.wantErr == "" {
+			if err != nil {
+				t.Errorf("checkPlatform(%q) = %v, want nil", c.platform, err)
+			}
+		} else if err == nil || !strings.Contains(err.Error(), c.wantErr) {
+			t.Errorf("checkPlatform(%q) = %v, want error containing %q", c.platform, err, c.wantErr)
+		}
+	}
+}
+
+func TestPlatformsValidation(t *testing.T) {
+	// Each resource or data source with platforms rejects a malformed entry when validating its config.
+	for name, s := range map[string]*schema.Resource{
+		"ko_build resource":    resourceBuild(),
+		"ko_build data source": dataSourceBuild(),
+		"ko_base_cache":        resourceBaseCache(),
+	} {
+		elem := s.Schema["platforms"].Elem.(*schema.Schema)
+		if diags := elem.ValidateDiagFunc("linux/arm64", nil); diags.HasError() {
+			t.Errorf("%s: expected linux/arm64 to be valid, got %v", name, diags)
+		}
+		if diags := elem.ValidateDiagFunc("linux/amd4", nil); !diags.HasError() {
+			t.Errorf("%s: expected linux/amd4 to be invalid", name)
+		}
+	}
+}
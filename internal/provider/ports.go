@@ -0,0 +1,51 @@
+package provider
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/ko/pkg/build"
+)
+
+// exposedPort returns port in the form used for the keys of the image config's ExposedPorts, `<port>/<protocol>`,
+// with the protocol defaulting to tcp.
+func exposedPort(port string) (string, error) {
+	num, proto, found := strings.Cut(port, "/")
+	if !found {
+		proto = "tcp"
+	}
+	if n, err := strconv.ParseUint(num, 10, 16); err != nil || n == 0 {
+		return "", fmt.Errorf("port should be a number from 1 to 65535, got %q", num)
+	}
+	switch proto {
+	case "tcp", "udp", "sctp":
+	default:
+		return "", fmt.Errorf("protocol should be one of tcp, udp or sctp, got %q", proto)
+	}
+	return num + "/" + proto, nil
+}
+
+// withExposedPorts returns the built image or index with ports added to ExposedPorts in the config of each of its images,
+// along with those ko kept from the base image's config.
+func withExposedPorts(res build.Result, ports []string) (build.Result, error) {
+	exposed := make(map[string]struct{}, len(ports))
+	for _, p := range ports {
+		ep, err := exposedPort(p)
+		if err != nil {
+			return nil, err
+		}
+		exposed[ep] = struct{}{}
+	}
+	return mapImages(res, func(img v1.Image) (v1.Image, error) {
+		return mutateConfig(img, func(c *v1.Config) {
+			if c.ExposedPorts == nil {
+				c.ExposedPorts = make(map[string]struct{}, len(exposed))
+			}
+			for ep := range exposed {
+				c.ExposedPorts[ep] = struct{}{}
+			}
+		})
+	})
+}
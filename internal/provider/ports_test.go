@@ -0,0 +1,124 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+)
+
+func TestDoBuild_UserAndPorts(t *testing.T) {
+	// Setup a local registry and have tests push to that.
+	srv := httptest.NewServer(registry.New())
+	defer srv.Close()
+	parts := strings.Split(srv.URL, ":")
+	url := fmt.Sprintf("localhost:%s/test", parts[len(parts)-1])
+
+	base := pushBaseIndex(t, url+"/base",
+		v1.Platform{OS: "linux", Architecture: "amd64"},
+		v1.Platform{OS: "linux", Architecture: "arm64"},
+	)
+
+	for _, platforms := range [][]string{{"linux/amd64"}, {"linux/amd64", "linux/arm64"}} {
+		t.Run(strings.Join(platforms, ","), func(t *testing.T) {
+			opts := buildOptions{
+				ip:         "github.com/ko-build/terraform-provider-ko/cmd/test",
+				workingDir: ".",
+				imageRepo:  url,
+				platforms:  platforms,
+				baseImage:  base,
+				sbom:       "none",
+				user:       "0:0",
+				ports:      []string{"8080", "53/udp"},
+			}
+			res, _, err := doBuild(context.Background(), opts)
+			if err != nil {
+				t.Fatalf("doBuild: %v", err)
+			}
+			ref, _, err := doPublish(context.Background(), res, opts)
+			if err != nil {
+				t.Fatalf("doPublish: %v", err)
+			}
+
+			// Read the configs back from the registry.
+			r, err := name.ParseReference(ref)
+			if err != nil {
+				t.Fatalf("ParseReference: %v", err)
+			}
+			desc, err := remote.Get(r)
+			if err != nil {
+				t.Fatalf("remote.Get: %v", err)
+			}
+			var imgs []v1.Image
+			if desc.MediaType.IsIndex() {
+				idx, err := desc.ImageIndex()
+				if err != nil {
+					t.Fatalf("ImageIndex: %v", err)
+				}
+				im, err := idx.IndexManifest()
+				if err != nil {
+					t.Fatalf("IndexManifest: %v", err)
+				}
+				for _, m := range im.Manifests {
+					img, err := idx.Image(m.Digest)
+					if err != nil {
+						t.Fatalf("Image: %v", err)
+					}
+					imgs = append(imgs, img)
+				}
+			} else {
+				img, err := desc.Image()
+				if err != nil {
+					t.Fatalf("Image: %v", err)
+				}
+				imgs = append(imgs, img)
+			}
+			if len(imgs) != len(platforms) {
+				t.Fatalf("expected %d images, got %d", len(platforms), len(imgs))
+			}
+			for _, img := range imgs {
+				cf, err := img.ConfigFile()
+				if err != nil {
+					t.Fatalf("ConfigFile: %v", err)
+				}
+				if cf.Config.User != "0:0" {
+					t.Errorf("expected User %q for %s/%s, got %q", "0:0", cf.OS, cf.Architecture, cf.Config.User)
+				}
+				want := map[string]struct{}{"8080/tcp": {}, "53/udp": {}}
+				if !maps.Equal(cf.Config.ExposedPorts, want) {
+					t.Errorf("expected ExposedPorts %v for %s/%s, got %v", want, cf.OS, cf.Architecture, cf.Config.ExposedPorts)
+				}
+			}
+		})
+	}
+}
+
+func TestExposedPort(t *testing.T) {
+	for _, c := range []struct {
+		port, want string
+		wantErr    bool
+	}{
+		{port: "8080", want: "8080/tcp"},
+		{port: "53/udp", want: "53/udp"},
+		{port: "9000/sctp", want: "9000/sctp"},
+		{port: "0", wantErr: true},
+		{port: "65536", wantErr: true},
+		{port: "http", wantErr: true},
+		{port: "8080/icmp", wantErr: true},
+		{port: "", wantErr: true},
+	} {
+		got, err := exposedPort(c.port)
+		if (err != nil) != c.wantErr {
+			t.Errorf("exposedPort(%q) error = %v, wantErr %t", c.port, err, c.wantErr)
+		} else if got != c.want {
+			t.Errorf("exposedPort(%q) = %q, want %q", c.port, got, c.want)
+		}
+	}
+}
@@ -3,10 +3,17 @@ package provider
 import (
 	"context"
 	"fmt"
+	"net/http"
+	"os"
 	"strings"
+	"text/template"
+	"time"
 
 	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
 	"github.com/google/ko/pkg/commands/options"
+	"github.com/hashicorp/go-cty/cty"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
 )
@@ -32,26 +39,240 @@ func New(version string) func() *schema.Provider {
 		p := &schema.Provider{
 			Schema: map[string]*schema.Schema{
 				"repo": {
-					Description: "Container repository to publish images to. Defaults to `KO_DOCKER_REPO` env var",
+					Description: "Container repository to publish images to. Defaults to the first set env var in `repo_env`, or else `KO_DOCKER_REPO` env var",
 					Optional:    true,
 					DefaultFunc: schema.EnvDefaultFunc("KO_DOCKER_REPO", ""),
 					Type:        schema.TypeString,
 				},
+				"repo_env": {
+					Description: "Names of env vars to read the container repository from, in order, when `repo` isn't set. The first one that is set is used, for example `[\"KO_DOCKER_REPO_PROD\", \"KO_DOCKER_REPO\"]`. If none are set, `KO_DOCKER_REPO` is used.",
+					Optional:    true,
+					Type:        schema.TypeList,
+					Elem:        &schema.Schema{Type: schema.TypeString},
+				},
+				"repo_template": {
+					Description: "Go template used to compute the container repository to publish each image to, instead of appending the importpath to `repo`. " +
+						"The template can reference `.Repo` (the provider's `repo`), `.ImportPath`, `.Basename` (the last element of the importpath) and `.Module` (the Go module containing the importpath), " +
+						"for example `{{.Repo}}/{{.Basename}}`. The image name will be exactly the result of the template. A `ko_build` resource's `repo` takes precedence over this.",
+					Optional: true,
+					Default:  "",
+					Type:     schema.TypeString,
+				},
 				"basic_auth": {
 					Description: "Basic auth to use to authorize requests",
 					Optional:    true,
 					Default:     "",
 					Type:        schema.TypeString,
 				},
+				"basic_auth_env": {
+					Description:   "Name of an environment variable to read basic auth from when the provider is configured, so the credential doesn't appear in the configuration or state. The variable may contain either `user:password` or a registry token.",
+					Optional:      true,
+					Default:       "",
+					Type:          schema.TypeString,
+					ConflictsWith: []string{"basic_auth"},
+				},
+				"bearer_token": {
+					Description:   "Registry token to send as `Authorization: Bearer <token>`, such as a short-lived CI token, instead of a `basic_auth` username and password.",
+					Optional:      true,
+					Sensitive:     true,
+					Default:       "",
+					Type:          schema.TypeString,
+					ConflictsWith: []string{"basic_auth", "basic_auth_env"},
+				},
+				"ca_cert": {
+					Description: "PEM-encoded CA certificates, or the path to a file containing them, to trust in addition to the system's when connecting to registries. Use this for registries with certificates signed by a private CA.",
+					Optional:    true,
+					Default:     "",
+					Type:        schema.TypeString,
+				},
+				"client_cert": {
+					Description:  "PEM-encoded client certificate, or the path to a file containing it, to present to registries that require mutual TLS. Requires `client_key`.",
+					Optional:     true,
+					Default:      "",
+					Type:         schema.TypeString,
+					RequiredWith: []string{"client_key"},
+				},
+				"client_key": {
+					Description:  "PEM-encoded private key of `client_cert`, or the path to a file containing it. Requires `client_cert`.",
+					Optional:     true,
+					Sensitive:    true,
+					Default:      "",
+					Type:         schema.TypeString,
+					RequiredWith: []string{"client_cert"},
+				},
+				"docker_config_dir": {
+					Description: "Directory containing a docker `config.json` to read registry credentials from, like `DOCKER_CONFIG` for the docker CLI, ahead of the default keychains. Credential helpers and stores configured in it are used too. Use this in shared CI runners to use per-run credentials without changing the global docker config.",
+					Optional:    true,
+					Default:     "",
+					Type:        schema.TypeString,
+				},
+				"keychains": {
+					Description: "Which keychains to look up registry credentials in, in order, from `default` (the docker config file and credential helpers), `ecr`, `google`, `github` and `azure`. Defaults to all of them in that order. Leave out cloud helpers that make slow or failing metadata calls in environments that don't use their registries, or set `[\"default\"]` or `[]` for air-gapped setups. The provider's `docker_config_json`, `docker_config_dir`, `basic_auth` and `bearer_token` are always used ahead of these.",
+					Optional:    true,
+					Type:        schema.TypeList,
+					Elem: &schema.Schema{
+						Type: schema.TypeString,
+						ValidateDiagFunc: func(data interface{}, _ cty.Path) diag.Diagnostics {
+							if _, err := keychainsByName([]string{data.(string)}); err != nil {
+								return diag.FromErr(err)
+							}
+							return nil
+						},
+					},
+				},
+				"docker_config_json": {
+					Description: "Registry credentials in the docker config file format, either as JSON or base64-encoded JSON, like the `.dockerconfigjson` of a Kubernetes image pull secret. These are used ahead of the default and cloud provider credentials.",
+					Optional:    true,
+					Sensitive:   true,
+					Default:     "",
+					Type:        schema.TypeString,
+				},
 				"base_image": {
-					Description: "Default base image for builds",
+					Description: "Default base image for `ko_build` resources and data sources that don't set their own `base_image`. If unset, ko's default base image is used.",
 					Optional:    true,
 					Default:     "",
 					Type:        schema.TypeString,
 				},
+				"ldflags": {
+					Description: "Default ldflags to pass to every go build. A `ko_build` resource's `ldflags` are appended to these, so they take precedence where the linker only honors the last value.",
+					Optional:    true,
+					Type:        schema.TypeList,
+					Elem:        &schema.Schema{Type: schema.TypeString},
+				},
+				"env": {
+					Description: "Default environment variables to pass to every go build. A `ko_build` resource's `env` are appended to these, so a resource's value for the same variable takes precedence.",
+					Optional:    true,
+					Type:        schema.TypeList,
+					Elem:        &schema.Schema{Type: schema.TypeString},
+				},
+				"lenient_source_date_epoch": {
+					Description: "If true, an invalid `SOURCE_DATE_EPOCH` environment variable is ignored with a warning, and images are built with the default creation time. Otherwise, builds fail when it isn't a valid number of seconds since the epoch.",
+					Optional:    true,
+					Default:     false,
+					Type:        schema.TypeBool,
+				},
+				"sbom_upload": {
+					Description: "Whether `ko_build` pushes the SBOMs it generates to the registry alongside images, unless a resource sets its own `sbom_upload`",
+					Optional:    true,
+					Default:     true,
+					Type:        schema.TypeBool,
+				},
+				"build_retries": {
+					Description: "How many times `ko_build` retries a build if `go build` fails with what looks like a transient error, such as a network error downloading modules, unless a resource sets its own `build_retries`. Compile errors are never retried.",
+					Optional:    true,
+					Default:     0,
+					Type:        schema.TypeInt,
+					ValidateDiagFunc: func(data interface{}, _ cty.Path) diag.Diagnostics {
+						if data.(int) < 0 {
+							return diag.Errorf("build_retries must not be negative, got %d", data.(int))
+						}
+						return nil
+					},
+				},
+				"timeout": {
+					Description: "How long each `ko_build` build, and separately each publish, may take (e.g. `10m`) before it's cancelled and fails, unless a resource sets its own `timeout`, so a hung build or registry doesn't stall Terraform forever. Defaults to no timeout.",
+					Optional:    true,
+					Default:     "",
+					Type:        schema.TypeString,
+					ValidateDiagFunc: func(data interface{}, _ cty.Path) diag.Diagnostics {
+						if v := data.(string); v != "" {
+							if _, err := time.ParseDuration(v); err != nil {
+								return diag.Errorf("invalid timeout %q: %v", v, err)
+							}
+						}
+						return nil
+					},
+				},
+				"remote_build_cache": {
+					Description: "Image reference, such as `registry.example.com/ci/gocache:main`, to store the Go build cache at between builds. The cache is pulled once, into a directory that all of the provider's builds share, and pushed after each `ko_build` resource is created, so stateless CI runners don't start from an empty cache. Refreshing a resource, or reading the `ko_build` data source, uses the cache without pushing it. Failing to pull or push the cache is logged and doesn't fail the build.",
+					Optional:    true,
+					Default:     "",
+					Type:        schema.TypeString,
+				},
+				"insecure": {
+					Description: "If true, allow registries that are served over plain HTTP, or over HTTPS with certificates that can't be verified, such as self-signed ones, for on-prem and CI registries. Prefer `ca_cert` for registries with certificates from a private CA, since this disables certificate verification for every registry.",
+					Optional:    true,
+					Default:     false,
+					Type:        schema.TypeBool,
+				},
+				"retry_count": {
+					Description: "How many times to retry registry requests that fail with a network error or a 408, 429 or 5xx status, waiting `retry_backoff` before the first retry and twice as long before each one after. Other statuses, like 401 and 404, are never retried. Zero keeps the default of retrying network errors and 5xx statuses a few times.",
+					Optional:    true,
+					Default:     0,
+					Type:        schema.TypeInt,
+					ValidateDiagFunc: func(data interface{}, _ cty.Path) diag.Diagnostics {
+						if data.(int) < 0 {
+							return diag.Errorf("retry_count must not be negative, got %d", data.(int))
+						}
+						return nil
+					},
+				},
+				"retry_backoff": {
+					Description: "How long to wait before the first retry of a registry request with `retry_count` (e.g. `1s`). Each later retry waits twice as long as the one before.",
+					Optional:    true,
+					Default:     "1s",
+					Type:        schema.TypeString,
+					ValidateDiagFunc: func(data interface{}, _ cty.Path) diag.Diagnostics {
+						if _, err := time.ParseDuration(data.(string)); err != nil {
+							return diag.Errorf("invalid retry_backoff %q: %v", data.(string), err)
+						}
+						return nil
+					},
+				},
+				"disable_base_cache": {
+					Description: "Disable the in-process cache of base image lookups, so every build fetches its base image from the registry",
+					Optional:    true,
+					Default:     false,
+					Type:        schema.TypeBool,
+				},
+				"base_cache_ttl": {
+					Description: "How long to cache base image lookups by tag (e.g. `5m`) before resolving the tag again, so a long-running provider picks up tags that were pushed again. Base images referenced by digest are cached for as long as the provider runs. Defaults to `5m`; `0` caches lookups by tag forever.",
+					Optional:    true,
+					Default:     "5m",
+					Type:        schema.TypeString,
+					ValidateDiagFunc: func(data interface{}, _ cty.Path) diag.Diagnostics {
+						if v := data.(string); v != "" {
+							if _, err := time.ParseDuration(v); err != nil {
+								return diag.Errorf("invalid base_cache_ttl %q: %v", v, err)
+							}
+						}
+						return nil
+					},
+				},
+				"base_cache_size": {
+					Description: "Maximum number of base image lookups to keep in the in-process cache, evicting the least recently used. Zero means no limit.",
+					Optional:    true,
+					Default:     0,
+					Type:        schema.TypeInt,
+					ValidateDiagFunc: func(data interface{}, _ cty.Path) diag.Diagnostics {
+						if data.(int) < 0 {
+							return diag.Errorf("base_cache_size must not be negative, got %d", data.(int))
+						}
+						return nil
+					},
+				},
+				"max_parallelism": {
+					Description: "Maximum number of images to build at once across all `ko_build` resources, for configs with many images where Terraform's own parallelism would start more builds than the machine can run at once. Builds wait for a free slot before building; pushing isn't limited. Zero means no limit beyond Terraform's `-parallelism`.",
+					Optional:    true,
+					Default:     0,
+					Type:        schema.TypeInt,
+					ValidateDiagFunc: func(data interface{}, _ cty.Path) diag.Diagnostics {
+						if data.(int) < 0 {
+							return diag.Errorf("max_parallelism must not be negative, got %d", data.(int))
+						}
+						return nil
+					},
+				},
 			},
 			ResourcesMap: map[string]*schema.Resource{
-				"ko_build": resourceBuild(),
+				"ko_build":      resourceBuild(),
+				"ko_push":       resourcePush(),
+				"ko_base_cache": resourceBaseCache(),
+			},
+			DataSourcesMap: map[string]*schema.Resource{
+				"ko_build":      dataSourceBuild(),
+				"ko_image_diff": dataSourceImageDiff(),
+				"ko_preflight":  dataSourcePreflight(),
 			},
 		}
 
@@ -69,13 +290,183 @@ func configure(version string, p *schema.Provider) func(context.Context, *schema
 		if !ok {
 			return nil, diag.Errorf("expected repo to be string")
 		}
+		if repoEnv, ok := s.Get("repo_env").([]interface{}); !ok {
+			return nil, diag.Errorf("expected repo_env to be list")
+		} else if raw := s.GetRawConfig(); raw.IsNull() || raw.GetAttr("repo").IsNull() {
+			names, err := toStringSlice(repoEnv)
+			if err != nil {
+				return nil, diag.Errorf("repo_env: %v", err)
+			}
+			if r := firstEnv(names); r != "" {
+				koDockerRepo = r
+			}
+		}
 
 		baseImage, ok := s.Get("base_image").(string)
 		if !ok {
 			return nil, diag.Errorf("expected base_image to be string")
 		}
 
-		var auth *authn.Basic
+		var repoTemplate *template.Template
+		if t, ok := s.Get("repo_template").(string); !ok {
+			return nil, diag.Errorf("expected repo_template to be string")
+		} else if t != "" {
+			var err error
+			repoTemplate, err = template.New("repo_template").Option("missingkey=error").Parse(t)
+			if err != nil {
+				return nil, diag.Errorf("parsing repo_template: %v", err)
+			}
+		}
+
+		kc := keychain
+		if names, ok := s.Get("keychains").([]interface{}); !ok {
+			return nil, diag.Errorf("expected keychains to be list")
+		} else if raw := s.GetRawConfig(); !raw.IsNull() && !raw.GetAttr("keychains").IsNull() {
+			l, err := toStringSlice(names)
+			if err != nil {
+				return nil, diag.Errorf("keychains: %v", err)
+			}
+			if kc, err = keychainsByName(l); err != nil {
+				return nil, diag.Errorf("keychains: %v", err)
+			}
+		}
+		if dir, ok := s.Get("docker_config_dir").(string); !ok {
+			return nil, diag.Errorf("expected docker_config_dir to be string")
+		} else if dir != "" {
+			cf, err := loadDockerConfigDir(dir)
+			if err != nil {
+				return nil, diag.Errorf("loading docker_config_dir: %v", err)
+			}
+			kc = append([]namedKeychain{{"docker_config_dir", configFileKeychain{cf}}}, kc...)
+		}
+		if c, ok := s.Get("docker_config_json").(string); !ok {
+			return nil, diag.Errorf("expected docker_config_json to be string")
+		} else if c != "" {
+			cf, err := parseDockerConfigJSON(c)
+			if err != nil {
+				return nil, diag.Errorf("parsing docker_config_json: %v", err)
+			}
+			kc = append([]namedKeychain{{"docker_config_json", configFileKeychain{cf}}}, kc...)
+		}
+
+		var transport http.RoundTripper
+		if c, ok := s.Get("ca_cert").(string); !ok {
+			return nil, diag.Errorf("expected ca_cert to be string")
+		} else if c != "" {
+			var err error
+			if transport, err = caTransport(c); err != nil {
+				return nil, diag.Errorf("ca_cert: %v", err)
+			}
+		}
+		if c, ok := s.Get("client_cert").(string); !ok {
+			return nil, diag.Errorf("expected client_cert to be string")
+		} else if k, ok := s.Get("client_key").(string); !ok {
+			return nil, diag.Errorf("expected client_key to be string")
+		} else if c != "" && k != "" {
+			var err error
+			if transport, err = clientCertTransport(transport, c, k); err != nil {
+				return nil, diag.Errorf("client_cert: %v", err)
+			}
+		}
+
+		insecure, ok := s.Get("insecure").(bool)
+		if !ok {
+			return nil, diag.Errorf("expected insecure to be bool")
+		} else if insecure {
+			transport = insecureTransport(transport)
+		}
+
+		var backoff remote.Backoff
+		if n, ok := s.Get("retry_count").(int); !ok {
+			return nil, diag.Errorf("expected retry_count to be int")
+		} else if b, ok := s.Get("retry_backoff").(string); !ok {
+			return nil, diag.Errorf("expected retry_backoff to be string")
+		} else if n > 0 {
+			d, err := time.ParseDuration(b)
+			if err != nil {
+				return nil, diag.Errorf("parsing retry_backoff: %v", err)
+			}
+			backoff = retryBackoff(n, d)
+			transport = retryTransport(transport, backoff)
+		}
+
+		var cache *baseCache
+		if disable, ok := s.Get("disable_base_cache").(bool); !ok {
+			return nil, diag.Errorf("expected disable_base_cache to be bool")
+		} else if !disable {
+			size, ok := s.Get("base_cache_size").(int)
+			if !ok {
+				return nil, diag.Errorf("expected base_cache_size to be int")
+			}
+			var ttl time.Duration
+			if t, ok := s.Get("base_cache_ttl").(string); !ok {
+				return nil, diag.Errorf("expected base_cache_ttl to be string")
+			} else if t != "" {
+				var err error
+				if ttl, err = time.ParseDuration(t); err != nil {
+					return nil, diag.Errorf("parsing base_cache_ttl: %v", err)
+				}
+			}
+			cache = newBaseCache(size, ttl)
+		}
+		maxParallelism, ok := s.Get("max_parallelism").(int)
+		if !ok {
+			return nil, diag.Errorf("expected max_parallelism to be int")
+		}
+
+		ldflagsList, ok := s.Get("ldflags").([]interface{})
+		if !ok {
+			return nil, diag.Errorf("expected ldflags to be list")
+		}
+		defaultLdflags, err := toStringSlice(ldflagsList)
+		if err != nil {
+			return nil, diag.Errorf("ldflags: %v", err)
+		}
+		envList, ok := s.Get("env").([]interface{})
+		if !ok {
+			return nil, diag.Errorf("expected env to be list")
+		}
+		defaultEnv, err := toStringSlice(envList)
+		if err != nil {
+			return nil, diag.Errorf("env: %v", err)
+		}
+
+		lenientSourceDateEpoch, ok := s.Get("lenient_source_date_epoch").(bool)
+		if !ok {
+			return nil, diag.Errorf("expected lenient_source_date_epoch to be bool")
+		}
+
+		sbomUpload, ok := s.Get("sbom_upload").(bool)
+		if !ok {
+			return nil, diag.Errorf("expected sbom_upload to be bool")
+		}
+
+		buildRetries, ok := s.Get("build_retries").(int)
+		if !ok {
+			return nil, diag.Errorf("expected build_retries to be int")
+		}
+
+		var timeout time.Duration
+		if t, ok := s.Get("timeout").(string); !ok {
+			return nil, diag.Errorf("expected timeout to be string")
+		} else if t != "" {
+			var err error
+			if timeout, err = time.ParseDuration(t); err != nil {
+				return nil, diag.Errorf("parsing timeout: %v", err)
+			}
+		}
+
+		var buildCache *remoteBuildCache
+		if ref, ok := s.Get("remote_build_cache").(string); !ok {
+			return nil, diag.Errorf("expected remote_build_cache to be string")
+		} else if ref != "" {
+			if _, err := name.ParseReference(ref); err != nil {
+				return nil, diag.Errorf("parsing remote_build_cache: %v", err)
+			}
+			buildCache = newRemoteBuildCache(ref)
+		}
+
+		var auth *authn.AuthConfig
 		if a, ok := s.Get("basic_auth").(string); !ok {
 			return nil, diag.Errorf("expected basic_auth to be string")
 		} else if a != "" {
@@ -83,11 +474,27 @@ func configure(version string, p *schema.Provider) func(context.Context, *schema
 			if !ok {
 				return nil, diag.Errorf(`basic_auth did not contain ":"`)
 			}
-			auth = &authn.Basic{
+			auth = &authn.AuthConfig{
 				Username: user,
 				Password: pass,
 			}
 		}
+		if env, ok := s.Get("basic_auth_env").(string); !ok {
+			return nil, diag.Errorf("expected basic_auth_env to be string")
+		} else if env != "" {
+			var err error
+			if auth, err = authFromEnv(env); err != nil {
+				return nil, diag.Errorf("basic_auth_env: %v", err)
+			}
+		}
+		if t, ok := s.Get("bearer_token").(string); !ok {
+			return nil, diag.Errorf("expected bearer_token to be string")
+		} else if t != "" {
+			if auth != nil {
+				return nil, diag.Errorf("bearer_token can't be set with basic_auth or basic_auth_env")
+			}
+			auth = &authn.AuthConfig{RegistryToken: t}
+		}
 
 		return &Opts{
 			bo: &options.BuildOptions{
@@ -96,15 +503,58 @@ func configure(version string, p *schema.Provider) func(context.Context, *schema
 			po: &options.PublishOptions{
 				DockerRepo: koDockerRepo,
 			},
-			auth: auth,
+			repoTemplate: repoTemplate,
+			auth:         auth,
+			keychain:     kc,
+			transport:    transport,
+			insecure:     insecure,
+			retryBackoff: backoff,
+			baseCache:    cache,
+			buildLimiter: newBuildLimiter(maxParallelism),
+			ldflags:      defaultLdflags,
+			env:          defaultEnv,
+			sbomUpload:   sbomUpload,
+			buildRetries: buildRetries,
+			timeout:      timeout,
+
+			lenientSourceDateEpoch: lenientSourceDateEpoch,
+			remoteBuildCache:       buildCache,
 		}, nil
 	}
 }
 
+// registryOptions returns o with the provider's settings for registry requests and base image lookups filled in:
+// its auth, keychain, transport, insecure, retry backoff, base image cache and build limiter.
+func (po *Opts) registryOptions(o buildOptions) buildOptions {
+	o.auth = po.auth
+	o.keychain = po.keychain
+	o.transport = po.transport
+	o.insecure = po.insecure
+	o.retryBackoff = po.retryBackoff
+	o.baseCache = po.baseCache
+	o.buildLimiter = po.buildLimiter
+	return o
+}
+
 type Opts struct {
-	bo   *options.BuildOptions
-	po   *options.PublishOptions
-	auth *authn.Basic
+	bo           *options.BuildOptions
+	po           *options.PublishOptions
+	repoTemplate *template.Template
+	auth         *authn.AuthConfig
+	keychain     []namedKeychain
+	transport    http.RoundTripper // Transport for registry requests, or nil to use the default.
+	insecure     bool              // If true, allow plain-HTTP registries and certificates that can't be verified.
+	retryBackoff remote.Backoff    // How to retry registry requests, or zero Steps for go-containerregistry's defaults.
+	baseCache    *baseCache        // Cache of base image lookups, or nil if disabled.
+	buildLimiter *buildLimiter     // Bounds how many builds run at once, or nil for no limit.
+	ldflags      []string          // Default ldflags, which each build's ldflags are appended to.
+	env          []string          // Default environment variables, which each build's env are appended to.
+	sbomUpload   bool              // Whether to push SBOMs, unless a resource overrides it.
+	buildRetries int               // How many times to retry transient build failures, unless a resource overrides it.
+	timeout      time.Duration     // How long a build, and a publish, may take, unless a resource overrides it; zero for no limit.
+
+	lenientSourceDateEpoch bool              // If true, ignore an invalid SOURCE_DATE_EPOCH instead of failing builds.
+	remoteBuildCache       *remoteBuildCache // Go build cache stored in a registry between builds, or nil to use the local cache.
 }
 
 func NewProviderOpts(meta interface{}) (*Opts, error) {
@@ -120,3 +570,25 @@ func NewProviderOpts(meta interface{}) (*Opts, error) {
 
 	return opts, nil
 }
+
+// authFromEnv reads registry auth from the environment variable env, which contains either "user:password" or a registry token.
+func authFromEnv(env string) (*authn.AuthConfig, error) {
+	v := os.Getenv(env)
+	if v == "" {
+		return nil, fmt.Errorf("environment variable %s is not set", env)
+	}
+	if user, pass, ok := strings.Cut(v, ":"); ok {
+		return &authn.AuthConfig{Username: user, Password: pass}, nil
+	}
+	return &authn.AuthConfig{RegistryToken: v}, nil
+}
+
+// firstEnv returns the value of the first of the environment variables that is set, or "" if none are.
+func firstEnv(names []string) string {
+	for _, n := range names {
+		if v := os.Getenv(n); v != "" {
+			return v
+		}
+	}
+	return ""
+}
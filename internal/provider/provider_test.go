@@ -1,9 +1,18 @@
 package provider
 
 import (
+	"context"
+	"encoding/base64"
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/hashicorp/go-cty/cty"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/terraform"
 )
 
 var providerFactories = map[string]func() (*schema.Provider, error){
@@ -17,3 +26,171 @@ func TestProvider(t *testing.T) {
 		t.Fatalf("err: %s", err)
 	}
 }
+
+func TestAuthFromEnv(t *testing.T) {
+	t.Setenv("TEST_REGISTRY_BASIC", "user:pa:ss")
+	t.Setenv("TEST_REGISTRY_TOKEN", "token")
+
+	for _, tc := range []struct {
+		env  string
+		want *authn.AuthConfig
+	}{
+		{"TEST_REGISTRY_BASIC", &authn.AuthConfig{Username: "user", Password: "pa:ss"}},
+		{"TEST_REGISTRY_TOKEN", &authn.AuthConfig{RegistryToken: "token"}},
+		{"TEST_REGISTRY_UNSET", nil},
+	} {
+		t.Run(tc.env, func(t *testing.T) {
+			got, err := authFromEnv(tc.env)
+			if tc.want == nil {
+				if err == nil {
+					t.Fatal("expected error for unset environment variable")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("authFromEnv: %v", err)
+			}
+			if *got != *tc.want {
+				t.Errorf("expected %+v, got %+v", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestRepoEnv(t *testing.T) {
+	t.Setenv("KO_DOCKER_REPO", "example.com/default")
+	t.Setenv("TEST_REPO_STAGING", "")
+	t.Setenv("TEST_REPO_PROD", "example.com/prod")
+
+	repoEnv := func(names ...string) cty.Value {
+		vals := make([]cty.Value, len(names))
+		for i, n := range names {
+			vals[i] = cty.StringVal(n)
+		}
+		return cty.ListVal(vals)
+	}
+	for _, tc := range []struct {
+		desc   string
+		config map[string]cty.Value
+		want   string
+	}{
+		{"default", nil, "example.com/default"},
+		{"first set env var", map[string]cty.Value{"repo_env": repoEnv("TEST_REPO_STAGING", "TEST_REPO_PROD")}, "example.com/prod"},
+		{"none set", map[string]cty.Value{"repo_env": repoEnv("TEST_REPO_STAGING")}, "example.com/default"},
+		{"explicit repo", map[string]cty.Value{"repo": cty.StringVal("example.com/explicit"), "repo_env": repoEnv("TEST_REPO_PROD")}, "example.com/explicit"},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			p := New("dev")()
+			if diags := p.Configure(context.Background(), providerConfig(p, tc.config)); diags.HasError() {
+				t.Fatalf("Configure: %v", diags)
+			}
+			if got := p.Meta().(*Opts).po.DockerRepo; got != tc.want {
+				t.Errorf("expected repo %q, got %q", tc.want, got)
+			}
+		})
+	}
+}
+
+// providerConfig returns the provider configuration with the attributes in config set, and the rest null.
+func providerConfig(p *schema.Provider, config map[string]cty.Value) *terraform.ResourceConfig {
+	cs := schema.InternalMap(p.Schema).CoreConfigSchema()
+	vals := map[string]cty.Value{}
+	for name, ty := range cs.ImpliedType().AttributeTypes() {
+		vals[name] = cty.NullVal(ty)
+	}
+	for name, v := range config {
+		vals[name] = v
+	}
+	c := terraform.NewResourceConfigShimmed(cty.ObjectVal(vals), cs)
+	c.CtyValue = cty.ObjectVal(vals)
+	return c
+}
+
+func TestBearerToken(t *testing.T) {
+	p := New("dev")()
+	if diags := p.Configure(context.Background(), providerConfig(p, map[string]cty.Value{"bearer_token": cty.StringVal("token")})); diags.HasError() {
+		t.Fatalf("Configure: %v", diags)
+	}
+	opts := p.Meta().(*Opts)
+	if want := (authn.AuthConfig{RegistryToken: "token"}); opts.auth == nil || *opts.auth != want {
+		t.Fatalf("expected auth %+v, got %+v", want, opts.auth)
+	}
+
+	// The token is sent as a bearer token for the repo's registry.
+	bo := buildOptions{imageRepo: "registry.example.com/app", auth: opts.auth, keychain: []namedKeychain{}, authSources: &authSources{}}
+	reg, err := name.NewRegistry("registry.example.com")
+	if err != nil {
+		t.Fatalf("NewRegistry: %v", err)
+	}
+	a, err := bo.authKeychain().Resolve(reg)
+	if err != nil {
+		t.Fatalf("Resolve: %v", err)
+	}
+	if h, err := authn.Authorization(context.Background(), a); err != nil || h.RegistryToken != "token" {
+		t.Errorf("expected registry token %q, got %+v (%v)", "token", h, err)
+	}
+	if got := bo.authSources.get("registry.example.com"); got != "bearer_token" {
+		t.Errorf("expected credentials from %q, got %q", "bearer_token", got)
+	}
+
+	// It can't be combined with basic_auth.
+	p = New("dev")()
+	if diags := p.Validate(providerConfig(p, map[string]cty.Value{"bearer_token": cty.StringVal("token"), "basic_auth": cty.StringVal("user:pass")})); !diags.HasError() {
+		t.Error("expected bearer_token and basic_auth to conflict")
+	}
+}
+
+func TestDockerConfigDir(t *testing.T) {
+	dir := t.TempDir()
+	auth := base64.StdEncoding.EncodeToString([]byte("user:pass"))
+	if err := os.WriteFile(filepath.Join(dir, "config.json"), []byte(`{"auths": {"registry.example.com": {"auth": "`+auth+`"}}}`), 0o600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	p := New("dev")()
+	if diags := p.Configure(context.Background(), providerConfig(p, map[string]cty.Value{"docker_config_dir": cty.StringVal(dir)})); diags.HasError() {
+		t.Fatalf("Configure: %v", diags)
+	}
+	bo := buildOptions{keychain: p.Meta().(*Opts).keychain, authSources: &authSources{}}
+	reg, err := name.NewRegistry("registry.example.com")
+	if err != nil {
+		t.Fatalf("NewRegistry: %v", err)
+	}
+	a, err := bo.authKeychain().Resolve(reg)
+	if err != nil {
+		t.Fatalf("Resolve: %v", err)
+	}
+	if cfg, err := authn.Authorization(context.Background(), a); err != nil || cfg.Username != "user" || cfg.Password != "pass" {
+		t.Errorf("expected credentials user:pass, got %+v (%v)", cfg, err)
+	}
+	if got := bo.authSources.get("registry.example.com"); got != "docker_config_dir" {
+		t.Errorf("expected credentials from %q, got %q", "docker_config_dir", got)
+	}
+
+	// A directory without a config file is an error, rather than silently using no credentials.
+	p = New("dev")()
+	if diags := p.Configure(context.Background(), providerConfig(p, map[string]cty.Value{"docker_config_dir": cty.StringVal(t.TempDir())})); !diags.HasError() {
+		t.Error("expected an error for a directory without config.json")
+	}
+}
+
+func TestRegistryOptions(t *testing.T) {
+	// Every resource and data source that talks to a registry gets all of the provider's registry settings.
+	po := &Opts{
+		auth:         &authn.AuthConfig{Username: "user"},
+		keychain:     []namedKeychain{{"default", authn.DefaultKeychain}},
+		transport:    insecureTransport(nil),
+		insecure:     true,
+		retryBackoff: retryBackoff(3, time.Second),
+		baseCache:    newBaseCache(1, time.Minute),
+		buildLimiter: newBuildLimiter(1),
+	}
+	opts := po.registryOptions(buildOptions{imageRepo: "example.com/repo"})
+	if opts.imageRepo != "example.com/repo" {
+		t.Errorf("expected repo to be kept, got %q", opts.imageRepo)
+	}
+	if opts.auth != po.auth || len(opts.keychain) != 1 || opts.transport != po.transport || !opts.insecure ||
+		opts.retryBackoff != po.retryBackoff || opts.baseCache != po.baseCache || opts.buildLimiter != po.buildLimiter {
+		t.Errorf("expected the provider's registry options, got %+v", opts)
+	}
+}
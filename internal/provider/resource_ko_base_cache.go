@@ -0,0 +1,144 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/hashicorp/go-cty/cty"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+)
+
+func resourceBaseCache() *schema.Resource {
+	return &schema.Resource{
+		Description: "Fetches base images into the provider's in-memory base image cache, so that `ko_build` resources that depend on it, for example with `depends_on`, find them already fetched instead of each fetching them when they build in parallel. The cache only lasts as long as the provider runs, so the base images are fetched again whenever the resource is read or created. It has no effect if the provider's `disable_base_cache` is set.",
+
+		CreateContext: resourceKoBaseCacheCreate,
+		ReadContext:   resourceKoBaseCacheRead,
+		DeleteContext: resourceKoBaseCacheDelete,
+
+		Schema: map[string]*schema.Schema{
+			"base_images": {
+				Description: "Base image references to fetch, written exactly as in the `base_image` of the `ko_build` resources that use them, since the cache is keyed by the reference as written and the platforms.",
+				Type:        schema.TypeList,
+				Required:    true,
+				MinItems:    1,
+				Elem:        &schema.Schema{Type: schema.TypeString},
+				ForceNew:    true, // Any time this changes, don't try to update in-place, just create it.
+			},
+			"platforms": {
+				Description: "Platforms the `ko_build` resources that use the base images build for, listed as in their `platforms` in any order, since the cache is keyed by the reference and the platforms. Defaults to `linux/amd64`, like `ko_build`.",
+				Optional:    true,
+				Type:        schema.TypeList,
+				Elem: &schema.Schema{
+					Type: schema.TypeString,
+					ValidateDiagFunc: func(data interface{}, _ cty.Path) diag.Diagnostics {
+						if err := checkPlatform(data.(string)); err != nil {
+							return diag.Errorf("Invalid platform: %v", err)
+						}
+						return nil
+					},
+				},
+				ForceNew: true, // Any time this changes, don't try to update in-place, just create it.
+			},
+			"digests": {
+				Description: "Digest each base image reference resolved to when it was last fetched, keyed by the reference.",
+				Type:        schema.TypeMap,
+				Elem:        &schema.Schema{Type: schema.TypeString},
+				Computed:    true,
+			},
+		},
+	}
+}
+
+// warmBaseCache fetches each of bases, with its images' manifests and configs, into opts.baseCache for builds for opts.platforms,
+// and returns the digest each resolved to.
+func warmBaseCache(bases []string, opts buildOptions) (map[string]string, error) {
+	digests := make(map[string]string, len(bases))
+	for _, b := range bases {
+		o := opts
+		o.baseImage = b
+		ref, base, err := o.fetchBase()
+		if err != nil {
+			return nil, fmt.Errorf("fetching base image %s: %w", b, err)
+		}
+		if base, err = warmBase(base); err != nil {
+			return nil, fmt.Errorf("fetching base image %s: %w", b, err)
+		}
+		dig, err := base.Digest()
+		if err != nil {
+			return nil, fmt.Errorf("digest of base image %s: %w", b, err)
+		}
+		_, pinned := ref.(name.Digest)
+		opts.baseCache.Store(o.baseCacheKey(), base, pinned)
+		digests[b] = dig.String()
+	}
+	return digests, nil
+}
+
+func resourceKoBaseCacheCreate(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	po, err := NewProviderOpts(meta)
+	if err != nil {
+		return diag.Errorf("configuring provider: %v", err)
+	}
+
+	bases, err := toStringSlice(d.Get("base_images").([]interface{}))
+	if err != nil {
+		return diag.Errorf("[id=%s] create base_images: %v", d.Id(), err)
+	}
+	platforms, err := toStringSlice(d.Get("platforms").([]interface{}))
+	if err != nil {
+		return diag.Errorf("[id=%s] create platforms: %v", d.Id(), err)
+	}
+	opts := po.registryOptions(buildOptions{platforms: defaultPlatform(platforms)})
+	digests, err := warmBaseCache(bases, opts)
+	if err != nil {
+		return diag.Errorf("[id=%s] create warmBaseCache: %v", d.Id(), err)
+	}
+
+	_ = d.Set("digests", digests)
+	d.SetId(strings.Join(bases, ","))
+	if po.baseCache == nil {
+		return diag.Diagnostics{{
+			Severity: diag.Warning,
+			Summary:  "Base image cache is disabled",
+			Detail:   "the provider's disable_base_cache is set, so ko_build resources fetch their base images themselves and ko_base_cache has no effect",
+		}}
+	}
+	return nil
+}
+
+func resourceKoBaseCacheRead(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	po, err := NewProviderOpts(meta)
+	if err != nil {
+		return diag.Errorf("configuring provider: %v", err)
+	}
+
+	// Fetch the base images again, since this is a new run of the provider with an empty cache.
+	bases, err := toStringSlice(d.Get("base_images").([]interface{}))
+	if err != nil {
+		return diag.Errorf("[id=%s] read base_images: %v", d.Id(), err)
+	}
+	platforms, err := toStringSlice(d.Get("platforms").([]interface{}))
+	if err != nil {
+		return diag.Errorf("[id=%s] read platforms: %v", d.Id(), err)
+	}
+	opts := po.registryOptions(buildOptions{platforms: defaultPlatform(platforms)})
+	digests, err := warmBaseCache(bases, opts)
+	if err != nil {
+		return diag.Diagnostics{{
+			Severity: diag.Warning,
+			Summary:  "Failed to fetch base images -- builds will fetch them themselves.",
+			Detail:   fmt.Sprintf("failed to fetch base images: %v", err),
+		}}
+	}
+	_ = d.Set("digests", digests)
+	return nil
+}
+
+func resourceKoBaseCacheDelete(_ context.Context, _ *schema.ResourceData, _ interface{}) diag.Diagnostics {
+	// Nothing is stored outside the provider's memory.
+	return nil
+}
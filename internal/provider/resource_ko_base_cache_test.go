@@ -0,0 +1,98 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/registry"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/resource"
+)
+
+func TestWarmBaseCache(t *testing.T) {
+	// Setup a local registry that counts requests for the base image's manifests.
+	var manifestGets atomic.Int32
+	reg := registry.New()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet && strings.Contains(r.URL.Path, "/base/manifests/") {
+			manifestGets.Add(1)
+		}
+		reg.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+	parts := strings.Split(srv.URL, ":")
+	url := fmt.Sprintf("localhost:%s/test", parts[len(parts)-1])
+	base := pushBaseIndex(t, url+"/base",
+		v1.Platform{OS: "linux", Architecture: "amd64"},
+		v1.Platform{OS: "linux", Architecture: "arm64"},
+	)
+
+	cache := newBaseCache(0, 0)
+	// Listed in a different order than the build's platforms, which doesn't matter.
+	digests, err := warmBaseCache([]string{base}, buildOptions{platforms: []string{"linux/arm64", "linux/amd64"}, baseCache: cache})
+	if err != nil {
+		t.Fatalf("warmBaseCache: %v", err)
+	}
+	if !regexp.MustCompile(`^sha256:[0-9a-f]{64}$`).MatchString(digests[base]) {
+		t.Errorf("expected a digest for %s, got %v", base, digests)
+	}
+	// The index and both images were fetched.
+	if got := manifestGets.Load(); got != 3 {
+		t.Errorf("expected 3 manifest fetches warming the cache, got %d", got)
+	}
+
+	// Builds from the warmed base don't fetch its manifests again.
+	manifestGets.Store(0)
+	if _, _, err := doBuild(context.Background(), buildOptions{
+		ip:         "github.com/ko-build/terraform-provider-ko/cmd/test",
+		workingDir: ".",
+		imageRepo:  url,
+		platforms:  []string{"linux/amd64", "linux/arm64"},
+		baseImage:  base,
+		sbom:       "none",
+		baseCache:  cache,
+	}); err != nil {
+		t.Fatalf("doBuild: %v", err)
+	}
+	if got := manifestGets.Load(); got != 0 {
+		t.Errorf("expected no manifest fetches building from the warmed base, got %d", got)
+	}
+}
+
+func TestAccResourceKoBaseCache(t *testing.T) {
+	// Setup a local registry and have tests push to that.
+	srv := httptest.NewServer(registry.New())
+	defer srv.Close()
+	parts := strings.Split(srv.URL, ":")
+	url := fmt.Sprintf("localhost:%s/test", parts[len(parts)-1])
+	t.Setenv("KO_DOCKER_REPO", url)
+	base := pushBaseIndex(t, url+"/base", v1.Platform{OS: "linux", Architecture: "amd64"})
+
+	resource.Test(t, resource.TestCase{
+		ProviderFactories: providerFactories,
+		Steps: []resource.TestStep{{
+			Config: fmt.Sprintf(`
+			resource "ko_base_cache" "bases" {
+			  base_images = [%[1]q]
+			}
+
+			resource "ko_build" "foo" {
+			  importpath = "github.com/ko-build/terraform-provider-ko/cmd/test"
+			  base_image = %[1]q
+			  sbom       = "none"
+			  depends_on = [ko_base_cache.bases]
+			}
+			`, base),
+			Check: resource.ComposeTestCheckFunc(
+				resource.TestMatchResourceAttr("ko_base_cache.bases", "digests.%", regexp.MustCompile("^1$")),
+				resource.TestMatchResourceAttr("ko_build.foo", "image_ref", regexp.MustCompile("^"+url+"/github.com/ko-build/terraform-provider-ko/cmd/test@sha256:")),
+			),
+		}},
+	})
+}
@@ -1,13 +1,22 @@
 package provider
 
 import (
+	"bytes"
 	"context"
 	"errors"
 	"fmt"
+	gobuild "go/build"
 	"io"
+	"log"
+	"maps"
+	"net/http"
 	"os"
+	"os/exec"
+	"path"
+	"slices"
 	"strconv"
-	"sync"
+	"strings"
+	"text/template"
 	"time"
 
 	"github.com/awslabs/amazon-ecr-credential-helper/ecr-login"
@@ -18,12 +27,16 @@ import (
 	v1 "github.com/google/go-containerregistry/pkg/v1"
 	"github.com/google/go-containerregistry/pkg/v1/google"
 	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
+	"github.com/google/go-containerregistry/pkg/v1/types"
 	"github.com/google/ko/pkg/build"
 	"github.com/google/ko/pkg/commands/options"
 	"github.com/google/ko/pkg/publish"
 	"github.com/hashicorp/go-cty/cty"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/customdiff"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	specsv1 "github.com/opencontainers/image-spec/specs-go/v1"
 )
 
 const (
@@ -36,6 +49,12 @@ var validTypes = map[string]struct{}{
 	"none": {},
 }
 
+var validIDStrategies = map[string]struct{}{
+	"digest":     {},
+	"first_tag":  {},
+	"importpath": {},
+}
+
 func resourceBuild() *schema.Resource {
 	return &schema.Resource{
 		// This description is used by the documentation generator and the language server.
@@ -43,13 +62,15 @@ func resourceBuild() *schema.Resource {
 
 		CreateContext: resourceKoBuildCreate,
 		ReadContext:   resourceKoBuildRead,
+		UpdateContext: resourceKoBuildUpdate,
 		DeleteContext: resourceKoBuildDelete,
+		CustomizeDiff: customdiff.All(validateTags, validateTagOnly, validateRace, validateSBOMCompatible, validatePush, validatePublishMode, validateSign, retagDiff),
 
 		SchemaVersion: 1,
 
 		Schema: map[string]*schema.Schema{
 			"importpath": {
-				Description: "import path to build",
+				Description: "import path to build. Files in the package's `kodata` directory are added to the image, except those matching the patterns in `kodata/.koignore`, which uses `.gitignore` syntax without `!` negation and requires `sbom` to be `none`.",
 				Type:        schema.TypeString,
 				Required:    true,
 				ValidateDiagFunc: func(_ interface{}, _ cty.Path) diag.Diagnostics {
@@ -59,18 +80,26 @@ func resourceBuild() *schema.Resource {
 				ForceNew: true, // Any time this changes, don't try to update in-place, just create it.
 			},
 			"working_dir": {
-				Description: "working directory for the build",
+				Description: "working directory for the build. A relative path is resolved against the directory Terraform runs in, usually the root module, not the module that declares the resource, since Terraform doesn't tell providers where modules are. In reusable modules, use `path.module`, like `\"${path.module}/app\"`, so the build doesn't depend on where Terraform is run.",
 				Optional:    true,
 				Default:     ".",
 				Type:        schema.TypeString,
 				ForceNew:    true, // Any time this changes, don't try to update in-place, just create it.
 			},
 			"platforms": {
-				Description: "Which platform to use when pulling a multi-platform base. Format: all | <os>[/<arch>[/<variant>]][,platform]*",
+				Description: "Which platform to use when pulling a multi-platform base. Format: all | <os>/<arch>[/<variant>], one platform per entry.",
 				Optional:    true,
 				Type:        schema.TypeList,
-				Elem:        &schema.Schema{Type: schema.TypeString},
-				ForceNew:    true, // Any time this changes, don't try to update in-place, just create it.
+				Elem: &schema.Schema{
+					Type: schema.TypeString,
+					ValidateDiagFunc: func(data interface{}, _ cty.Path) diag.Diagnostics {
+						if err := checkPlatform(data.(string)); err != nil {
+							return diag.Errorf("Invalid platform: %v", err)
+						}
+						return nil
+					},
+				},
+				ForceNew: true, // Any time this changes, don't try to update in-place, just create it.
 			},
 			"base_image": {
 				Description: "base image to use",
@@ -79,8 +108,15 @@ func resourceBuild() *schema.Resource {
 				Type:        schema.TypeString,
 				ForceNew:    true, // Any time this changes, don't try to update in-place, just create it.
 			},
+			"base_image_overrides": {
+				Description: "Base images to use for specific import paths, like `baseImageOverrides` in ko's config file. Keys and `importpath` are compared as fully-qualified import paths, so a key may be fully-qualified, like ko's, or relative to `working_dir`, like `./cmd/app`. Relative keys that can't be resolved from `working_dir` are ignored. If `importpath` has an entry, its base image takes precedence over `base_image`. Use this to share one map of base images between the `ko_build` resources of a monorepo.",
+				Optional:    true,
+				Type:        schema.TypeMap,
+				Elem:        &schema.Schema{Type: schema.TypeString},
+				ForceNew:    true, // Any time this changes, don't try to update in-place, just create it.
+			},
 			"sbom": {
-				Description: "The SBOM media type to use (none will disable SBOM synthesis and upload).",
+				Description: "The SBOM media type to use (none will disable SBOM synthesis and upload). The SBOM only describes the Go binary built by ko and the modules it was built from; it does not describe the contents of the base image or the `kodata` directory. The SPDX document is deterministic: it is named after the image digest and dated with the image's creation time, which is `source_date_epoch` or `SOURCE_DATE_EPOCH` if set, so the same inputs produce the same SBOM. Must be `none` if `kodata/.koignore` exists.",
 				Default:     "spdx",
 				Optional:    true,
 				Type:        schema.TypeString,
@@ -100,8 +136,113 @@ func resourceBuild() *schema.Resource {
 				Type:        schema.TypeString,
 				ForceNew:    true, // Any time this changes, don't try to update in-place, just create it.
 			},
+			"build_retries": {
+				Description: "How many times to retry the build if `go build` fails with what looks like a transient error, such as a network error downloading modules. Compile errors are never retried. Defaults to the provider's `build_retries`. Changing it doesn't rebuild the image.",
+				Optional:    true,
+				Type:        schema.TypeInt,
+				ValidateDiagFunc: func(data interface{}, _ cty.Path) diag.Diagnostics {
+					if data.(int) < 0 {
+						return diag.Errorf("build_retries must not be negative, got %d", data.(int))
+					}
+					return nil
+				},
+			},
+			"timeout": {
+				Description: "How long the build, and separately the publish, may take (e.g. `10m`) before it's cancelled and fails. Defaults to the provider's `timeout`. Changing it doesn't rebuild the image.",
+				Optional:    true,
+				Type:        schema.TypeString,
+				ValidateDiagFunc: func(data interface{}, _ cty.Path) diag.Diagnostics {
+					if _, err := time.ParseDuration(data.(string)); err != nil {
+						return diag.Errorf("invalid timeout %q: %v", data.(string), err)
+					}
+					return nil
+				},
+			},
+			"kodata_warn_size": {
+				Description: "If set, warn when the files in the package's `kodata` directory add more than this many bytes to the image, listing the largest of them. The build still succeeds. Changing it doesn't rebuild the image.",
+				Optional:    true,
+				Default:     0,
+				Type:        schema.TypeInt,
+				ValidateDiagFunc: func(data interface{}, _ cty.Path) diag.Diagnostics {
+					if data.(int) < 0 {
+						return diag.Errorf("kodata_warn_size must not be negative, got %d", data.(int))
+					}
+					return nil
+				},
+			},
+			"artifact_repo": {
+				Description: "Repository to push the image's SBOMs to, instead of the image's repository, for registries that keep artifacts apart from images. SBOMs are pushed to the same tags they would have in the image's repository, like `sha256-<hash>.sbom`, and `signature_ref` and `attestation_ref` refer to this repository, so signing tools can be pointed at it too.",
+				Optional:    true,
+				Default:     "",
+				Type:        schema.TypeString,
+				ForceNew:    true, // Any time this changes, don't try to update in-place, just create it.
+			},
+			"artifact_basic_auth": {
+				Description: "Basic auth, as `user:password`, to use for the registry of `artifact_repo`, ahead of the provider's credentials. Changing it doesn't rebuild the image.",
+				Optional:    true,
+				Sensitive:   true,
+				Default:     "",
+				Type:        schema.TypeString,
+			},
+			"sign": {
+				Description: "Sign the image with cosign after it's published, using a private key, and push the signature to the tag named by `signature_ref`, where `cosign verify --key` finds it. An image index is signed, but not the images in it. The signature isn't uploaded to a transparency log, so verify with `--insecure-ignore-tlog`; keyless signing isn't supported. Requires the image to be pushed to the registry.",
+				Optional:    true,
+				Type:        schema.TypeList,
+				MaxItems:    1,
+				ForceNew:    true, // Any time this changes, don't try to update in-place, just create it.
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"key": {
+							Description: "Private key to sign with, as PEM or the path to a PEM file, such as the `cosign.key` written by `cosign generate-key-pair`. ECDSA, RSA and Ed25519 keys are supported.",
+							Type:        schema.TypeString,
+							Required:    true,
+							Sensitive:   true,
+							ForceNew:    true, // Any time this changes, don't try to update in-place, just create it.
+						},
+						"password": {
+							Description: "Password to decrypt `key` with, if it's encrypted like the keys cosign generates. Changing it doesn't rebuild the image.",
+							Type:        schema.TypeString,
+							Optional:    true,
+							Sensitive:   true,
+						},
+					},
+				},
+			},
+			"attest": {
+				Description: "If true, attach a SLSA provenance attestation to the image after it's published, signed with the key of `sign`, at the tag named by `attestation_ref`, where `cosign verify-attestation --type slsaprovenance` finds it. The provenance records the import path, base image, platforms, `ldflags`, build tags, `env` and Go version the image was built with, and the base image digest, source revision and Go toolchain from `materials`. Requires `sign`.",
+				Optional:    true,
+				Type:        schema.TypeBool,
+				Default:     false,
+				ForceNew:    true, // Any time this changes, don't try to update in-place, just create it.
+			},
+			"basic_auth": {
+				Description:   "Basic auth, as `user:password`, to use for the registry of this image's repository, ahead of the provider's credentials. Use this when one image needs different credentials than the provider's. Changing it doesn't rebuild the image.",
+				Optional:      true,
+				Sensitive:     true,
+				Default:       "",
+				Type:          schema.TypeString,
+				ConflictsWith: []string{"token"},
+			},
+			"token": {
+				Description:   "Registry token to use for the registry of this image's repository, ahead of the provider's credentials. Use this when one image needs different credentials than the provider's. Changing it doesn't rebuild the image.",
+				Optional:      true,
+				Sensitive:     true,
+				Default:       "",
+				Type:          schema.TypeString,
+				ConflictsWith: []string{"basic_auth"},
+			},
 			"image_ref": {
-				Description: "built image reference by digest",
+				Description: "built image reference by digest, or by tag alone with `tag_only`",
+				Type:        schema.TypeString,
+				Computed:    true,
+			},
+			"resolved_importpath": {
+				Description: "Fully-qualified import path of the package that was built, as resolved by ko from `importpath` and `working_dir`. Useful for seeing what a relative `importpath` like `.` refers to.",
+				Type:        schema.TypeString,
+				Computed:    true,
+			},
+			"image_digest_ref": {
+				Description: "built image reference in the `repo@sha256:...` form, without any tag. Unlike `image_ref`, this is always an immutable reference by digest, whatever tagging options are used.",
 				Type:        schema.TypeString,
 				Computed:    true,
 			},
@@ -112,6 +253,29 @@ func resourceBuild() *schema.Resource {
 				Elem:        &schema.Schema{Type: schema.TypeString},
 				ForceNew:    true, // Any time this changes, don't try to update in-place, just create it.
 			},
+			"platform_ldflags": {
+				Description: "Extra ldflags to pass to the go build for specific platforms, instead of `ldflags`. Platforms without an entry here are built with `ldflags`. The provider's default `ldflags` apply to every platform.",
+				Optional:    true,
+				Type:        schema.TypeList,
+				ForceNew:    true, // Any time this changes, don't try to update in-place, just create it.
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"platform": {
+							Description: "Platform to apply the ldflags to. Format: <os>/<arch>[/<variant>]",
+							Type:        schema.TypeString,
+							Required:    true,
+							ForceNew:    true, // Any time this changes, don't try to update in-place, just create it.
+						},
+						"ldflags": {
+							Description: "ldflags to pass to the go build for the platform",
+							Type:        schema.TypeList,
+							Elem:        &schema.Schema{Type: schema.TypeString},
+							Required:    true,
+							ForceNew:    true, // Any time this changes, don't try to update in-place, just create it.
+						},
+					},
+				},
+			},
 			"env": {
 				Description: "Extra environment variables to pass to the go build",
 				Optional:    true,
@@ -119,210 +283,1828 @@ func resourceBuild() *schema.Resource {
 				Elem:        &schema.Schema{Type: schema.TypeString},
 				ForceNew:    true, // Any time this changes, don't try to update in-place, just create it.
 			},
+			"gcflags": {
+				Description: "Extra gcflags to pass to the go build, each as a separate `-gcflags`, so each takes Go's `pattern=` prefix syntax, like `all=-N -l` to disable optimizations and inlining for debugging.",
+				Optional:    true,
+				Type:        schema.TypeList,
+				Elem:        &schema.Schema{Type: schema.TypeString},
+				ForceNew:    true, // Any time this changes, don't try to update in-place, just create it.
+			},
+			"asmflags": {
+				Description: "Extra asmflags to pass to the go build, each as a separate `-asmflags`, so each takes Go's `pattern=` prefix syntax, like `all=-trimpath=/src`.",
+				Optional:    true,
+				Type:        schema.TypeList,
+				Elem:        &schema.Schema{Type: schema.TypeString},
+				ForceNew:    true, // Any time this changes, don't try to update in-place, just create it.
+			},
+			"trimpath": {
+				Description: "If true, build with `-trimpath`, removing the paths of the source files on the machine that built the binary from it. Set to false to keep them, for debugging the binary with tools like delve that need the real source paths. This makes builds less reproducible: the binary, and so the image digest, depends on where the source was checked out.",
+				Default:     true,
+				Optional:    true,
+				Type:        schema.TypeBool,
+				ForceNew:    true, // Any time this changes, don't try to update in-place, just create it.
+			},
+			"build_tags": {
+				Description: "Go build tags to build with, passed to the go build as `-tags`, for programs that gate features behind `//go:build` constraints.",
+				Optional:    true,
+				Type:        schema.TypeList,
+				Elem: &schema.Schema{
+					Type: schema.TypeString,
+					ValidateDiagFunc: func(data interface{}, _ cty.Path) diag.Diagnostics {
+						if t := data.(string); t == "" || strings.ContainsAny(t, ", \t") {
+							return diag.Errorf("build tag %q must be non-empty and contain no commas or spaces", t)
+						}
+						return nil
+					},
+				},
+				ForceNew: true, // Any time this changes, don't try to update in-place, just create it.
+			},
 			"tags": {
-				Description: "Which tags to use for the produced image instead of the default 'latest' tag",
+				Description: "Which tags to use for the produced image instead of the default 'latest' tag. Changing only the tags re-tags the already published image without rebuilding it; tags that are removed are left in the registry. With a `publish_mode` other than `registry`, changing the tags publishes the image again instead.",
+				Optional:    true,
+				Type:        schema.TypeList,
+				Elem:        &schema.Schema{Type: schema.TypeString},
+			},
+			"tag_only": {
+				Description: "If true, `image_ref` is the tagged reference `repo:tag`, without the `@sha256:...` digest, for tools that manage tags separately from digests. Requires exactly one tag in `tags` other than `latest`; with more tags, there would be no single tag to refer to the image by. `image_digest_ref` still refers to the image by digest, and is what changes to the image are detected by.",
+				Default:     false,
+				Optional:    true,
+				Type:        schema.TypeBool,
+				ForceNew:    true, // Any time this changes, don't try to update in-place, just create it.
+			},
+			"cgo_enabled": {
+				Description: "If true, build with cgo enabled (`CGO_ENABLED=1`), for binaries that link C libraries. `CC` and `CXX` in `env` choose the C compilers, and a C compiler for each of `platforms` is needed, so building for platforms other than the machine's own needs cross-compilers. The binary is dynamically linked against libc, so the base image must provide it: ko's default `cgr.dev/chainguard/static` doesn't, so use one like `cgr.dev/chainguard/glibc-dynamic`. Applying warns about these problems when it detects them.",
+				Default:     false,
+				Optional:    true,
+				Type:        schema.TypeBool,
+				ForceNew:    true, // Any time this changes, don't try to update in-place, just create it.
+			},
+			"race": {
+				Description: "If true, build with the race detector enabled (`-race`). This requires cgo, so the build enables it, and the resulting binary is dynamically linked against libc, so the base image must provide it. Only platforms supported by the race detector may be built: " + strings.Join(racePlatforms, ", ") + ".",
+				Default:     false,
+				Optional:    true,
+				Type:        schema.TypeBool,
+				ForceNew:    true, // Any time this changes, don't try to update in-place, just create it.
+			},
+			"intersect_base_platforms": {
+				Description: "If true, only build the `platforms` that the base image provides, instead of failing when the base image doesn't provide one of them. The platforms that were skipped are reported as a warning, and `effective_options` lists the platforms that were built.",
+				Default:     false,
+				Optional:    true,
+				Type:        schema.TypeBool,
+				ForceNew:    true, // Any time this changes, don't try to update in-place, just create it.
+			},
+			"sanitize_tags": {
+				Description: "If true, invalid `tags` are made valid by lowercasing them, replacing invalid characters with `-` and truncating them to 128 characters, instead of being rejected at plan time.",
+				Default:     false,
+				Optional:    true,
+				Type:        schema.TypeBool,
+				ForceNew:    true, // Any time this changes, don't try to update in-place, just create it.
+			},
+			"atomic_tags": {
+				Description: "If true and multiple `tags` are set, tags that were already set are rolled back to their previous state if setting a later tag fails. Otherwise, tags are set on a best-effort basis and failures report which tags were set.",
+				Default:     false,
+				Optional:    true,
+				Type:        schema.TypeBool,
+				ForceNew:    true, // Any time this changes, don't try to update in-place, just create it.
+			},
+			"image_env": {
+				Description: "Environment variables to set in the image config, for the running container, in addition to those of the base image. Variables set here take precedence over the base image's, but `KO_DATA_PATH` can't be set, since ko sets it. Unlike `env`, which only affects `go build`, these aren't set during the build. Requires `sbom` to be `none`.",
+				Optional:    true,
+				Type:        schema.TypeMap,
+				Elem:        &schema.Schema{Type: schema.TypeString},
+				ForceNew:    true, // Any time this changes, don't try to update in-place, just create it.
+				ValidateDiagFunc: func(data interface{}, _ cty.Path) diag.Diagnostics {
+					for k := range data.(map[string]interface{}) {
+						if k == "" || strings.Contains(k, "=") {
+							return diag.Errorf("Invalid image_env variable name: %q", k)
+						}
+						if k == "KO_DATA_PATH" {
+							return diag.Errorf("Invalid image_env variable name: %q is set by ko", k)
+						}
+					}
+					return nil
+				},
+			},
+			"labels": {
+				Description: "Labels to set in the image config, such as `org.opencontainers.image.source`, in addition to those of the base image. Labels set here take precedence over the base image's.",
+				Optional:    true,
+				Type:        schema.TypeMap,
+				Elem:        &schema.Schema{Type: schema.TypeString},
+				ForceNew:    true, // Any time this changes, don't try to update in-place, just create it.
+			},
+			"annotations": {
+				Description: "Annotations to set on the image manifest, and on the image index and each image's manifest if the image is built for multiple platforms, for tooling like policy engines and artifact discovery. Unlike `labels`, these aren't in the image config. They take precedence over those added by `git_annotations` and `terraform_run_annotations`, but not over the base image annotations ko adds.",
+				Optional:    true,
+				Type:        schema.TypeMap,
+				Elem:        &schema.Schema{Type: schema.TypeString},
+				ForceNew:    true, // Any time this changes, don't try to update in-place, just create it.
+			},
+			"git_annotations": {
+				Description: "If true, annotate the image with the `org.opencontainers.image.revision` (commit SHA), `org.opencontainers.image.source` (origin remote URL, without any credentials) and `org.opencontainers.image.created` (commit time) of the git repository containing `working_dir`. Nothing is added if `working_dir` isn't in a git repository.",
+				Default:     false,
+				Optional:    true,
+				Type:        schema.TypeBool,
+				ForceNew:    true, // Any time this changes, don't try to update in-place, just create it.
+			},
+			"ko_config": {
+				Description: "If true, read ko's `.ko.yaml` config file from `working_dir`, or from `KO_CONFIG_PATH` if that's set, the way the ko CLI does, so the same config can be shared between ko and Terraform. The base image comes from `baseImageOverrides` for `importpath`, or `defaultBaseImage`, or ko's default base image, in place of the provider's `base_image`; `platforms` defaults to `defaultPlatforms`; and the `builds` entry for `importpath`, or `defaultEnv`, `defaultFlags` and `defaultLdflags`, adds its `env`, `flags`, `ldflags` and `linux_capabilities` to the build. Attributes set on the resource take precedence over the config file: `base_image` and `platforms` replace its values, and `env` and `ldflags` are added after its values, so later values win. A builds entry's `dir` and `main` aren't used; `importpath` is resolved from `working_dir`. Changes to the file are picked up like changes to the source.",
+				Default:     false,
+				Optional:    true,
+				Type:        schema.TypeBool,
+				ForceNew:    true, // Any time this changes, don't try to update in-place, just create it.
+			},
+			"delete_on_destroy": {
+				Description: "If true, delete the image from the registry when the resource is destroyed, for ephemeral environments that would otherwise leave images behind. The tags in `tag_refs` are deleted if they still point to the image, then the image's manifest by digest. The per-platform images of a multi-platform image, and SBOMs, are left for the registry's garbage collection. If the registry doesn't support deleting images, a warning is reported and the image is left. Has no effect if the image was saved to `oci_layout_dir` or `push` is false.",
+				Default:     false,
+				Optional:    true,
+				Type:        schema.TypeBool,
+			},
+			"terraform_run_annotations": {
+				Description: "If true, annotate the image with the HCP Terraform or Terraform Enterprise run that created it: `io.terraform.run-id` from `TFC_RUN_ID`, and `io.terraform.workspace` from `TFC_WORKSPACE_SLUG`, or `TFC_WORKSPACE_NAME` if that's unset. Nothing is added for variables that aren't set, as outside of such runs. The annotations are recorded in `run_annotations` and kept when the image is read in later runs, so a new run ID doesn't replace the image by itself. They take precedence over those added by `git_annotations`, but not over `annotations`.",
+				Default:     false,
+				Optional:    true,
+				Type:        schema.TypeBool,
+				ForceNew:    true, // Any time this changes, don't try to update in-place, just create it.
+			},
+			"run_annotations": {
+				Description: "Annotations added by `terraform_run_annotations`, from the run that created the image.",
+				Type:        schema.TypeMap,
+				Elem:        &schema.Schema{Type: schema.TypeString},
+				Computed:    true,
+			},
+			"oci_layout_dir": {
+				Description:   "If set, save the built image to an OCI image layout in this directory instead of publishing it to the registry. Use `ko_push` to publish it later. `image_ref` is the reference the image will have once pushed to `repo`.",
+				Optional:      true,
+				Type:          schema.TypeString,
+				ForceNew:      true, // Any time this changes, don't try to update in-place, just create it.
+				ConflictsWith: []string{"tags"},
+			},
+			"publish_mode": {
+				Description: "Where to publish the image: `registry` pushes it to `repo`; `daemon` loads it into the local Docker daemon as `ko.local/<importpath>`, for local development or loading into kind or minikube; `tarball` writes it to `tarball_path`, for `docker load`. For `daemon`, `image_ref` is the reference the daemon loaded the image as, and a multi-platform image is loaded for the platform in `GOOS` and `GOARCH`, or linux/amd64. For `tarball`, `image_ref` is the reference the built image would have if pushed to `repo`, though tarballs don't keep the image's manifest, so an image loaded from it has the same ID but may get a different digest when pushed; and only a single platform can be built. `tags` are applied in the daemon and the tarball too.",
+				Default:     "registry",
+				Optional:    true,
+				Type:        schema.TypeString,
+				ForceNew:    true, // Any time this changes, don't try to update in-place, just create it.
+				ValidateDiagFunc: func(data interface{}, _ cty.Path) diag.Diagnostics {
+					switch v := data.(string); v {
+					case "registry", "daemon", "tarball":
+						return nil
+					default:
+						return diag.Errorf(`invalid publish_mode %q: must be "registry", "daemon", or "tarball"`, v)
+					}
+				},
+			},
+			"tarball_path": {
+				Description: "Path to write the image's tarball to, with `publish_mode = \"tarball\"`.",
+				Optional:    true,
+				Type:        schema.TypeString,
+				ForceNew:    true, // Any time this changes, don't try to update in-place, just create it.
+			},
+			"push": {
+				Description: "If false, build the image without publishing it to the registry, to validate that it builds or to push it in a later step. `image_ref` is still the reference the image will have once pushed to `repo`, but nothing is pushed there, so `tags` can't be set. Combine with `oci_layout_dir` to keep the built image.",
+				Default:     true,
+				Optional:    true,
+				Type:        schema.TypeBool,
+				ForceNew:    true, // Any time this changes, don't try to update in-place, just create it.
+			},
+			"no_clobber_tags": {
+				Description: "If true, fail instead of publishing if any of `tags` (or `latest`, if no tags are set) already points to a different image. Use this to protect tags that are meant to be immutable from being overwritten.",
+				Default:     false,
+				Optional:    true,
+				Type:        schema.TypeBool,
+				ForceNew:    true, // Any time this changes, don't try to update in-place, just create it.
+			},
+			"sbom_upload": {
+				Description: "Whether to push the SBOM to the registry alongside the image. The SBOM is still generated, so the image is the same either way. Defaults to the provider's `sbom_upload`.",
+				Optional:    true,
+				Type:        schema.TypeBool,
+				ForceNew:    true, // Any time this changes, don't try to update in-place, just create it.
+			},
+			"entrypoint_prefix": {
+				Description:   "Command to run the Go binary with, such as an init process or wrapper. The image's entrypoint is set to these arguments followed by the path of the Go binary, in exec form, so the first element must be the absolute path of an executable in the base image; no shell is needed, so this works on distroless bases as long as the executable exists. Requires `sbom` to be `none`.",
+				Optional:      true,
+				Type:          schema.TypeList,
+				Elem:          &schema.Schema{Type: schema.TypeString},
+				ForceNew:      true, // Any time this changes, don't try to update in-place, just create it.
+				ConflictsWith: []string{"entrypoint"},
+			},
+			"entrypoint": {
+				Description: "Entrypoint to set in the image's config, in exec form, in place of the path of the Go binary that ko sets, for example to pass flags to the binary with `[\"/ko-app/<name>\", \"--flag\"]`. Set on every image of a multi-platform build. Requires `sbom` to be `none`.",
+				Optional:    true,
+				Type:        schema.TypeList,
+				Elem:        &schema.Schema{Type: schema.TypeString},
+				ForceNew:    true, // Any time this changes, don't try to update in-place, just create it.
+			},
+			"args": {
+				Description: "Command to set in the image's config, passed as arguments to the entrypoint unless overridden when the container is run. Set on every image of a multi-platform build. Requires `sbom` to be `none`.",
 				Optional:    true,
 				Type:        schema.TypeList,
 				Elem:        &schema.Schema{Type: schema.TypeString},
 				ForceNew:    true, // Any time this changes, don't try to update in-place, just create it.
 			},
+			"compat_docker_media_types": {
+				Description: "If true, publish the image with only Docker schema 2 media types, for older runtimes that reject OCI media types: a Docker manifest list instead of an OCI index, and Docker manifests, configs and layer media types instead of OCI ones. The layers and config are unchanged, but the digests differ. Requires `sbom` to be `none`.",
+				Optional:    true,
+				Default:     false,
+				Type:        schema.TypeBool,
+				ForceNew:    true, // Any time this changes, don't try to update in-place, just create it.
+			},
+			"force_index": {
+				Description: "If true, publish an image index even if only one platform is built, for tooling that expects an index. The index contains the single image, which is the same image that would be published otherwise. Without it, ko publishes a single image manifest whenever exactly one platform is built, even from a multi-platform base image.",
+				Optional:    true,
+				Default:     false,
+				Type:        schema.TypeBool,
+				ForceNew:    true, // Any time this changes, don't try to update in-place, just create it.
+			},
+			"arch_override": {
+				Description: "Architecture, as `arch` or `arch/variant` like `arm/v7`, to declare in the image's config instead of the platform it was built for. This makes a mismatched image whose binary doesn't match its declared platform, so it's only for testing tooling under emulation such as QEMU; applying it reports a warning. Requires building for a single platform, and `sbom` to be `none`.",
+				Optional:    true,
+				Type:        schema.TypeString,
+				ForceNew:    true, // Any time this changes, don't try to update in-place, just create it.
+				ValidateDiagFunc: func(data interface{}, _ cty.Path) diag.Diagnostics {
+					if _, _, err := parseArchOverride(data.(string)); err != nil {
+						return diag.Errorf("Invalid arch_override: %v", err)
+					}
+					return nil
+				},
+			},
+			"source_date_epoch": {
+				Description: "Creation time to build the image with, as a number of seconds since January 1st 1970, 00:00 UTC, for reproducible images. Overrides the `SOURCE_DATE_EPOCH` environment variable for this image only; if unset, `SOURCE_DATE_EPOCH` is used if set.",
+				Optional:    true,
+				Type:        schema.TypeString,
+				ForceNew:    true, // Any time this changes, don't try to update in-place, just create it.
+				ValidateDiagFunc: func(data interface{}, _ cty.Path) diag.Diagnostics {
+					v := data.(string)
+					if _, err := parseEpoch(v); err != nil {
+						return diag.Errorf("source_date_epoch should be the number of seconds since January 1st 1970, 00:00 UTC, got %q: %v", v, err)
+					}
+					return nil
+				},
+			},
+			"stop_signal": {
+				Description: "Signal, such as `SIGTERM`, that the container runtime should send to stop the container, set as the image config's `StopSignal`. Defaults to the base image's stop signal. Requires `sbom` to be `none`.",
+				Optional:    true,
+				Type:        schema.TypeString,
+				ForceNew:    true, // Any time this changes, don't try to update in-place, just create it.
+				ValidateDiagFunc: func(data interface{}, _ cty.Path) diag.Diagnostics {
+					v := data.(string)
+					if _, found := validStopSignals[v]; !found {
+						return diag.Errorf("Invalid stop_signal: %q", v)
+					}
+					return nil
+				},
+			},
+			"user": {
+				Description: "User, as `<user>[:<group>]` by name or ID, to run the container as, set as the image config's `User`. Defaults to the base image's user, which is the nonroot user `65532` for ko's default base image; set it to `0` or `root` to run as root.",
+				Optional:    true,
+				Type:        schema.TypeString,
+				ForceNew:    true, // Any time this changes, don't try to update in-place, just create it.
+			},
+			"ports": {
+				Description: "Ports, as `<port>[/<protocol>]` where the protocol is `tcp` (the default), `udp` or `sctp`, to add to the image config's `ExposedPorts`, along with those of the base image. This documents the ports the program listens on; it doesn't publish them. Requires `sbom` to be `none`.",
+				Optional:    true,
+				Type:        schema.TypeList,
+				Elem: &schema.Schema{
+					Type: schema.TypeString,
+					ValidateDiagFunc: func(data interface{}, _ cty.Path) diag.Diagnostics {
+						if _, err := exposedPort(data.(string)); err != nil {
+							return diag.Errorf("Invalid port: %v", err)
+						}
+						return nil
+					},
+				},
+				ForceNew: true, // Any time this changes, don't try to update in-place, just create it.
+			},
+			"reuse_unchanged": {
+				Description: "If true, record a hash of the source files, module dependencies, base image digest and build inputs in `source_hash`, and skip rebuilding the image when reading the resource if the hash is unchanged and the image still exists in the registry. This makes plans and applies much faster when nothing changed, at the cost of not noticing changes ko would pick up from outside the hashed inputs.",
+				Default:     false,
+				Optional:    true,
+				Type:        schema.TypeBool,
+				ForceNew:    true, // Any time this changes, don't try to update in-place, just create it.
+			},
+			"id_strategy": {
+				Description: "How the resource's ID is derived: `digest` uses the published image reference, `first_tag` uses the repository and first tag (or `latest`), and `importpath` uses the importpath. Changes to the built image are detected by comparing `image_ref` regardless of this setting.",
+				Default:     "digest",
+				Optional:    true,
+				Type:        schema.TypeString,
+				ForceNew:    true, // Any time this changes, don't try to update in-place, just create it.
+				ValidateDiagFunc: func(data interface{}, _ cty.Path) diag.Diagnostics {
+					v := data.(string)
+					if _, found := validIDStrategies[v]; !found {
+						return diag.Errorf("Invalid id_strategy: %q", v)
+					}
+					return nil
+				},
+			},
+			"image_refs": {
+				Description: "Single-platform image references by digest for each platform the image was built for, keyed by platform (for example `linux/arm64`). Use these to deploy a specific platform's image rather than the multi-platform index.",
+				Type:        schema.TypeMap,
+				Elem:        &schema.Schema{Type: schema.TypeString},
+				Computed:    true,
+			},
+			"platform_digests": {
+				Description: "Digests of the single-platform images for each platform the image was built for, keyed by platform (for example `linux/arm64`)",
+				Type:        schema.TypeMap,
+				Elem:        &schema.Schema{Type: schema.TypeString},
+				Computed:    true,
+			},
+			"media_type": {
+				Description: "Media type of the manifest `image_ref` refers to: an image index or manifest list if the image was built for multiple platforms or with `force_index`, otherwise an image manifest.",
+				Type:        schema.TypeString,
+				Computed:    true,
+			},
+			"index_digest": {
+				Description: "Digest of the multi-platform image index, if the image was built for multiple platforms or with `force_index`, and `image_ref` refers to an index. Empty for single-platform images. The index is reproducible: given the same source, base image and inputs, it lists the images in the base image's order, whatever the order of `platforms`, so its digest is the same from run to run.",
+				Type:        schema.TypeString,
+				Computed:    true,
+			},
+			"auth_source": {
+				Description: "Which credentials were used to publish the image: `resource_auth` (this resource's `basic_auth` or `token`), `basic_auth`, `bearer_token` (the provider's `bearer_token`, or a token in `basic_auth_env`), `docker_config_json`, `docker_config_dir`, `default` (the docker config file and credential helpers), `ecr`, `google`, `github`, `azure`, or `anonymous` if none provided credentials for the registry. Empty if the image was saved to `oci_layout_dir` or `push` is false. Use this to diagnose which credentials the provider picked.",
+				Type:        schema.TypeString,
+				Computed:    true,
+			},
+			"signature_ref": {
+				Description: "Reference to the tag where cosign stores signatures of the image, `repo:sha256-<hash>.sig`. The image is signed there if `sign` is set; otherwise, use this to point signing or verification tools at the cosign signature tag.",
+				Type:        schema.TypeString,
+				Computed:    true,
+			},
+			"attestation_ref": {
+				Description: "Reference to the tag where cosign stores attestations for the image, `repo:sha256-<hash>.att`. The image's provenance is attested to there if `attest` is set.",
+				Type:        schema.TypeString,
+				Computed:    true,
+			},
+			"tag_refs": {
+				Description: "Reference to the image by each tag that was applied, in `repo:tag@digest` form, keyed by tag. Includes `latest` if no `tags` were set, since ko applies it by default. Empty if the image was saved to `oci_layout_dir` or `push` is false.",
+				Type:        schema.TypeMap,
+				Elem:        &schema.Schema{Type: schema.TypeString},
+				Computed:    true,
+			},
+			"build_duration_ms": {
+				Description: "How long building the image took when it was created, in milliseconds. Informational only; it isn't updated when the resource is read.",
+				Type:        schema.TypeInt,
+				Computed:    true,
+			},
+			"publish_duration_ms": {
+				Description: "How long publishing the image took when it was created, in milliseconds, including saving it to `oci_layout_dir`. Informational only; it isn't updated when the resource is read.",
+				Type:        schema.TypeInt,
+				Computed:    true,
+			},
+			"source_hash": {
+				Description: "Hash of the source files, module dependencies, base image digest and build inputs the image was built from, if `reuse_unchanged` is set",
+				Type:        schema.TypeString,
+				Computed:    true,
+			},
+			"go_version": {
+				Description: "Version of Go the binary was built with",
+				Type:        schema.TypeString,
+				Computed:    true,
+			},
+			"modules": {
+				Description: "Go modules built into the binary, as reported by `go version -m`. Replaced modules report the replacement's version.",
+				Type:        schema.TypeList,
+				Computed:    true,
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"module": {
+							Description: "Module path",
+							Type:        schema.TypeString,
+							Computed:    true,
+						},
+						"version": {
+							Description: "Module version",
+							Type:        schema.TypeString,
+							Computed:    true,
+						},
+					},
+				},
+			},
+			"materials": {
+				Description: "Inputs the image was built from, for lightweight provenance: the base image, by name and digest; the version control revision of the main module, if the Go toolchain recorded one and the source had no uncommitted changes; and the Go toolchain version.",
+				Type:        schema.TypeList,
+				Computed:    true,
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"type": {
+							Description: "Kind of input: `base_image`, `source` or `toolchain`",
+							Type:        schema.TypeString,
+							Computed:    true,
+						},
+						"uri": {
+							Description: "The base image name, the version control system and main module path (for example `git+example.com/app`), or the Go version",
+							Type:        schema.TypeString,
+							Computed:    true,
+						},
+						"digest": {
+							Description: "Digest of the input in `algorithm:hex` form, like the base image digest or `sha1:<commit>`. Empty for the toolchain.",
+							Type:        schema.TypeString,
+							Computed:    true,
+						},
+					},
+				},
+			},
+			"effective_options": {
+				Description: "The effective options used to build the image, after provider, resource and environment defaults were applied",
+				Type:        schema.TypeList,
+				Computed:    true,
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"repo": {
+							Description: "Container repository the image was published to",
+							Type:        schema.TypeString,
+							Computed:    true,
+						},
+						"naming": {
+							Description: "Image naming strategy, either `bare` or `preserve_import_paths`",
+							Type:        schema.TypeString,
+							Computed:    true,
+						},
+						"base_image": {
+							Description: "Base image the image was built on, by digest",
+							Type:        schema.TypeString,
+							Computed:    true,
+						},
+						"platforms": {
+							Description: "Platforms the image was built for",
+							Type:        schema.TypeList,
+							Elem:        &schema.Schema{Type: schema.TypeString},
+							Computed:    true,
+						},
+						"ldflags": {
+							Description: "ldflags passed to the go build",
+							Type:        schema.TypeList,
+							Elem:        &schema.Schema{Type: schema.TypeString},
+							Computed:    true,
+						},
+						"env": {
+							Description: "Environment variables passed to the go build",
+							Type:        schema.TypeList,
+							Elem:        &schema.Schema{Type: schema.TypeString},
+							Computed:    true,
+						},
+						"sbom": {
+							Description: "The SBOM media type used",
+							Type:        schema.TypeString,
+							Computed:    true,
+						},
+						"tags": {
+							Description: "Tags applied to the published image",
+							Type:        schema.TypeList,
+							Elem:        &schema.Schema{Type: schema.TypeString},
+							Computed:    true,
+						},
+					},
+				},
+			},
 		},
 	}
 }
 
 type buildOptions struct {
-	ip         string
-	workingDir string
-	imageRepo  string // The image's repo, either from the KO_DOCKER_REPO env var, or provider-configured dockerRepo/repo, or image resource's repo.
-	platforms  []string
-	baseImage  string
-	sbom       string
-	auth       *authn.Basic
-	bare       bool     // If true, use the "bare" namer that doesn't append the importpath.
-	ldflags    []string // Extra ldflags to pass to the go build.
-	env        []string // Extra environment variables to pass to the go build.
-	tags       []string // Which tags to use for the produced image instead of the default 'latest'
+	ip               string
+	workingDir       string
+	imageRepo        string // The image's repo, either from the KO_DOCKER_REPO env var, or provider-configured dockerRepo/repo, or image resource's repo.
+	platforms        []string
+	baseImage        string
+	sbom             string
+	auth             *authn.AuthConfig
+	resourceAuth     *authn.AuthConfig   // If set, credentials for the registry of imageRepo, used ahead of auth and keychain.
+	keychain         []namedKeychain     // The provider's keychains, or nil to use the default keychains.
+	authSources      *authSources        // If set, records which keychain provided credentials for each registry.
+	transport        http.RoundTripper   // The provider's transport for registry requests, or nil to use the default transport.
+	insecure         bool                // If true, allow registries that use plain HTTP or certificates that can't be verified.
+	retryBackoff     remote.Backoff      // The provider's backoff for retrying registry requests, or zero Steps for the default.
+	bare             bool                // If true, use the "bare" namer that doesn't append the importpath.
+	ldflags          []string            // Extra ldflags to pass to the go build.
+	platformLdflags  map[string][]string // Extra ldflags to pass to the go build for specific platforms, instead of ldflags.
+	env              []string            // Extra environment variables to pass to the go build.
+	buildTags        []string            // Go build tags to pass to the go build.
+	gcflags          []string            // Extra gcflags to pass to the go build, each as a separate -gcflags.
+	asmflags         []string            // Extra asmflags to pass to the go build, each as a separate -asmflags.
+	noTrimpath       bool                // If true, build without -trimpath, keeping source paths in the binary.
+	koBuild          build.Config        // The ko config file's build config for ip, whose flags and linux_capabilities are used; its ldflags and env are already in ldflags and env.
+	tags             []string            // Which tags to use for the produced image instead of the default 'latest'
+	atomicTags       bool                // If true, roll back tags that were already set when publishing a later tag fails.
+	noClobberTags    bool                // If true, refuse to move tags that already point to a different image.
+	baseCache        *baseCache          // Cache of base image lookups, or nil to disable caching.
+	buildLimiter     *buildLimiter       // Bounds how many builds run at once, or nil for no limit.
+	idStrategy       string              // How the resource ID is derived; one of validIDStrategies.
+	ociLayoutDir     string              // If set, save the image to an OCI image layout here instead of publishing it.
+	noPush           bool                // If true, don't publish the image to the registry.
+	publishMode      string              // Where to publish the image: "registry", "daemon" or "tarball".
+	tarballPath      string              // If publishMode is "tarball", the path to write the tarball to.
+	tagOnly          bool                // If true, image_ref is repo:tag for the single tag, without the digest.
+	annotations      map[string]string   // Annotations to add to the image and index manifests.
+	runAnnotations   map[string]string   // The annotations identifying the Terraform run that created the image, included in annotations.
+	labels           map[string]string   // Labels to set in the image config.
+	race             bool                // If true, build with the race detector.
+	cgo              bool                // If true, build with cgo enabled.
+	intersectBase    bool                // If true, only build the platforms the base image provides.
+	reuseUnchanged   bool                // If true, skip rebuilding when reading if the source hash is unchanged.
+	stopSignal       string              // If set, the StopSignal to set in the image config.
+	user             string              // If set, the User to set in the image config.
+	ports            []string            // Ports to add to the image config's ExposedPorts.
+	imageEnv         map[string]string   // Environment variables to set in the image config, for the running container.
+	entrypointPrefix []string            // If set, arguments to prepend to the image's entrypoint.
+	entrypoint       []string            // If set, the entrypoint to set instead of the one ko sets.
+	args             []string            // If set, the command to set in the image's config.
+	noSBOMUpload     bool                // If true, don't push the generated SBOMs to the registry.
+	forceIndex       bool                // If true, publish an index even for a single platform.
+	archOverride     string              // If set, the arch or arch/variant to declare in the image's config instead of the one built for.
+	dockerMediaTypes bool                // If true, publish the image with Docker schema 2 media types only.
+	buildRetries     int                 // How many times to retry a build that fails with a transient toolchain error.
+	artifactRepo     string              // If set, the repository to push SBOMs to, and name signature and attestation tags in, instead of imageRepo.
+	artifactAuth     *authn.AuthConfig   // If set, credentials for the registry of artifactRepo.
+	signKey          string              // If set, the private key, as PEM or a path, to sign the published image with.
+	signPassword     string              // The password to decrypt signKey with.
+	attest           bool                // If true, attest to the provenance of the published image, signed with signKey.
+	kodataWarnSize   int64               // If positive, warn when kodata adds more than this many bytes to the image.
+	timeout          time.Duration       // If positive, how long building, and separately publishing, may take.
+
+	lenientSourceDateEpoch bool              // If true, ignore an invalid SOURCE_DATE_EPOCH instead of failing the build.
+	sourceDateEpoch        string            // If set, the creation time to build with, in seconds since the epoch, instead of SOURCE_DATE_EPOCH.
+	remoteBuildCache       *remoteBuildCache // If set, the Go build cache to build with.
+	saveBuildCache         bool              // If true, push remoteBuildCache after building, which only creating the resource does.
 }
 
 var (
 	amazonKeychain authn.Keychain = authn.NewKeychainFromHelper(ecr.NewECRHelper(ecr.WithLogger(io.Discard)))
 	azureKeychain  authn.Keychain = authn.NewKeychainFromHelper(credhelper.NewACRCredentialsHelper())
-	keychain                      = authn.NewMultiKeychain(
-		authn.DefaultKeychain,
-		amazonKeychain,
-		google.Keychain,
-		github.Keychain,
-		azureKeychain,
-	)
+	keychain                      = []namedKeychain{
+		{"default", authn.DefaultKeychain},
+		{"ecr", amazonKeychain},
+		{"google", google.Keychain},
+		{"github", github.Keychain},
+		{"azure", azureKeychain},
+	}
 )
 
+// authKeychain returns the keychain to use for registry requests, with the provider's basic auth, if any, scoped to the image's registry.
+func (o *buildOptions) authKeychain() authn.Keychain {
+	kc := o.keychain
+	if kc == nil {
+		kc = keychain
+	}
+	if o.auth != nil {
+		name := "basic_auth"
+		if o.auth.RegistryToken != "" {
+			name = "bearer_token"
+		}
+		kc = append([]namedKeychain{{name, staticKeychain{o.imageRepo, o.auth}}}, kc...)
+	}
+	if o.resourceAuth != nil {
+		kc = append([]namedKeychain{{"resource_auth", staticKeychain{o.imageRepo, o.resourceAuth}}}, kc...)
+	}
+	return multiKeychain{keychains: kc, sources: o.authSources}
+}
+
+// nameOptions returns the options to parse references to registries with.
+func (o *buildOptions) nameOptions() []name.Option {
+	if o.insecure {
+		return []name.Option{name.Insecure}
+	}
+	return nil
+}
+
+// remoteOptions returns the options to use for registry requests.
+func (o *buildOptions) remoteOptions(ctx context.Context) []remote.Option {
+	ropts := []remote.Option{
+		remote.WithAuthFromKeychain(o.authKeychain()),
+		remote.WithUserAgent(userAgent),
+		remote.WithContext(ctx),
+	}
+	if o.transport != nil {
+		ropts = append(ropts, remote.WithTransport(o.transport))
+	}
+	if o.retryBackoff.Steps > 0 {
+		// Each request is retried in exactly one place, with the provider's backoff: go-containerregistry sends uploads
+		// so that no transport retries them, and retries them itself, while the provider's transport retries the rest.
+		// No status codes are passed here, so go-containerregistry's own transport doesn't retry them a second time.
+		ropts = append(ropts, remote.WithRetryBackoff(o.retryBackoff), remote.WithRetryStatusCodes())
+	}
+	return ropts
+}
+
+// baseCacheKey returns the key the base image lookup is cached under: the base image reference as written, with the sorted platforms,
+// so that builds of the same base for different platforms don't share a lookup.
+func (o *buildOptions) baseCacheKey() string {
+	return o.baseImage + " " + strings.Join(slices.Sorted(slices.Values(o.platforms)), ",")
+}
+
+// fetchBase returns the base image or index, from the cache if possible.
+func (o *buildOptions) fetchBase() (name.Reference, build.Result, error) {
+	ref, err := name.ParseReference(o.baseImage, o.nameOptions()...)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	key := o.baseCacheKey()
+	if cached, found := o.baseCache.Load(key); found {
+		return ref, cached, nil
+	}
+
+	desc, err := remote.Get(ref, o.remoteOptions(context.Background())...)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := checkBaseDescriptor(desc); err != nil {
+		return nil, nil, fmt.Errorf("base image %s: %w", o.baseImage, err)
+	}
+	_, pinned := ref.(name.Digest)
+	if desc.MediaType.IsImage() {
+		img, err := desc.Image()
+		if err != nil {
+			return nil, nil, err
+		}
+		o.baseCache.Store(key, img, pinned)
+		return ref, img, nil
+	}
+	if desc.MediaType.IsIndex() {
+		idx, err := desc.ImageIndex()
+		if err != nil {
+			return nil, nil, err
+		}
+		o.baseCache.Store(key, idx, pinned)
+		return ref, idx, nil
+	}
+	return nil, nil, fmt.Errorf("unexpected base image media type: %s; base_image must be a container image or image index", desc.MediaType)
+}
+
+// fetchBaseContext is fetchBase, but stops waiting when ctx is done. The fetch itself isn't cancelled,
+// since the base it returns is cached and shared with other builds.
+func (o *buildOptions) fetchBaseContext(ctx context.Context) (name.Reference, build.Result, error) {
+	type fetched struct {
+		ref  name.Reference
+		base build.Result
+		err  error
+	}
+	ch := make(chan fetched, 1)
+	go func() {
+		ref, base, err := o.fetchBase()
+		ch <- fetched{ref, base, err}
+	}()
+	select {
+	case f := <-ch:
+		return f.ref, f.base, f.err
+	case <-ctx.Done():
+		return nil, nil, fmt.Errorf("fetching base image %s: %w", o.baseImage, ctx.Err())
+	}
+}
+
+// restrictToBasePlatforms removes the platforms the base image doesn't provide from o.platforms, and returns the removed platforms.
+// It fails if the base image provides none of them.
+func (o *buildOptions) restrictToBasePlatforms(ctx context.Context) ([]string, error) {
+	kept, dropped, _, err := o.matchBasePlatforms(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if len(dropped) == 0 {
+		return nil, nil
+	}
+	if len(kept) == 0 {
+		return nil, fmt.Errorf("base image %s provides none of the platforms %s", o.baseImage, strings.Join(o.platforms, ", "))
+	}
+	o.platforms = kept
+	return dropped, nil
+}
+
+// checkBasePlatforms returns an error listing the platforms in o.platforms that the base image doesn't provide, if any,
+// so the build fails before compiling anything.
+func (o *buildOptions) checkBasePlatforms(ctx context.Context) error {
+	_, missing, available, err := o.matchBasePlatforms(ctx)
+	if err != nil {
+		return err
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+	provided := make([]string, len(available))
+	for i, p := range available {
+		provided[i] = p.String()
+	}
+	return fmt.Errorf("base image %s does not provide platforms %s; it provides %s. Change platforms, or set intersect_base_platforms to skip the missing ones",
+		o.baseImage, strings.Join(missing, ", "), strings.Join(provided, ", "))
+}
+
+// singlePlatformBaseWarning returns a warning if o.platforms is "all" but the base image is a single image rather than an index,
+// since ko then builds only the base image's platform, or "" otherwise.
+func (o *buildOptions) singlePlatformBaseWarning(ctx context.Context) (string, error) {
+	if !slices.Contains(o.platforms, "all") {
+		return "", nil
+	}
+	_, base, err := o.fetchBaseContext(ctx)
+	if err != nil {
+		return "", err
+	}
+	if _, ok := base.(v1.ImageIndex); ok {
+		return "", nil
+	}
+	available, err := basePlatforms(base)
+	if err != nil {
+		return "", fmt.Errorf("reading platforms of base image %s: %w", o.baseImage, err)
+	}
+	return fmt.Sprintf(`platforms = ["all"] builds every platform the base image provides, but base image %s is a single-platform image rather than an image index, so only %s is built. Use a multi-platform base image to build more platforms.`,
+		o.baseImage, available[0]), nil
+}
+
+// matchBasePlatforms splits o.platforms into those the base image provides and those it doesn't, and returns the platforms it provides.
+// With platforms "all", ko builds exactly the platforms the base image provides, so nothing is missing.
+func (o *buildOptions) matchBasePlatforms(ctx context.Context) (matched, missing []string, available []v1.Platform, err error) {
+	if slices.Contains(o.platforms, "all") {
+		return o.platforms, nil, nil, nil
+	}
+	_, base, err := o.fetchBaseContext(ctx)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	available, err = basePlatforms(base)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("reading platforms of base image %s: %w", o.baseImage, err)
+	}
+
+	for _, p := range o.platforms {
+		want, err := v1.ParsePlatform(p)
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("parsing platform %q: %w", p, err)
+		}
+		if slices.ContainsFunc(available, func(a v1.Platform) bool { return a.Satisfies(*want) }) {
+			matched = append(matched, p)
+		} else {
+			missing = append(missing, p)
+		}
+	}
+	return matched, missing, available, nil
+}
+
+// basePlatforms returns the platforms provided by a base image or index.
+func basePlatforms(base build.Result) ([]v1.Platform, error) {
+	switch base := base.(type) {
+	case v1.ImageIndex:
+		m, err := base.IndexManifest()
+		if err != nil {
+			return nil, err
+		}
+		var out []v1.Platform
+		for _, desc := range m.Manifests {
+			if desc.Platform != nil {
+				out = append(out, *desc.Platform)
+			}
+		}
+		return out, nil
+	case v1.Image:
+		cf, err := base.ConfigFile()
+		if err != nil {
+			return nil, err
+		}
+		return []v1.Platform{*cf.Platform()}, nil
+	}
+	return nil, fmt.Errorf("unexpected base image type %T", base)
+}
+
+func (o *buildOptions) buildConfig() (build.Config, error) {
+	ldflags, err := perPlatformLdflags(o.ldflags, o.platformLdflags)
+	if err != nil {
+		return build.Config{}, err
+	}
+	c := build.Config{
+		Ldflags:           ldflags,
+		Env:               o.env,
+		Flags:             slices.Clone(o.koBuild.Flags),
+		LinuxCapabilities: o.koBuild.LinuxCapabilities,
+	}
+	if len(o.buildTags) > 0 {
+		c.Flags = append(c.Flags, "-tags="+strings.Join(o.buildTags, ","))
+	}
+	// ko's build config has no fields for these, so pass them as flags.
+	for _, f := range o.gcflags {
+		c.Flags = append(c.Flags, "-gcflags="+f)
+	}
+	for _, f := range o.asmflags {
+		c.Flags = append(c.Flags, "-asmflags="+f)
+	}
+	if o.race {
+		c.Flags = append(c.Flags, "-race")
+	}
+	if o.race || o.cgo {
+		// The race detector requires cgo, which ko disables by default.
+		c.Env = append(append([]string{}, c.Env...), "CGO_ENABLED=1")
+	}
+	return c, nil
+}
+
 func (o *buildOptions) makeBuilder(ctx context.Context) (*build.Caching, error) {
+	config, err := o.buildConfig()
+	if err != nil {
+		return nil, err
+	}
 	bo := []build.Option{
-		build.WithTrimpath(true),
+		build.WithTrimpath(!o.noTrimpath),
 		build.WithPlatforms(o.platforms...),
 		build.WithConfig(map[string]build.Config{
-			o.ip: {
-				Ldflags: o.ldflags,
-				Env:     o.env,
-			}}),
-		build.WithBaseImages(func(_ context.Context, _ string) (name.Reference, build.Result, error) {
-			ref, err := name.ParseReference(o.baseImage)
-			if err != nil {
-				return nil, nil, err
-			}
+			o.ip: config,
+		}),
+		build.WithBaseImages(func(ctx context.Context, _ string) (name.Reference, build.Result, error) {
+			return o.fetchBaseContext(ctx)
+		}),
+	}
+	if o.user != "" {
+		bo = append(bo, build.WithUser(o.user))
+	}
+
+	for k, v := range o.annotations {
+		bo = append(bo, build.WithAnnotation(k, v))
+	}
+	for k, v := range o.labels {
+		bo = append(bo, build.WithLabel(k, v))
+	}
+
+	switch o.sbom {
+	case "spdx":
+		bo = append(bo, build.WithSPDX(version))
+	case "none":
+		bo = append(bo, build.WithDisabledSBOM())
+	default:
+		return nil, fmt.Errorf("unknown sbom type: %q", o.sbom)
+	}
+
+	// We read the environment variable directly here instead of plumbing it through as a provider option to keep the behavior consistent with resolve.
+	// While CreationTime is a build.Option, it is not a field in options.BuildOptions and is inferred from the environment variable when a new resolver is created.
+	// The resource's source_date_epoch takes precedence, and is validated in the schema, so leniency only applies to the environment variable.
+	if t, err := o.creationTime(); err != nil && (o.sourceDateEpoch != "" || !o.lenientSourceDateEpoch) {
+		return nil, err
+	} else if t != nil {
+		bo = append(bo, build.WithCreationTime(*t))
+	}
+
+	b, err := build.NewGo(ctx, o.workingDir, bo...)
+	if err != nil {
+		return nil, fmt.Errorf("NewGo: %w", err)
+	}
+	return build.NewCaching(b)
+}
+
+// sourceDateEpoch returns the creation time from the SOURCE_DATE_EPOCH environment variable, or nil if it isn't set.
+func sourceDateEpoch() (*v1.Time, error) {
+	epoch := os.Getenv("SOURCE_DATE_EPOCH")
+	if epoch == "" {
+		return nil, nil
+	}
+	t, err := parseEpoch(epoch)
+	if err != nil {
+		return nil, fmt.Errorf("the environment variable SOURCE_DATE_EPOCH should be the number of seconds since January 1st 1970, 00:00 UTC, got %q: %w", epoch, err)
+	}
+	return t, nil
+}
+
+// parseEpoch parses a number of seconds since the Unix epoch, as in SOURCE_DATE_EPOCH.
+func parseEpoch(epoch string) (*v1.Time, error) {
+	s, err := strconv.ParseInt(epoch, 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	return &v1.Time{Time: time.Unix(s, 0)}, nil
+}
+
+// creationTime returns the creation time to build with: the resource's source_date_epoch if set, otherwise SOURCE_DATE_EPOCH, or nil if neither is.
+func (o *buildOptions) creationTime() (*v1.Time, error) {
+	if o.sourceDateEpoch == "" {
+		return sourceDateEpoch()
+	}
+	t, err := parseEpoch(o.sourceDateEpoch)
+	if err != nil {
+		return nil, fmt.Errorf("source_date_epoch should be the number of seconds since January 1st 1970, 00:00 UTC, got %q: %w", o.sourceDateEpoch, err)
+	}
+	return t, nil
+}
+
+// sourceDateEpochWarnings returns a warning if SOURCE_DATE_EPOCH is invalid and is being ignored because of the provider's lenient_source_date_epoch.
+func sourceDateEpochWarnings(opts buildOptions) diag.Diagnostics {
+	if !opts.lenientSourceDateEpoch || opts.sourceDateEpoch != "" {
+		return nil
+	}
+	if _, err := sourceDateEpoch(); err != nil {
+		return diag.Diagnostics{{
+			Severity: diag.Warning,
+			Summary:  "Ignoring invalid SOURCE_DATE_EPOCH",
+			Detail:   fmt.Sprintf("%v; the image was built with the default creation time.", err),
+		}}
+	}
+	return nil
+}
+
+const (
+	// ociArtifactManifest is the artifact manifest media type from the OCI 1.1 release candidates, which was dropped from the final spec.
+	ociArtifactManifest types.MediaType = "application/vnd.oci.artifact.manifest.v1+json"
+	// ociEmptyJSON is the config media type OCI 1.1 artifacts use when they have no config.
+	ociEmptyJSON types.MediaType = "application/vnd.oci.empty.v1+json"
+)
+
+// checkBaseDescriptor returns an actionable error if desc is an OCI 1.1 artifact rather than a runnable image or index.
+func checkBaseDescriptor(desc *remote.Descriptor) error {
+	if desc.MediaType == ociArtifactManifest {
+		return fmt.Errorf("media type %s is an OCI artifact manifest, not a container image; base_image must be a container image or image index", desc.MediaType)
+	}
+	if !desc.MediaType.IsImage() {
+		return nil
+	}
+	m, err := v1.ParseManifest(bytes.NewReader(desc.Manifest))
+	if err != nil {
+		return fmt.Errorf("parsing manifest: %w", err)
+	}
+	switch m.Config.MediaType {
+	case types.OCIConfigJSON, types.DockerConfigJSON:
+		return nil
+	case ociEmptyJSON:
+		return fmt.Errorf("manifest has an empty config (%s), so it is an OCI artifact and not a container image; base_image must be a container image or image index", ociEmptyJSON)
+	default:
+		return fmt.Errorf("manifest config media type %s is not a container image config, so it is likely an OCI artifact; base_image must be a container image or image index", m.Config.MediaType)
+	}
+}
+
+// doBuild builds the image and returns the built image, and the full name.Reference by digest that the image would be pushed to.
+//
+// doBuild doesn't publish images, use doPublish to publish the build.Result that doBuild returns.
+func doBuild(ctx context.Context, opts buildOptions) (build.Result, string, error) {
+	if opts.imageRepo == "" {
+		return nil, "", errors.New("one of KO_DOCKER_REPO env var, or provider `repo`, or image resource `repo` must be set")
+	}
+
+	if err := opts.checkBasePlatforms(ctx); err != nil {
+		return nil, "", err
+	}
+	kodata, err := kodataDir(ctx, opts)
+	if err != nil {
+		return nil, "", fmt.Errorf("finding kodata: %w", err)
+	}
+	ignore, err := readKoignore(kodata)
+	if err != nil {
+		return nil, "", fmt.Errorf("reading %s: %w", koignoreFile, err)
+	}
+	if ignore != nil && opts.sbom != "none" {
+		return nil, "", errSBOMIncompatible("kodata/" + koignoreFile)
+	}
+
+	if opts.remoteBuildCache != nil {
+		dir, err := opts.remoteBuildCache.restore(ctx, opts)
+		if err != nil {
+			return nil, "", fmt.Errorf("creating build cache directory: %w", err)
+		}
+		if opts.saveBuildCache {
+			defer opts.remoteBuildCache.save(ctx, opts)
+		}
+		opts.env = append(slices.Clip(opts.env), "GOCACHE="+dir)
+	}
+
+	var res build.Result
+	for attempt := 0; ; attempt++ {
+		// Make a new builder for each attempt, since the builder caches failed builds too.
+		b, err := opts.makeBuilder(ctx)
+		if err != nil {
+			return nil, "", fmt.Errorf("NewGo: %w", err)
+		}
+		if err := opts.buildLimiter.acquire(ctx); err != nil {
+			return nil, "", fmt.Errorf("waiting to build: %w", err)
+		}
+		res, err = b.Build(ctx, opts.ip)
+		opts.buildLimiter.release()
+		if err == nil {
+			break
+		}
+		if attempt >= opts.buildRetries || !isTransientBuildError(err) {
+			return nil, "", fmt.Errorf("build: %w", err)
+		}
+		log.Printf("[WARN] building %s failed with what looks like a transient error, retrying (%d of %d): %v", opts.ip, attempt+1, opts.buildRetries, err)
+		select {
+		case <-ctx.Done():
+			return nil, "", fmt.Errorf("build: %w", err)
+		case <-time.After(buildRetryDelay * time.Duration(attempt+1)):
+		}
+	}
+	if ignore != nil {
+		if res, err = withKoignore(res, ignore); err != nil {
+			return nil, "", fmt.Errorf("applying %s: %w", koignoreFile, err)
+		}
+	}
+	if len(opts.entrypointPrefix) > 0 {
+		if res, err = withEntrypointPrefix(res, opts.entrypointPrefix); err != nil {
+			return nil, "", fmt.Errorf("setting entrypoint: %w", err)
+		}
+	}
+	if len(opts.entrypoint) > 0 || len(opts.args) > 0 {
+		if res, err = withEntrypoint(res, opts.entrypoint, opts.args); err != nil {
+			return nil, "", fmt.Errorf("setting entrypoint: %w", err)
+		}
+	}
+	if opts.stopSignal != "" {
+		if res, err = withStopSignal(res, opts.stopSignal); err != nil {
+			return nil, "", fmt.Errorf("setting stop signal: %w", err)
+		}
+	}
+	if len(opts.ports) > 0 {
+		if res, err = withExposedPorts(res, opts.ports); err != nil {
+			return nil, "", fmt.Errorf("setting exposed ports: %w", err)
+		}
+	}
+	if len(opts.imageEnv) > 0 {
+		if res, err = withImageEnv(res, opts.imageEnv); err != nil {
+			return nil, "", fmt.Errorf("setting image env: %w", err)
+		}
+	}
+	if opts.archOverride != "" {
+		if res, err = withArchOverride(res, opts.archOverride); err != nil {
+			return nil, "", fmt.Errorf("overriding architecture: %w", err)
+		}
+	}
+	if opts.dockerMediaTypes {
+		if res, err = withDockerMediaTypes(res); err != nil {
+			return nil, "", fmt.Errorf("converting to Docker media types: %w", err)
+		}
+	}
+	if opts.forceIndex {
+		if res, err = wrapInIndex(res); err != nil {
+			return nil, "", fmt.Errorf("wrapping in index: %w", err)
+		}
+	}
+	dig, err := res.Digest()
+	if err != nil {
+		return nil, "", fmt.Errorf("digest: %w", err)
+	}
+	ref, err := name.ParseReference(namer(opts)(opts.imageRepo, opts.ip))
+	if err != nil {
+		return nil, "", fmt.Errorf("ParseReference: %w", err)
+	}
+
+	return res, ref.Context().Digest(dig.String()).String(), nil
+}
+
+func namer(opts buildOptions) publish.Namer {
+	return options.MakeNamer(&options.PublishOptions{
+		DockerRepo:          opts.imageRepo,
+		Bare:                opts.bare,
+		PreserveImportPaths: !opts.bare,
+		Tags:                opts.tags,
+	})
+}
+
+// resolveImportpath returns the fully-qualified import path ko builds for opts.ip, without the ko:// scheme.
+func resolveImportpath(ctx context.Context, opts buildOptions) (string, error) {
+	b, err := opts.makeBuilder(ctx)
+	if err != nil {
+		return "", fmt.Errorf("NewGo: %w", err)
+	}
+	ip, err := b.QualifyImport(opts.ip)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimPrefix(ip, build.StrictScheme), nil
+}
+
+// importQualifier qualifies importpaths as written in a resource, relative to workingDir, like ko does.
+// It only creates the builder that lists packages once, and only for importpaths that are relative.
+type importQualifier struct {
+	ctx        context.Context
+	workingDir string
+	b          build.Interface
+}
+
+// qualify returns the fully-qualified form of the importpath ip, without the ko:// scheme.
+func (q *importQualifier) qualify(ip string) (string, error) {
+	ip = strings.TrimPrefix(ip, build.StrictScheme)
+	if !gobuild.IsLocalImport(ip) {
+		return ip, nil
+	}
+	if q.b == nil {
+		b, err := build.NewGo(q.ctx, q.workingDir,
+			build.WithBaseImages(func(context.Context, string) (name.Reference, build.Result, error) {
+				return nil, nil, errors.New("qualifyImport doesn't build")
+			}))
+		if err != nil {
+			return "", fmt.Errorf("NewGo: %w", err)
+		}
+		q.b = b
+	}
+	qualified, err := q.b.QualifyImport(ip)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimPrefix(qualified, build.StrictScheme), nil
+}
+
+// qualifyImport returns the fully-qualified form of the importpath ip, as written in a resource, without the ko:// scheme.
+// Like ko, it only needs to list the package if ip is relative to workingDir.
+func qualifyImport(ctx context.Context, ip, workingDir string) (string, error) {
+	return (&importQualifier{ctx: ctx, workingDir: workingDir}).qualify(ip)
+}
+
+// baseImageOverride returns the base image in overrides for the importpath ip, whether or not ip and the keys of overrides
+// are relative to workingDir, since like ko's baseImageOverrides, they're compared as fully-qualified import paths.
+// Relative keys that don't resolve to a package from workingDir are for other resources, so they're skipped.
+// It fails if more than one key is for ip, with different base images.
+func baseImageOverride(ctx context.Context, overrides map[string]string, ip, workingDir string) (string, bool, error) {
+	if len(overrides) == 0 {
+		return "", false, nil
+	}
+	q := &importQualifier{ctx: ctx, workingDir: workingDir}
+	qualified, err := q.qualify(ip)
+	if err != nil {
+		return "", false, fmt.Errorf("qualifying importpath %s: %w", ip, err)
+	}
+	var found string
+	for _, k := range slices.Sorted(maps.Keys(overrides)) {
+		qk, err := q.qualify(k)
+		if err != nil || qk != qualified {
+			continue
+		}
+		if found != "" && overrides[found] != overrides[k] {
+			return "", false, fmt.Errorf("base_image_overrides keys %q and %q are both for %s, with different base images", found, k, qualified)
+		}
+		found = k
+	}
+	if found == "" {
+		return "", false, nil
+	}
+	return overrides[found], true, nil
+}
 
-			if cached, found := baseImages.Load(o.baseImage); found {
-				return ref, cached.(build.Result), nil
+// repoTemplateData is the data available to the provider's repo_template.
+type repoTemplateData struct {
+	Repo       string
+	ImportPath string
+	workingDir string
+}
+
+// Basename is the last element of the importpath.
+func (d repoTemplateData) Basename() string { return path.Base(d.ImportPath) }
+
+// Module is the path of the Go module containing the importpath.
+// It's only looked up if the template uses it, since that lists the package.
+func (d repoTemplateData) Module() (string, error) {
+	gobin := os.Getenv("KO_GO_PATH")
+	if gobin == "" {
+		gobin = "go"
+	}
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command(gobin, "list", "-f", "{{with .Module}}{{.Path}}{{end}}", d.ImportPath) //nolint: gosec // Same go invocation ko makes.
+	cmd.Dir = d.workingDir
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("go list %s: %w: %s", d.ImportPath, err, stderr.String())
+	}
+	module := strings.TrimSpace(stdout.String())
+	if module == "" {
+		return "", fmt.Errorf("no module found for %s", d.ImportPath)
+	}
+	return module, nil
+}
+
+func executeRepoTemplate(ctx context.Context, t *template.Template, repo, ip, workingDir string) (string, error) {
+	qualified, err := qualifyImport(ctx, ip, workingDir)
+	if err != nil {
+		return "", fmt.Errorf("qualifying importpath %s: %w", ip, err)
+	}
+	data := repoTemplateData{
+		Repo:       repo,
+		ImportPath: qualified,
+		workingDir: workingDir,
+	}
+
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("executing repo_template: %w", err)
+	}
+	return buf.String(), nil
+}
+
+func doPublish(ctx context.Context, r build.Result, opts buildOptions) (string, map[string]string, error) {
+	if opts.artifactRepo != "" {
+		// Publish the image without its SBOMs, then push those to the artifact repo.
+		io := opts
+		io.artifactRepo = ""
+		ref, refs, err := doPublish(ctx, withoutSBOMs(r), io)
+		if err != nil {
+			return "", nil, err
+		}
+		if !opts.noSBOMUpload {
+			if err := uploadSBOMs(ctx, r, opts); err != nil {
+				return "", nil, fmt.Errorf("uploading SBOMs to %s: %w", opts.artifactRepo, err)
 			}
+		}
+		return ref, refs, nil
+	}
+
+	po := []publish.Option{
+		publish.WithAuthFromKeychain(opts.authKeychain()),
+		publish.WithNamer(namer(opts)),
+		publish.WithUserAgent(userAgent),
+	}
+	if opts.transport != nil {
+		po = append(po, publish.WithTransport(opts.transport))
+	}
+	if opts.insecure {
+		po = append(po, publish.Insecure(true))
+	}
+
+	ropts := opts.remoteOptions(ctx)
+	if opts.noSBOMUpload {
+		r = withoutSBOMs(r)
+	}
+	ref, err := name.ParseReference(namer(opts)(opts.imageRepo, opts.ip), opts.nameOptions()...)
+	if err != nil {
+		return "", nil, fmt.Errorf("ParseReference: %w", err)
+	}
+	tags := opts.tags
+	if len(tags) == 0 {
+		tags = []string{"latest"} // ko's default tag.
+	}
+	dig, err := r.Digest()
+	if err != nil {
+		return "", nil, fmt.Errorf("digest: %w", err)
+	}
+	if opts.noClobberTags {
+		if err := checkNoClobber(ref.Context(), tags, dig, ropts); err != nil {
+			return "", nil, err
+		}
+	}
+
+	if len(opts.tags) <= 1 {
+		if len(opts.tags) > 0 {
+			po = append(po, publish.WithTags(opts.tags))
+		}
+
+		p, err := publish.NewDefault(opts.imageRepo, po...)
+		if err != nil {
+			return "", nil, fmt.Errorf("NewDefault: %w", err)
+		}
+		ref, err := p.Publish(ctx, r, opts.ip)
+		if err != nil {
+			return "", nil, fmt.Errorf("publish: %w", err)
+		}
+		return ref.String(), tagRefs(ref.Context(), tags, dig), nil
+	}
+
+	// With multiple tags, only publish the first tag with ko, and apply the rest ourselves
+	// one at a time, so we know exactly which tags were set if any of them fail.
+	prev, err := opts.snapshotTags(ref.Context(), opts.tags, ropts)
+	if err != nil {
+		return "", nil, fmt.Errorf("reading existing tags: %w", err)
+	}
 
-			kc := keychain
-			if o.auth != nil {
-				kc = authn.NewMultiKeychain(staticKeychain{o.imageRepo, o.auth}, kc)
+	po = append(po, publish.WithTags(opts.tags[:1]))
+	p, err := publish.NewDefault(opts.imageRepo, po...)
+	if err != nil {
+		return "", nil, fmt.Errorf("NewDefault: %w", err)
+	}
+	if _, err := p.Publish(ctx, r, opts.ip); err != nil {
+		return "", nil, fmt.Errorf("publish: %w (no tags were set)", err)
+	}
+	if err := setTags(ref.Context(), r, opts.tags, 1, prev, opts.atomicTags, ropts); err != nil {
+		return "", nil, err
+	}
+
+	return ref.Context().Digest(dig.String()).String(), tagRefs(ref.Context(), tags, dig), nil
+}
+
+// tagRefs returns the reference to dig by each of tags in repo, in repo:tag@digest form, keyed by tag.
+func tagRefs(repo name.Repository, tags []string, dig v1.Hash) map[string]string {
+	refs := make(map[string]string, len(tags))
+	for _, tag := range tags {
+		refs[tag] = fmt.Sprintf("%s:%s@%s", repo, tag, dig)
+	}
+	return refs
+}
+
+// setTags points tags[set:] in repo at t one at a time, where tags[:set] have already been set.
+// If a tag fails and atomic is true, the tags that were set are restored to what they pointed to in prev.
+func setTags(repo name.Repository, t remote.Taggable, tags []string, set int, prev map[string]*remote.Descriptor, atomic bool, ropts []remote.Option) error {
+	for i := set; i < len(tags); i++ {
+		tag := tags[i]
+		if err := remote.Tag(repo.Tag(tag), t, ropts...); err != nil {
+			set, unset := tags[:i], tags[i:]
+			if !atomic {
+				return fmt.Errorf("tagging %q: %w (tags set: %v, tags not set: %v)", tag, err, set, unset)
 			}
-			desc, err := remote.Get(ref,
-				remote.WithAuthFromKeychain(kc),
-				remote.WithUserAgent(userAgent),
-			)
-			if err != nil {
-				return nil, nil, err
+			if rerr := rollbackTags(repo, set, prev, ropts); rerr != nil {
+				return fmt.Errorf("tagging %q: %w (tags set: %v, tags not set: %v; rollback failed: %w)", tag, err, set, unset, rerr)
 			}
-			if desc.MediaType.IsImage() {
-				img, err := desc.Image()
-				baseImages.Store(o.baseImage, img)
-				return ref, img, err
+			return fmt.Errorf("tagging %q: %w (tags rolled back: %v)", tag, err, set)
+		}
+	}
+	return nil
+}
+
+// retag points opts.tags (or latest, if no tags are set) at the already published image ref, without rebuilding it,
+// and returns the image reference ko would have returned had it published the image with those tags.
+func retag(ctx context.Context, ref name.Digest, opts buildOptions) (string, map[string]string, error) {
+	ropts := opts.remoteOptions(ctx)
+	tags := opts.tags
+	if len(tags) == 0 {
+		tags = []string{"latest"} // ko's default tag.
+	}
+
+	desc, err := remote.Get(ref, ropts...)
+	if err != nil {
+		return "", nil, fmt.Errorf("getting %s: %w", ref, err)
+	}
+	if opts.noClobberTags {
+		if err := checkNoClobber(ref.Context(), tags, desc.Digest, ropts); err != nil {
+			return "", nil, err
+		}
+	}
+	prev, err := opts.snapshotTags(ref.Context(), tags, ropts)
+	if err != nil {
+		return "", nil, fmt.Errorf("reading existing tags: %w", err)
+	}
+	if err := setTags(ref.Context(), desc, tags, 0, prev, opts.atomicTags, ropts); err != nil {
+		return "", nil, err
+	}
+
+	// Like ko, include the tag in the reference if a single tag other than latest is set.
+	if len(opts.tags) == 1 && opts.tags[0] != "latest" {
+		return fmt.Sprintf("%s:%s@%s", ref.Context(), opts.tags[0], desc.Digest), tagRefs(ref.Context(), tags, desc.Digest), nil
+	}
+	return ref.Context().Digest(desc.Digest.String()).String(), tagRefs(ref.Context(), tags, desc.Digest), nil
+}
+
+// withoutSBOMs hides the SBOMs ko attached to r, so that publishing it pushes only the image or index.
+// Attachments don't affect the image's digest.
+func withoutSBOMs(r build.Result) build.Result {
+	switch r := r.(type) {
+	case v1.ImageIndex:
+		return struct{ imageIndex }{r}
+	case v1.Image:
+		return struct{ v1.Image }{r}
+	}
+	return r
+}
+
+// imageIndex is embedded instead of v1.ImageIndex, whose field name would hide its ImageIndex method,
+// so that the wrapper is still an index and publishing it pushes its images too.
+type imageIndex = v1.ImageIndex
+
+// checkNoClobber returns an error if any of the tags in repo already exist and point to a digest other than dig.
+func checkNoClobber(repo name.Repository, tags []string, dig v1.Hash, ropts []remote.Option) error {
+	var clobbered []string
+	for _, t := range tags {
+		desc, err := remote.Head(repo.Tag(t), ropts...)
+		if err != nil {
+			var terr *transport.Error
+			if errors.As(err, &terr) && terr.StatusCode == http.StatusNotFound {
+				continue
 			}
-			if desc.MediaType.IsIndex() {
-				idx, err := desc.ImageIndex()
-				baseImages.Store(o.baseImage, idx)
-				return ref, idx, err
+			return fmt.Errorf("checking tag %q: %w", t, err)
+		}
+		if desc.Digest != dig {
+			clobbered = append(clobbered, fmt.Sprintf("%s (%s)", t, desc.Digest))
+		}
+	}
+	if len(clobbered) > 0 {
+		return fmt.Errorf("no_clobber_tags is set and tags already point to a different image: %s; no tags were set", strings.Join(clobbered, ", "))
+	}
+	return nil
+}
+
+// snapshotTags records what each tag in repo currently points to, so that it can be restored by rollbackTags.
+// Tags that don't exist yet are recorded as nil.
+func snapshotTags(repo name.Repository, tags []string, ropts []remote.Option) (map[string]*remote.Descriptor, error) {
+	prev := make(map[string]*remote.Descriptor, len(tags))
+	for _, t := range tags {
+		desc, err := remote.Get(repo.Tag(t), ropts...)
+		if err != nil {
+			var terr *transport.Error
+			if errors.As(err, &terr) && terr.StatusCode == http.StatusNotFound {
+				prev[t] = nil
+				continue
 			}
-			return nil, nil, fmt.Errorf("unexpected base image media type: %s", desc.MediaType)
-		}),
+			return nil, fmt.Errorf("getting %q: %w", t, err)
+		}
+		prev[t] = desc
+	}
+	return prev, nil
+}
+
+// snapshotTags snapshots the tags only when atomic_tags is set, since the snapshot is only used to roll them back.
+// Otherwise it returns nil without a request per tag.
+func (o *buildOptions) snapshotTags(repo name.Repository, tags []string, ropts []remote.Option) (map[string]*remote.Descriptor, error) {
+	if !o.atomicTags {
+		return nil, nil
+	}
+	return snapshotTags(repo, tags, ropts)
+}
+
+// rollbackTags restores each of the tags to what it pointed to in prev, deleting tags that didn't previously exist.
+func rollbackTags(repo name.Repository, tags []string, prev map[string]*remote.Descriptor, ropts []remote.Option) error {
+	var errs []error
+	for _, t := range tags {
+		if desc := prev[t]; desc != nil {
+			if err := remote.Tag(repo.Tag(t), desc, ropts...); err != nil {
+				errs = append(errs, fmt.Errorf("restoring %q: %w", t, err))
+			}
+			continue
+		}
+		if err := remote.Delete(repo.Tag(t), ropts...); err != nil {
+			errs = append(errs, fmt.Errorf("deleting %q: %w", t, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// imageRepo returns the repo to publish ip to, and whether to use bare image naming.
+// It's repo, the repo configured in the resource, if set.
+// Otherwise, fallback to the provider-configured repo_template, and then the provider-configured repo.
+// If the resource configured the repo, or it came from repo_template, use bare image naming.
+func imageRepo(ctx context.Context, po *Opts, repo, ip, workingDir string) (string, bool, error) {
+	if repo != "" {
+		return repo, true, nil
+	}
+	if po.repoTemplate != nil {
+		r, err := executeRepoTemplate(ctx, po.repoTemplate, po.po.DockerRepo, ip, workingDir)
+		if err != nil {
+			return "", false, err
+		}
+		return r, true, nil
+	}
+	return po.po.DockerRepo, false, nil
+}
+
+func fromData(ctx context.Context, d *schema.ResourceData, po *Opts) (buildOptions, error) {
+	ip := d.Get("importpath").(string)
+	workingDir := d.Get("working_dir").(string)
+
+	repo, bare, err := imageRepo(ctx, po, d.Get("repo").(string), ip, workingDir)
+	if err != nil {
+		return buildOptions{}, err
+	}
+
+	// Read list and map attributes as strings, keeping the first error to return once the options are read.
+	var attrErr error
+	stringList := func(k string) []string {
+		l, err := toStringSlice(d.Get(k).([]interface{}))
+		if err != nil && attrErr == nil {
+			attrErr = fmt.Errorf("reading %s: %w", k, err)
+		}
+		return l
+	}
+	stringMap := func(k string) map[string]string {
+		m, err := toStringMap(d.Get(k).(map[string]interface{}))
+		if err != nil && attrErr == nil {
+			attrErr = fmt.Errorf("reading %s: %w", k, err)
+		}
+		return m
+	}
+
+	// The ko config file, if used, stands in for the provider's defaults, under the resource's attributes.
+	baseImage := po.bo.BaseImage
+	defaultLdflags, defaultEnv := po.ldflags, po.env
+	var platforms []string
+	var koBuild build.Config
+	if d.Get("ko_config").(bool) {
+		kc, err := loadKoConfig(workingDir, ip)
+		if err != nil {
+			return buildOptions{}, fmt.Errorf("reading ko config: %w", err)
+		}
+		baseImage, platforms, koBuild = kc.baseImage, kc.platforms, kc.build
+		defaultLdflags = mergeDefaults(kc.build.Ldflags, po.ldflags)
+		defaultEnv = mergeDefaults(kc.build.Env, po.env)
+	}
+	baseImage = getString(d, "base_image", baseImage)
+	if b, ok, err := baseImageOverride(ctx, stringMap("base_image_overrides"), ip, workingDir); err != nil {
+		return buildOptions{}, err
+	} else if ok {
+		baseImage = b
+	}
+	if p := stringList("platforms"); len(p) > 0 {
+		platforms = p
+	}
+	platforms = defaultPlatform(platforms)
+	race := d.Get("race").(bool)
+	if race {
+		if err := checkRacePlatforms(platforms); err != nil {
+			return buildOptions{}, err
+		}
+	}
+
+	var platformLdflags map[string][]string
+	for _, v := range d.Get("platform_ldflags").([]interface{}) {
+		pl := v.(map[string]interface{})
+		if platformLdflags == nil {
+			platformLdflags = map[string][]string{}
+		}
+		ldflags, err := toStringSlice(pl["ldflags"].([]interface{}))
+		if err != nil {
+			return buildOptions{}, fmt.Errorf("reading platform_ldflags: %w", err)
+		}
+		platformLdflags[pl["platform"].(string)] = mergeDefaults(defaultLdflags, ldflags)
+	}
+
+	tags := stringList("tags")
+	if d.Get("sanitize_tags").(bool) {
+		tags = sanitizeTags(tags)
+	}
+
+	sbomUpload := po.sbomUpload
+	if raw := d.GetRawConfig(); !raw.IsNull() && !raw.GetAttr("sbom_upload").IsNull() {
+		sbomUpload = raw.GetAttr("sbom_upload").True()
+	}
+	buildRetries := po.buildRetries
+	if raw := d.GetRawConfig(); !raw.IsNull() && !raw.GetAttr("build_retries").IsNull() {
+		buildRetries = d.Get("build_retries").(int)
+	}
+	timeout := po.timeout
+	if raw := d.GetRawConfig(); !raw.IsNull() && !raw.GetAttr("timeout").IsNull() {
+		if timeout, err = time.ParseDuration(d.Get("timeout").(string)); err != nil {
+			return buildOptions{}, fmt.Errorf("parsing timeout: %w", err)
+		}
+	}
+
+	var annotations, runAnnotations map[string]string
+	if d.Get("git_annotations").(bool) {
+		a, err := gitAnnotations(workingDir)
+		if err != nil {
+			return buildOptions{}, fmt.Errorf("reading git metadata: %w", err)
+		}
+		annotations = a
+	}
+	if d.Get("terraform_run_annotations").(bool) {
+		// Only take the run from the environment when creating the image; afterwards, keep the run that created it.
+		runAnnotations = stringMap("run_annotations")
+		if d.Id() == "" {
+			runAnnotations = terraformRunAnnotations()
+		}
+		if annotations == nil {
+			annotations = map[string]string{}
+		}
+		maps.Copy(annotations, runAnnotations)
+	}
+	if a := stringMap("annotations"); len(a) > 0 {
+		if annotations == nil {
+			annotations = map[string]string{}
+		}
+		maps.Copy(annotations, a)
 	}
 
-	switch o.sbom {
-	case "spdx":
-		bo = append(bo, build.WithSPDX(version))
-	case "none":
-		bo = append(bo, build.WithDisabledSBOM())
-	default:
-		return nil, fmt.Errorf("unknown sbom type: %q", o.sbom)
+	var resourceAuth *authn.AuthConfig
+	if a := d.Get("basic_auth").(string); a != "" {
+		user, pass, ok := strings.Cut(a, ":")
+		if !ok {
+			return buildOptions{}, errors.New(`basic_auth did not contain ":"`)
+		}
+		resourceAuth = &authn.AuthConfig{Username: user, Password: pass}
+	} else if t := d.Get("token").(string); t != "" {
+		resourceAuth = &authn.AuthConfig{RegistryToken: t}
 	}
 
-	// We read the environment variable directly here instead of plumbing it through as a provider option to keep the behavior consistent with resolve.
-	// While CreationTime is a build.Option, it is not a field in options.BuildOptions and is inferred from the environment variable when a new resolver is created.
-	if epoch := os.Getenv("SOURCE_DATE_EPOCH"); epoch != "" {
-		s, err := strconv.ParseInt(epoch, 10, 64)
-		if err != nil {
-			return nil, fmt.Errorf("the environment variable %s should be the number of seconds since January 1st 1970, 00:00 UTC, got: %w", epoch, err)
+	var artifactAuth *authn.AuthConfig
+	if a := d.Get("artifact_basic_auth").(string); a != "" {
+		user, pass, ok := strings.Cut(a, ":")
+		if !ok {
+			return buildOptions{}, errors.New(`artifact_basic_auth did not contain ":"`)
 		}
-		bo = append(bo, build.WithCreationTime(v1.Time{Time: time.Unix(s, 0)}))
+		artifactAuth = &authn.AuthConfig{Username: user, Password: pass}
 	}
 
-	b, err := build.NewGo(ctx, o.workingDir, bo...)
-	if err != nil {
-		return nil, fmt.Errorf("NewGo: %w", err)
+	var signKey, signPassword string
+	if s := d.Get("sign").([]interface{}); len(s) > 0 && s[0] != nil {
+		sign := s[0].(map[string]interface{})
+		signKey, signPassword = sign["key"].(string), sign["password"].(string)
 	}
-	return build.NewCaching(b)
-}
 
-var baseImages sync.Map // Cache of base image lookups.
+	opts := po.registryOptions(buildOptions{
+		ip:               ip,
+		workingDir:       workingDir,
+		imageRepo:        repo,
+		platforms:        platforms,
+		baseImage:        baseImage,
+		sbom:             d.Get("sbom").(string),
+		resourceAuth:     resourceAuth,
+		bare:             bare,
+		ldflags:          mergeDefaults(defaultLdflags, stringList("ldflags")),
+		platformLdflags:  platformLdflags,
+		env:              mergeDefaults(defaultEnv, stringList("env")),
+		buildTags:        stringList("build_tags"),
+		gcflags:          stringList("gcflags"),
+		asmflags:         stringList("asmflags"),
+		noTrimpath:       !d.Get("trimpath").(bool),
+		koBuild:          koBuild,
+		tags:             tags,
+		atomicTags:       d.Get("atomic_tags").(bool),
+		noClobberTags:    d.Get("no_clobber_tags").(bool),
+		ociLayoutDir:     d.Get("oci_layout_dir").(string),
+		noPush:           !d.Get("push").(bool),
+		publishMode:      d.Get("publish_mode").(string),
+		tarballPath:      d.Get("tarball_path").(string),
+		tagOnly:          d.Get("tag_only").(bool),
+		annotations:      annotations,
+		runAnnotations:   runAnnotations,
+		labels:           stringMap("labels"),
+		race:             race,
+		cgo:              d.Get("cgo_enabled").(bool),
+		intersectBase:    d.Get("intersect_base_platforms").(bool),
+		reuseUnchanged:   d.Get("reuse_unchanged").(bool),
+		stopSignal:       d.Get("stop_signal").(string),
+		user:             d.Get("user").(string),
+		ports:            stringList("ports"),
+		imageEnv:         stringMap("image_env"),
+		entrypointPrefix: stringList("entrypoint_prefix"),
+		entrypoint:       stringList("entrypoint"),
+		args:             stringList("args"),
+		noSBOMUpload:     !sbomUpload,
+		forceIndex:       d.Get("force_index").(bool),
+		archOverride:     d.Get("arch_override").(string),
+		dockerMediaTypes: d.Get("compat_docker_media_types").(bool),
+		buildRetries:     buildRetries,
+		timeout:          timeout,
+		artifactRepo:     d.Get("artifact_repo").(string),
+		artifactAuth:     artifactAuth,
+		signKey:          signKey,
+		signPassword:     signPassword,
+		attest:           d.Get("attest").(bool),
+		kodataWarnSize:   int64(d.Get("kodata_warn_size").(int)),
 
-// doBuild builds the image and returns the built image, and the full name.Reference by digest that the image would be pushed to.
-//
-// doBuild doesn't publish images, use doPublish to publish the build.Result that doBuild returns.
-func doBuild(ctx context.Context, opts buildOptions) (build.Result, string, error) {
-	if opts.imageRepo == "" {
-		return nil, "", errors.New("one of KO_DOCKER_REPO env var, or provider `repo`, or image resource `repo` must be set")
+		lenientSourceDateEpoch: po.lenientSourceDateEpoch,
+		sourceDateEpoch:        d.Get("source_date_epoch").(string),
+		remoteBuildCache:       po.remoteBuildCache,
+		idStrategy:             d.Get("id_strategy").(string),
+	})
+	if attrErr != nil {
+		return buildOptions{}, attrErr
 	}
+	return opts, nil
+}
 
-	b, err := opts.makeBuilder(ctx)
+// effectiveOptions summarizes the options that were actually used to produce res,
+// in the shape of the effective_options attribute.
+func effectiveOptions(res build.Result, opts buildOptions) ([]interface{}, error) {
+	base, err := baseImageOf(res)
 	if err != nil {
-		return nil, "", fmt.Errorf("NewGo: %w", err)
+		return nil, err
 	}
-	res, err := b.Build(ctx, opts.ip)
-	if err != nil {
-		return nil, "", fmt.Errorf("build: %w", err)
+	naming := "preserve_import_paths"
+	if opts.bare {
+		naming = "bare"
 	}
-	dig, err := res.Digest()
+	tags := opts.tags
+	if len(tags) == 0 {
+		tags = []string{"latest"}
+	}
+	return []interface{}{map[string]interface{}{
+		"repo":       opts.imageRepo,
+		"naming":     naming,
+		"base_image": base,
+		"platforms":  opts.platforms,
+		"ldflags":    opts.ldflags,
+		"env":        opts.env,
+		"sbom":       opts.sbom,
+		"tags":       tags,
+	}}, nil
+}
+
+// platformDigests returns the digests of the single-platform images in res, keyed by platform.
+func platformDigests(res build.Result) (map[string]v1.Hash, error) {
+	out := map[string]v1.Hash{}
+	switch res := res.(type) {
+	case v1.ImageIndex:
+		m, err := res.IndexManifest()
+		if err != nil {
+			return nil, err
+		}
+		for _, desc := range m.Manifests {
+			if desc.Platform == nil || !desc.MediaType.IsImage() {
+				continue
+			}
+			out[desc.Platform.String()] = desc.Digest
+		}
+	case v1.Image:
+		cf, err := res.ConfigFile()
+		if err != nil {
+			return nil, err
+		}
+		dig, err := res.Digest()
+		if err != nil {
+			return nil, err
+		}
+		out[cf.Platform().String()] = dig
+	}
+	return out, nil
+}
+
+// digestOutputs returns the image_refs, platform_digests and index_digest attributes for res, in the repository of ref.
+// index_digest is only set if res is a multi-platform index.
+func digestOutputs(res build.Result, ref string) (refs, digests map[string]interface{}, indexDigest string, err error) {
+	r, err := name.ParseReference(ref)
 	if err != nil {
-		return nil, "", fmt.Errorf("digest: %w", err)
+		return nil, nil, "", err
 	}
-	ref, err := name.ParseReference(namer(opts)(opts.imageRepo, opts.ip))
+	pd, err := platformDigests(res)
 	if err != nil {
-		return nil, "", fmt.Errorf("ParseReference: %w", err)
+		return nil, nil, "", err
 	}
-
-	return res, ref.Context().Digest(dig.String()).String(), nil
+	refs, digests = map[string]interface{}{}, map[string]interface{}{}
+	for p, dig := range pd {
+		refs[p] = r.Context().Digest(dig.String()).String()
+		digests[p] = dig.String()
+	}
+	if idx, ok := res.(v1.ImageIndex); ok {
+		dig, err := idx.Digest()
+		if err != nil {
+			return nil, nil, "", err
+		}
+		indexDigest = dig.String()
+	}
+	return refs, digests, indexDigest, nil
 }
 
-func namer(opts buildOptions) publish.Namer {
-	return options.MakeNamer(&options.PublishOptions{
-		DockerRepo:          opts.imageRepo,
-		Bare:                opts.bare,
-		PreserveImportPaths: !opts.bare,
-		Tags:                opts.tags,
-	})
+// baseImageOf returns the base image reference, by digest if known, that ko recorded in the annotations of the built image or index.
+func baseImageOf(res build.Result) (string, error) {
+	base, dig, err := baseAnnotationsOf(res)
+	if err != nil || base == "" || dig == "" {
+		return base, err
+	}
+	ref, err := name.ParseReference(base)
+	if err != nil {
+		return "", fmt.Errorf("parsing base image name %q: %w", base, err)
+	}
+	return ref.Context().Digest(dig).String(), nil
 }
 
-func doPublish(ctx context.Context, r build.Result, opts buildOptions) (string, error) {
-	kc := keychain
-	if opts.auth != nil {
-		kc = authn.NewMultiKeychain(staticKeychain{opts.imageRepo, opts.auth}, kc)
+// baseAnnotationsOf returns the base image name and digest ko recorded in the annotations of res.
+func baseAnnotationsOf(res build.Result) (string, string, error) {
+	var annotations map[string]string
+	switch r := res.(type) {
+	case v1.ImageIndex:
+		m, err := r.IndexManifest()
+		if err != nil {
+			return "", "", err
+		}
+		annotations = m.Annotations
+	case v1.Image:
+		m, err := r.Manifest()
+		if err != nil {
+			return "", "", err
+		}
+		annotations = m.Annotations
 	}
+	return annotations[specsv1.AnnotationBaseImageName], annotations[specsv1.AnnotationBaseImageDigest], nil
+}
 
-	po := []publish.Option{
-		publish.WithAuthFromKeychain(kc),
-		publish.WithNamer(namer(opts)),
-		publish.WithUserAgent(userAgent),
+func getString(d *schema.ResourceData, key string, defaultVal string) string {
+	if v, ok := d.Get(key).(string); ok && v != "" {
+		return v
 	}
+	return defaultVal
+}
 
-	if len(opts.tags) > 0 {
-		po = append(po, publish.WithTags(opts.tags))
-	}
+// racePlatforms are the container platforms supported by the race detector.
+var racePlatforms = []string{"linux/amd64", "linux/arm64", "linux/ppc64le", "linux/s390x", "windows/amd64"}
 
-	p, err := publish.NewDefault(opts.imageRepo, po...)
-	if err != nil {
-		return "", fmt.Errorf("NewDefault: %w", err)
+// checkRacePlatforms returns an error if any of platforms isn't supported by the race detector.
+func checkRacePlatforms(platforms []string) error {
+	var unsupported []string
+	for _, p := range platforms {
+		if p == "all" {
+			return fmt.Errorf("race cannot be used with platforms \"all\"; the race detector only supports %s", strings.Join(racePlatforms, ", "))
+		}
+		pl, err := v1.ParsePlatform(p)
+		if err != nil {
+			return fmt.Errorf("parsing platform %q: %w", p, err)
+		}
+		if !slices.Contains(racePlatforms, pl.OS+"/"+pl.Architecture) {
+			unsupported = append(unsupported, p)
+		}
 	}
-	ref, err := p.Publish(ctx, r, opts.ip)
-	if err != nil {
-		return "", fmt.Errorf("publish: %w", err)
+	if len(unsupported) > 0 {
+		return fmt.Errorf("race is not supported on platforms %s; the race detector only supports %s", strings.Join(unsupported, ", "), strings.Join(racePlatforms, ", "))
 	}
-	return ref.String(), nil
+	return nil
 }
 
-func fromData(d *schema.ResourceData, po *Opts) buildOptions {
-	// Use the repo configured in the ko_build resource, if set.
-	// Otherwise, fallback to the provider-configured repo.
-	// If the ko_build resource configured the repo, use bare image naming.
-	repo := po.po.DockerRepo
-	bare := false
-	if r := d.Get("repo").(string); r != "" {
-		repo = r
-		bare = true
+// validateRace is a CustomizeDiffFunc that reports platforms that don't support `race` at plan time.
+func validateRace(_ context.Context, d *schema.ResourceDiff, _ interface{}) error {
+	if !d.Get("race").(bool) || !d.NewValueKnown("platforms") {
+		return nil
+	}
+	var platforms []string
+	for _, v := range d.Get("platforms").([]interface{}) {
+		if p, ok := v.(string); ok {
+			platforms = append(platforms, p)
+		}
 	}
+	return checkRacePlatforms(defaultPlatform(platforms))
+}
 
-	return buildOptions{
-		ip:         d.Get("importpath").(string),
-		workingDir: d.Get("working_dir").(string),
-		imageRepo:  repo,
-		platforms:  defaultPlatform(toStringSlice(d.Get("platforms").([]interface{}))),
-		baseImage:  getString(d, "base_image", po.bo.BaseImage),
-		sbom:       d.Get("sbom").(string),
-		auth:       po.auth,
-		bare:       bare,
-		ldflags:    toStringSlice(d.Get("ldflags").([]interface{})),
-		env:        toStringSlice(d.Get("env").([]interface{})),
-		tags:       toStringSlice(d.Get("tags").([]interface{})),
+// validatePush is a CustomizeDiffFunc that rejects `tags` when `push` is false, since there's no image in the registry to tag.
+func validatePush(_ context.Context, d *schema.ResourceDiff, _ interface{}) error {
+	if !d.NewValueKnown("push") || d.Get("push").(bool) || len(d.Get("tags").([]interface{})) == 0 {
+		return nil
 	}
+	return errors.New("tags can't be set when push = false, since the image isn't pushed to the registry")
 }
 
-func getString(d *schema.ResourceData, key string, defaultVal string) string {
-	if v, ok := d.Get(key).(string); ok && v != "" {
-		return v
+// mergeDefaults returns the provider's defaults followed by the resource's values, so that the resource's values take precedence where later values win.
+func mergeDefaults(defaults, values []string) []string {
+	if len(defaults) == 0 {
+		return values
 	}
-	return defaultVal
+	return append(append([]string{}, defaults...), values...)
 }
 
 func defaultPlatform(in []string) []string {
@@ -332,16 +2114,32 @@ func defaultPlatform(in []string) []string {
 	return in
 }
 
-func toStringSlice(in []interface{}) []string {
+// toStringSlice returns the elements of a list attribute as strings.
+// It fails rather than panicking if an element isn't a string, which would crash the provider.
+func toStringSlice(in []interface{}) ([]string, error) {
 	out := make([]string, len(in))
 	for i, ii := range in {
-		if s, ok := ii.(string); ok {
-			out[i] = s
-		} else {
-			panic(fmt.Errorf("expected string, got %T", ii))
+		s, ok := ii.(string)
+		if !ok {
+			return nil, fmt.Errorf("element %d: expected string, got %T", i, ii)
+		}
+		out[i] = s
+	}
+	return out, nil
+}
+
+// toStringMap returns the values of a map attribute as strings.
+// It fails rather than panicking if a value isn't a string, which would crash the provider.
+func toStringMap(in map[string]interface{}) (map[string]string, error) {
+	out := make(map[string]string, len(in))
+	for k, v := range in {
+		s, ok := v.(string)
+		if !ok {
+			return nil, fmt.Errorf("key %q: expected string, got %T", k, v)
 		}
+		out[k] = s
 	}
-	return out
+	return out, nil
 }
 
 func resourceKoBuildCreate(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
@@ -350,18 +2148,179 @@ func resourceKoBuildCreate(ctx context.Context, d *schema.ResourceData, meta int
 		return diag.Errorf("configuring provider: %v", err)
 	}
 
-	res, _, err := doBuild(ctx, fromData(d, po))
+	opts, err := fromData(ctx, d, po)
+	if err != nil {
+		return diag.Errorf("[id=%s] create fromData: %v", d.Id(), err)
+	}
+	opts.saveBuildCache = true
+	var diags diag.Diagnostics
+	if opts.intersectBase {
+		dropped, err := opts.restrictToBasePlatforms(ctx)
+		if err != nil {
+			return diag.Errorf("[id=%s] create restrictToBasePlatforms: %v", d.Id(), err)
+		}
+		if len(dropped) > 0 {
+			diags = append(diags, diag.Diagnostic{
+				Severity: diag.Warning,
+				Summary:  "Skipped platforms not provided by the base image",
+				Detail:   fmt.Sprintf("base image %s does not provide platforms %s, so they were not built", opts.baseImage, strings.Join(dropped, ", ")),
+			})
+		}
+	}
+	if opts.kodataWarnSize > 0 {
+		msg, err := opts.kodataSizeWarning(ctx)
+		if err != nil {
+			return diag.Errorf("[id=%s] create kodataSizeWarning: %v", d.Id(), err)
+		}
+		if msg != "" {
+			diags = append(diags, diag.Diagnostic{
+				Severity: diag.Warning,
+				Summary:  "Large kodata layer",
+				Detail:   msg,
+			})
+		}
+	}
+	if msg, err := opts.singlePlatformBaseWarning(ctx); err != nil {
+		return diag.Errorf("[id=%s] create singlePlatformBaseWarning: %v", d.Id(), err)
+	} else if msg != "" {
+		diags = append(diags, diag.Diagnostic{
+			Severity: diag.Warning,
+			Summary:  "Base image provides a single platform",
+			Detail:   msg,
+		})
+	}
+	if opts.archOverride != "" {
+		diags = append(diags, diag.Diagnostic{
+			Severity: diag.Warning,
+			Summary:  "Mismatched image architecture",
+			Detail:   fmt.Sprintf("arch_override declares %s in the image's config, whatever platform its binary was built for, so the image may not match its declared platform. Only use it for testing under emulation.", opts.archOverride),
+		})
+	}
+	var hash string
+	if opts.reuseUnchanged {
+		if hash, err = sourceHash(ctx, opts); err != nil {
+			return diag.Errorf("[id=%s] create sourceHash: %v", d.Id(), err)
+		}
+	}
+	start := time.Now()
+	buildCtx, cancel := opts.withTimeout(ctx)
+	res, ref, err := doBuild(buildCtx, opts)
+	err = opts.timeoutError(buildCtx, "build", err)
+	cancel()
 	if err != nil {
-		return diag.Errorf("[id=%s] create doBuild: %v", d.Id(), err)
+		return append(cgoDiagnostics(opts, err), diag.Errorf("[id=%s] create doBuild: %v", d.Id(), err)...)
 	}
-	ref, err := doPublish(ctx, res, fromData(d, po))
+	diags = append(diags, cgoDiagnostics(opts, nil)...)
+	buildDuration := time.Since(start)
+	resolved, err := resolveImportpath(ctx, opts)
 	if err != nil {
-		return diag.Errorf("[id=%s] create doPublish: %v", d.Id(), err)
+		return diag.Errorf("[id=%s] create resolveImportpath: %v", d.Id(), err)
 	}
+	start = time.Now()
+	var refsByTag map[string]string
+	var localRef string
+	if opts.ociLayoutDir != "" {
+		if _, err := publish.NewLayout(opts.ociLayoutDir).Publish(ctx, res, opts.ip); err != nil {
+			return diag.Errorf("[id=%s] create saving OCI layout: %v", d.Id(), err)
+		}
+	} else if opts.isLocalPublish() {
+		publishCtx, cancel := opts.withTimeout(ctx)
+		localRef, err = publishLocal(publishCtx, res, ref, opts)
+		err = opts.timeoutError(publishCtx, "publish", err)
+		cancel()
+		if err != nil {
+			return diag.Errorf("[id=%s] create publishLocal: %v", d.Id(), err)
+		}
+	} else if !opts.noPush {
+		opts.authSources = &authSources{}
+		publishCtx, cancel := opts.withTimeout(ctx)
+		ref, refsByTag, err = doPublish(publishCtx, res, opts)
+		err = opts.timeoutError(publishCtx, "publish", err)
+		cancel()
+		if err != nil {
+			return diag.Errorf("[id=%s] create doPublish: %v", d.Id(), err)
+		}
+	}
+	publishDuration := time.Since(start)
 
-	_ = d.Set("image_ref", ref)
-	d.SetId(ref)
-	return nil
+	eo, err := effectiveOptions(res, opts)
+	if err != nil {
+		return diag.Errorf("[id=%s] create effectiveOptions: %v", d.Id(), err)
+	}
+
+	info, err := buildInfoOf(res)
+	if err != nil {
+		return diag.Errorf("[id=%s] create buildInfoOf: %v", d.Id(), err)
+	}
+	materials, err := materialsOf(res, info)
+	if err != nil {
+		return diag.Errorf("[id=%s] create materialsOf: %v", d.Id(), err)
+	}
+	if opts.signKey != "" {
+		if err := signImage(ctx, ref, opts); err != nil {
+			return diag.Errorf("[id=%s] create signImage: %v", d.Id(), err)
+		}
+		if opts.attest {
+			if err := attestImage(ctx, ref, materials, info.GoVersion, opts); err != nil {
+				return diag.Errorf("[id=%s] create attestImage: %v", d.Id(), err)
+			}
+		}
+	}
+
+	refs, digests, indexDigest, err := digestOutputs(res, ref)
+	if err != nil {
+		return diag.Errorf("[id=%s] create digestOutputs: %v", d.Id(), err)
+	}
+	mt, err := res.MediaType()
+	if err != nil {
+		return diag.Errorf("[id=%s] create MediaType: %v", d.Id(), err)
+	}
+
+	id, err := resourceID(opts, ref)
+	if err != nil {
+		return diag.Errorf("[id=%s] create resourceID: %v", d.Id(), err)
+	}
+	digestRef, err := toDigestRef(ref)
+	if err != nil {
+		return diag.Errorf("[id=%s] create toDigestRef: %v", d.Id(), err)
+	}
+	artifactRef, err := opts.artifactRef(ref)
+	if err != nil {
+		return diag.Errorf("[id=%s] create artifactRef: %v", d.Id(), err)
+	}
+	sigRef, attRef, err := cosignRefs(artifactRef)
+	if err != nil {
+		return diag.Errorf("[id=%s] create cosignRefs: %v", d.Id(), err)
+	}
+	imageRef, err := opts.imageRef(ref)
+	if err != nil {
+		return diag.Errorf("[id=%s] create imageRef: %v", d.Id(), err)
+	}
+	if localRef != "" {
+		imageRef = localRef
+	}
+
+	_ = d.Set("image_ref", imageRef)
+	_ = d.Set("resolved_importpath", resolved)
+	_ = d.Set("image_digest_ref", digestRef)
+	_ = d.Set("signature_ref", sigRef)
+	_ = d.Set("attestation_ref", attRef)
+	_ = d.Set("tag_refs", refsByTag)
+	_ = d.Set("media_type", string(mt))
+	_ = d.Set("auth_source", authSourceOf(opts, ref))
+	_ = d.Set("build_duration_ms", buildDuration.Milliseconds())
+	_ = d.Set("publish_duration_ms", publishDuration.Milliseconds())
+	_ = d.Set("effective_options", eo)
+	_ = d.Set("image_refs", refs)
+	_ = d.Set("platform_digests", digests)
+	_ = d.Set("index_digest", indexDigest)
+	_ = d.Set("source_hash", hash)
+	_ = d.Set("run_annotations", opts.runAnnotations)
+	_ = d.Set("go_version", info.GoVersion)
+	_ = d.Set("modules", modulesOf(info))
+	_ = d.Set("materials", materials)
+	d.SetId(id)
+	return append(diags, sourceDateEpochWarnings(opts)...)
 }
 
 const zeroRef = "example.com/zero@sha256:0000000000000000000000000000000000000000000000000000000000000000"
@@ -373,7 +2332,54 @@ func resourceKoBuildRead(ctx context.Context, d *schema.ResourceData, meta inter
 	}
 
 	var diags diag.Diagnostics
-	_, ref, err := doBuild(ctx, fromData(d, po))
+	var res build.Result
+	var ref string
+	opts, err := fromData(ctx, d, po)
+	if err == nil && opts.intersectBase {
+		// Like Create, so that the source hash covers the platforms that were built.
+		_, err = opts.restrictToBasePlatforms(ctx)
+	}
+	if err == nil && opts.reuseUnchanged && d.Get("source_hash").(string) != "" {
+		// If nothing the image is built from changed, skip the rebuild and keep the image if it's still there.
+		// If anything fails here, fall back to rebuilding to find out whether the image changed.
+		if hash, herr := sourceHash(ctx, opts); herr == nil && hash == d.Get("source_hash").(string) {
+			if opts.noPush || opts.isLocalPublish() || opts.ociLayoutDir != "" {
+				return nil // The image was never pushed, so there's nothing in the registry to check.
+			}
+			if exists, herr := imageExists(ctx, publishedRef(d), opts); herr == nil {
+				if !exists {
+					d.SetId("") // The image is gone from the registry; build and push it again on next apply.
+				}
+				return nil
+			}
+		}
+	}
+	if err == nil {
+		buildCtx, cancel := opts.withTimeout(ctx)
+		res, ref, err = doBuild(buildCtx, opts)
+		err = opts.timeoutError(buildCtx, "build", err)
+		cancel()
+	}
+	if err == nil {
+		if eo, err := effectiveOptions(res, opts); err == nil {
+			_ = d.Set("effective_options", eo)
+		}
+		if resolved, err := resolveImportpath(ctx, opts); err == nil {
+			_ = d.Set("resolved_importpath", resolved)
+		}
+		if refs, digests, indexDigest, err := digestOutputs(res, ref); err == nil {
+			_ = d.Set("image_refs", refs)
+			_ = d.Set("platform_digests", digests)
+			_ = d.Set("index_digest", indexDigest)
+		}
+		if info, err := buildInfoOf(res); err == nil {
+			_ = d.Set("go_version", info.GoVersion)
+			_ = d.Set("modules", modulesOf(info))
+			if materials, err := materialsOf(res, info); err == nil {
+				_ = d.Set("materials", materials)
+			}
+		}
+	}
 	if err != nil {
 		ref = zeroRef
 		diags = append(diags, diag.Diagnostic{
@@ -383,23 +2389,243 @@ func resourceKoBuildRead(ctx context.Context, d *schema.ResourceData, meta inter
 		})
 	}
 
-	_ = d.Set("image_ref", ref)
-	if ref != d.Id() || ref == zeroRef {
+	if ref == zeroRef || !sameImage(ref, publishedRef(d)) {
+		_ = d.Set("image_ref", ref)
+		_ = d.Set("image_digest_ref", ref)
+		if artifactRef, err := opts.artifactRef(ref); err != nil {
+			diags = append(diags, diag.FromErr(err)...)
+		} else if sigRef, attRef, err := cosignRefs(artifactRef); err == nil {
+			_ = d.Set("signature_ref", sigRef)
+			_ = d.Set("attestation_ref", attRef)
+		}
 		d.SetId("") // triggers create on next apply.
-	} else {
-		d.SetId(ref)
 	}
 	return diags
 }
 
-func resourceKoBuildDelete(_ context.Context, _ *schema.ResourceData, _ interface{}) diag.Diagnostics {
-	// TODO: If we ever want to delete the image from the registry, we can do it here.
+// imageExists reports whether the image ref still exists in the registry.
+func imageExists(ctx context.Context, ref string, opts buildOptions) (bool, error) {
+	r, err := name.ParseReference(ref, opts.nameOptions()...)
+	if err != nil {
+		return false, err
+	}
+	if _, err := remote.Head(r, opts.remoteOptions(ctx)...); err != nil {
+		var terr *transport.Error
+		if errors.As(err, &terr) && terr.StatusCode == http.StatusNotFound {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// toDigestRef returns the repo@digest form of a digest reference, dropping any tag.
+func toDigestRef(ref string) (string, error) {
+	dig, err := name.NewDigest(ref)
+	if err != nil {
+		return "", err
+	}
+	return dig.Context().Digest(dig.DigestStr()).String(), nil
+}
+
+// authSourceOf returns the name of the keychain that provided credentials for the registry of ref, as recorded in opts.authSources.
+func authSourceOf(opts buildOptions, ref string) string {
+	if opts.authSources == nil {
+		return ""
+	}
+	r, err := name.ParseReference(ref)
+	if err != nil {
+		return ""
+	}
+	return opts.authSources.get(r.Context().RegistryStr())
+}
+
+// cosignRefs returns the references to the tags where cosign stores signatures and attestations of the image ref.
+// cosign names these tags after the image digest, with the ':' replaced by '-' and a .sig or .att suffix.
+func cosignRefs(ref string) (sig, att string, err error) {
+	dig, err := name.NewDigest(ref)
+	if err != nil {
+		return "", "", err
+	}
+	tag := strings.Replace(dig.DigestStr(), ":", "-", 1)
+	return dig.Context().Tag(tag + ".sig").String(), dig.Context().Tag(tag + ".att").String(), nil
+}
+
+// sameImage reports whether the digest references a and b refer to the same image in the same repository,
+// ignoring any tag included in either reference.
+func sameImage(a, b string) bool {
+	da, err := name.NewDigest(a)
+	if err != nil {
+		return false
+	}
+	db, err := name.NewDigest(b)
+	if err != nil {
+		return false
+	}
+	return da.Context().Name() == db.Context().Name() && da.DigestStr() == db.DigestStr()
+}
+
+// resourceID returns the ID of a ko_build resource that published ref, according to its id_strategy.
+func resourceID(opts buildOptions, ref string) (string, error) {
+	switch opts.idStrategy {
+	case "", "digest":
+		return ref, nil
+	case "first_tag":
+		dig, err := name.NewDigest(ref)
+		if err != nil {
+			return "", fmt.Errorf("parsing %q: %w", ref, err)
+		}
+		tag := "latest"
+		if len(opts.tags) > 0 {
+			tag = opts.tags[0]
+		}
+		return dig.Context().Tag(tag).String(), nil
+	case "importpath":
+		return opts.ip, nil
+	default:
+		return "", fmt.Errorf("unknown id_strategy: %q", opts.idStrategy)
+	}
+}
+
+func resourceKoBuildUpdate(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	// Every other input forces a new resource, so only the tags or settings that don't affect the image can have changed.
+	// There's nothing to do for the latter, so only retag if the tags changed.
+	if !d.HasChange("tags") {
+		return nil
+	}
+	po, err := NewProviderOpts(meta)
+	if err != nil {
+		return diag.Errorf("configuring provider: %v", err)
+	}
+
+	opts, err := fromData(ctx, d, po)
+	if err != nil {
+		return diag.Errorf("[id=%s] update fromData: %v", d.Id(), err)
+	}
+	dig, err := name.NewDigest(publishedRef(d))
+	if err != nil {
+		return diag.Errorf("[id=%s] update parsing image_ref: %v", d.Id(), err)
+	}
+	opts.authSources = &authSources{}
+	ref, refsByTag, err := retag(ctx, dig.Context().Digest(dig.DigestStr()), opts)
+	if err != nil {
+		return diag.Errorf("[id=%s] update retag: %v", d.Id(), err)
+	}
+	id, err := resourceID(opts, ref)
+	if err != nil {
+		return diag.Errorf("[id=%s] update resourceID: %v", d.Id(), err)
+	}
+	imageRef, err := opts.imageRef(ref)
+	if err != nil {
+		return diag.Errorf("[id=%s] update imageRef: %v", d.Id(), err)
+	}
+
+	_ = d.Set("image_ref", imageRef)
+	_ = d.Set("tag_refs", refsByTag)
+	_ = d.Set("auth_source", authSourceOf(opts, ref))
+	if eo := d.Get("effective_options").([]interface{}); len(eo) == 1 {
+		tags := opts.tags
+		if len(tags) == 0 {
+			tags = []string{"latest"}
+		}
+		eo[0].(map[string]interface{})["tags"] = tags
+		_ = d.Set("effective_options", eo)
+	}
+	d.SetId(id)
+	return nil
+}
+
+func resourceKoBuildDelete(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	// Images saved to an OCI layout, published locally, or not pushed, were never published, so there's nothing to delete.
+	if !d.Get("delete_on_destroy").(bool) || d.Get("oci_layout_dir").(string) != "" || d.Get("publish_mode").(string) != "registry" || !d.Get("push").(bool) {
+		return nil
+	}
+	po, err := NewProviderOpts(meta)
+	if err != nil {
+		return diag.Errorf("configuring provider: %v", err)
+	}
+	opts, err := fromData(ctx, d, po)
+	if err != nil {
+		return diag.Errorf("[id=%s] delete fromData: %v", d.Id(), err)
+	}
+
+	var tagRefs []string
+	for _, v := range d.Get("tag_refs").(map[string]interface{}) {
+		tagRefs = append(tagRefs, v.(string))
+	}
+	if err := deleteImage(ctx, d.Get("image_digest_ref").(string), tagRefs, opts); err != nil {
+		if deleteUnsupported(err) {
+			return diag.Diagnostics{{
+				Severity: diag.Warning,
+				Summary:  "Registry doesn't support deleting images -- the image was left in the registry.",
+				Detail:   fmt.Sprintf("failed to delete %s: %v", d.Get("image_digest_ref").(string), err),
+			}}
+		}
+		return diag.Errorf("[id=%s] delete deleteImage: %v", d.Id(), err)
+	}
+	return nil
+}
+
+// deleteImage deletes the tags of tagRefs, in `repo:tag@digest` form, that still point to the image, then the image digestRef itself.
+// Tags that have since been moved to another image are left alone, and tags or images that are already gone are ignored.
+func deleteImage(ctx context.Context, digestRef string, tagRefs []string, opts buildOptions) error {
+	dig, err := name.NewDigest(digestRef, opts.nameOptions()...)
+	if err != nil {
+		return err
+	}
+	ropts := opts.remoteOptions(ctx)
+	for _, tr := range tagRefs {
+		// The digest in the tag ref is the one it was set to, not necessarily what it points to now.
+		t, err := name.NewTag(strings.SplitN(tr, "@", 2)[0], opts.nameOptions()...)
+		if err != nil {
+			return err
+		}
+		desc, err := remote.Head(t, ropts...)
+		if isNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("getting %s: %w", t, err)
+		}
+		if desc.Digest.String() != dig.DigestStr() {
+			continue
+		}
+		if err := remote.Delete(t, ropts...); err != nil && !isNotFound(err) {
+			return fmt.Errorf("deleting %s: %w", t, err)
+		}
+	}
+	if err := remote.Delete(dig, ropts...); err != nil && !isNotFound(err) {
+		return fmt.Errorf("deleting %s: %w", dig, err)
+	}
 	return nil
 }
 
+// isNotFound returns whether err is a registry's response that what was requested doesn't exist.
+func isNotFound(err error) bool {
+	var terr *transport.Error
+	return errors.As(err, &terr) && terr.StatusCode == http.StatusNotFound
+}
+
+// deleteUnsupported returns whether err is a registry's response that it doesn't support deleting manifests.
+func deleteUnsupported(err error) bool {
+	var terr *transport.Error
+	if !errors.As(err, &terr) {
+		return false
+	}
+	if terr.StatusCode == http.StatusMethodNotAllowed {
+		return true
+	}
+	for _, e := range terr.Errors {
+		if e.Code == transport.UnsupportedErrorCode {
+			return true
+		}
+	}
+	return false
+}
+
 type staticKeychain struct {
 	repo string
-	b    *authn.Basic
+	a    *authn.AuthConfig
 }
 
 func (k staticKeychain) Resolve(r authn.Resource) (authn.Authenticator, error) {
@@ -408,16 +2634,14 @@ func (k staticKeychain) Resolve(r authn.Resource) (authn.Authenticator, error) {
 		return nil, err
 	}
 	if r.RegistryStr() == ref.Context().RegistryStr() {
-		return staticAuthenticator{k.b}, nil
+		return staticAuthenticator{k.a}, nil
 	}
 	return authn.Anonymous, nil
 }
 
-type staticAuthenticator struct{ b *authn.Basic }
+type staticAuthenticator struct{ a *authn.AuthConfig }
 
 func (a staticAuthenticator) Authorization() (*authn.AuthConfig, error) {
-	return &authn.AuthConfig{
-		Username: a.b.Username,
-		Password: a.b.Password,
-	}, nil
+	c := *a.a
+	return &c, nil
 }
@@ -1,17 +1,39 @@
 package provider
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
 	"fmt"
+	"maps"
+	"net/http"
 	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
 	"regexp"
+	"runtime"
 	"slices"
 	"strings"
+	"sync/atomic"
 	"testing"
+	"text/template"
 
 	"github.com/google/go-containerregistry/pkg/crane"
+	"github.com/google/go-containerregistry/pkg/name"
 	"github.com/google/go-containerregistry/pkg/registry"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+	"github.com/google/ko/pkg/commands/options"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/resource"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/terraform"
+	"github.com/sigstore/cosign/v2/pkg/oci"
 )
 
 func TestAccResourceKoBuild(t *testing.T) {
@@ -35,6 +57,14 @@ func TestAccResourceKoBuild(t *testing.T) {
 			`,
 			Check: resource.ComposeTestCheckFunc(
 				resource.TestMatchResourceAttr("ko_build.foo", "image_ref", imageRefRE),
+				// Building takes measurable time; publishing to a local registry may not.
+				resource.TestCheckResourceAttrWith("ko_build.foo", "build_duration_ms", func(v string) error {
+					if v == "0" {
+						return fmt.Errorf("expected a non-zero build duration, got %s", v)
+					}
+					return nil
+				}),
+				resource.TestCheckResourceAttrSet("ko_build.foo", "publish_duration_ms"),
 			),
 		}},
 		// TODO: add a test that there's no terraform diff if the image hasn't changed.
@@ -79,6 +109,7 @@ func TestAccResourceKoBuild(t *testing.T) {
 			`,
 			Check: resource.ComposeTestCheckFunc(
 				resource.TestMatchResourceAttr("ko_build.foo", "image_ref", regexp.MustCompile("^"+url+"@sha256:")),
+				resource.TestCheckResourceAttr("ko_build.foo", "resolved_importpath", "github.com/ko-build/terraform-provider-ko/cmd/test"),
 				// TODO(jason): Check that top's base_image attr matches base's image_ref exactly.
 			),
 		}},
@@ -174,6 +205,18 @@ func TestAccResourceKoBuild(t *testing.T) {
 			}},
 		})
 	})
+	t.Run("source_date_epoch_failure", func(t *testing.T) {
+		resource.Test(t, resource.TestCase{
+			ProviderFactories: providerFactories,
+			Steps: []resource.TestStep{{
+				Config: `resource "ko_build" "foo" {
+					importpath        = "github.com/ko-build/terraform-provider-ko/cmd/test"
+					source_date_epoch = "abc123"
+				}`,
+				ExpectError: regexp.MustCompile("source_date_epoch should be the number of seconds since"),
+			}},
+		})
+	})
 
 	t.Run("build fails during plan", func(t *testing.T) {
 		res := `resource "ko_build" "foo" { importpath = "github.com/ko-build/terraform-provider-ko/cmd/not-found" }`
@@ -268,6 +311,9 @@ func TestAccResourceKoBuild_Tags(t *testing.T) {
 					Config: fmt.Sprintf(tc.config, path),
 					Check: resource.ComposeTestCheckFunc(
 						resource.TestMatchResourceAttr("ko_build.foo", "image_ref", imageRefRE),
+						resource.TestMatchResourceAttr("ko_build.foo", "image_digest_ref", imageRefRE),
+						resource.TestCheckResourceAttr("ko_build.foo", "auth_source", "anonymous"),
+						resource.TestMatchResourceAttr("ko_build.foo", "signature_ref", regexp.MustCompile("^"+url+"/"+path+":sha256-[0-9a-f]{64}\\.sig$")),
 					),
 				}},
 			})
@@ -375,3 +421,1939 @@ func TestAccResourceKoBuild_PlanNoPush(t *testing.T) {
 		}},
 	})
 }
+
+func TestAccResourceKoBuild_Push(t *testing.T) {
+	// Setup a local registry, which should stay empty.
+	srv := httptest.NewServer(registry.New())
+	defer srv.Close()
+	parts := strings.Split(srv.URL, ":")
+	url := fmt.Sprintf("localhost:%s/test", parts[len(parts)-1])
+	t.Setenv("KO_DOCKER_REPO", url)
+
+	config := `
+		resource "ko_build" "foo" {
+			importpath      = "github.com/ko-build/terraform-provider-ko/cmd/test"
+			push            = false
+			reuse_unchanged = true
+		}
+	`
+	resource.Test(t, resource.TestCase{
+		ProviderFactories: providerFactories,
+		Steps: []resource.TestStep{{
+			Config: config,
+			Check: resource.ComposeTestCheckFunc(
+				resource.TestMatchResourceAttr("ko_build.foo", "image_ref", regexp.MustCompile("^"+url+"/github.com/ko-build/terraform-provider-ko/cmd/test@sha256:")),
+				resource.TestCheckResourceAttr("ko_build.foo", "tag_refs.%", "0"),
+				resource.TestCheckResourceAttrWith("ko_build.foo", "image_ref", func(ref string) error {
+					if _, err := crane.Digest(ref); err == nil {
+						return fmt.Errorf("expected %s not to be pushed", ref)
+					}
+					return nil
+				}),
+			),
+		}, {
+			// The image isn't in the registry, but it wasn't meant to be, so there's nothing to do.
+			Config:   config,
+			PlanOnly: true,
+		}, {
+			Config: `
+			resource "ko_build" "foo" {
+				importpath = "github.com/ko-build/terraform-provider-ko/cmd/test"
+				push       = false
+				tags       = ["v1"]
+			}
+			`,
+			ExpectError: regexp.MustCompile("tags can't be set when push = false"),
+		}},
+	})
+}
+
+func TestAccResourceKoBuild_EffectiveOptions(t *testing.T) {
+	// Setup a local registry and have tests push to that.
+	srv := httptest.NewServer(registry.New())
+	defer srv.Close()
+	parts := strings.Split(srv.URL, ":")
+	url := fmt.Sprintf("localhost:%s/test", parts[len(parts)-1])
+	t.Setenv("KO_DOCKER_REPO", url)
+
+	resource.Test(t, resource.TestCase{
+		ProviderFactories: providerFactories,
+		Steps: []resource.TestStep{{
+			Config: `
+		resource "ko_build" "foo" {
+			importpath = "github.com/ko-build/terraform-provider-ko/cmd/test"
+			ldflags = ["-s", "-w"]
+			sbom = "none"
+		}
+		`,
+			Check: resource.ComposeTestCheckFunc(
+				resource.TestCheckResourceAttr("ko_build.foo", "effective_options.0.repo", url),
+				resource.TestCheckResourceAttr("ko_build.foo", "effective_options.0.naming", "preserve_import_paths"),
+				resource.TestMatchResourceAttr("ko_build.foo", "effective_options.0.base_image", regexp.MustCompile("@sha256:")),
+				resource.TestCheckResourceAttr("ko_build.foo", "effective_options.0.platforms.#", "1"),
+				resource.TestCheckResourceAttr("ko_build.foo", "effective_options.0.platforms.0", "linux/amd64"),
+				resource.TestCheckResourceAttr("ko_build.foo", "effective_options.0.ldflags.#", "2"),
+				resource.TestCheckResourceAttr("ko_build.foo", "effective_options.0.sbom", "none"),
+				resource.TestCheckResourceAttr("ko_build.foo", "effective_options.0.tags.0", "latest"),
+			),
+		}},
+	})
+}
+
+func TestDoPublish_AtomicTags(t *testing.T) {
+	// Setup a local registry that refuses to set the "bad" tag, and counts lookups of the "c" tag,
+	// which is never set, so is only looked up to snapshot it.
+	reg := registry.New()
+	var lookups atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPut && strings.HasSuffix(r.URL.Path, "/manifests/bad") {
+			http.Error(w, "no bad tags", http.StatusForbidden)
+			return
+		}
+		if r.Method != http.MethodPut && strings.HasSuffix(r.URL.Path, "/manifests/c") {
+			lookups.Add(1)
+		}
+		reg.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+	parts := strings.Split(srv.URL, ":")
+	url := fmt.Sprintf("localhost:%s/test", parts[len(parts)-1])
+
+	img, err := random.Image(1024, 1)
+	if err != nil {
+		t.Fatalf("random.Image: %v", err)
+	}
+
+	for _, tc := range []struct {
+		atomic     bool
+		expectTags []string
+		expectErr  string
+	}{
+		{atomic: false, expectTags: []string{"a", "b"}, expectErr: "tags set: [a b], tags not set: [bad c]"},
+		{atomic: true, expectTags: nil, expectErr: "tags rolled back: [a b]"},
+	} {
+		t.Run(fmt.Sprintf("atomic=%t", tc.atomic), func(t *testing.T) {
+			lookups.Store(0)
+			repo := fmt.Sprintf("%s/atomic-%t", url, tc.atomic)
+			_, _, err := doPublish(context.Background(), img, buildOptions{
+				ip:         "example.com/app",
+				imageRepo:  repo,
+				bare:       true,
+				tags:       []string{"a", "b", "bad", "c"},
+				atomicTags: tc.atomic,
+			})
+			if err == nil || !strings.Contains(err.Error(), tc.expectErr) {
+				t.Fatalf("expected error containing %q, got %v", tc.expectErr, err)
+			}
+
+			tags, err := crane.ListTags(repo)
+			if err != nil && len(tc.expectTags) > 0 {
+				t.Fatalf("failed to list tags: %v", err)
+			}
+			slices.Sort(tags)
+			if !slices.Equal(tc.expectTags, tags) {
+				t.Fatalf("expected tags %v, got %v", tc.expectTags, tags)
+			}
+			// The tags are only snapshotted when they may need to be rolled back.
+			if got := lookups.Load() > 0; got != tc.atomic {
+				t.Errorf("expected tags to be snapshotted: %t, got %d lookups of tag c", tc.atomic, lookups.Load())
+			}
+		})
+	}
+}
+
+func TestDoPublish_TagRefs(t *testing.T) {
+	// Setup a local registry and have tests push to that.
+	srv := httptest.NewServer(registry.New())
+	defer srv.Close()
+	parts := strings.Split(srv.URL, ":")
+	repo := fmt.Sprintf("localhost:%s/test/tag-refs", parts[len(parts)-1])
+
+	img, err := random.Image(1024, 1)
+	if err != nil {
+		t.Fatalf("random.Image: %v", err)
+	}
+	dig, err := img.Digest()
+	if err != nil {
+		t.Fatalf("Digest: %v", err)
+	}
+
+	for _, tags := range [][]string{nil, {"v1.2.3"}, {"latest", "v1.2.3", "v1"}} {
+		t.Run(strings.Join(tags, ","), func(t *testing.T) {
+			_, refs, err := doPublish(context.Background(), img, buildOptions{
+				ip:        "example.com/app",
+				imageRepo: repo,
+				bare:      true,
+				tags:      tags,
+			})
+			if err != nil {
+				t.Fatalf("doPublish: %v", err)
+			}
+			want := map[string]string{}
+			for _, tag := range tags {
+				want[tag] = repo + ":" + tag + "@" + dig.String()
+			}
+			if len(tags) == 0 {
+				want["latest"] = repo + ":latest@" + dig.String()
+			}
+			if !maps.Equal(want, refs) {
+				t.Fatalf("expected tag refs %v, got %v", want, refs)
+			}
+			// Each reference resolves to the image by its tag.
+			for tag, ref := range refs {
+				if got, err := crane.Digest(strings.Split(ref, "@")[0]); err != nil || got != dig.String() {
+					t.Errorf("expected tag %q to point to %s, got %s (%v)", tag, dig, got, err)
+				}
+			}
+		})
+	}
+}
+
+func TestDoPublish_NoClobberTags(t *testing.T) {
+	// Setup a local registry and have tests push to that.
+	srv := httptest.NewServer(registry.New())
+	defer srv.Close()
+	parts := strings.Split(srv.URL, ":")
+	repo := fmt.Sprintf("localhost:%s/test/no-clobber", parts[len(parts)-1])
+
+	img, err := random.Image(1024, 1)
+	if err != nil {
+		t.Fatalf("random.Image: %v", err)
+	}
+	other, err := random.Image(1024, 1)
+	if err != nil {
+		t.Fatalf("random.Image: %v", err)
+	}
+	if err := crane.Push(other, repo+":taken"); err != nil {
+		t.Fatalf("crane.Push: %v", err)
+	}
+	opts := buildOptions{
+		ip:            "example.com/app",
+		imageRepo:     repo,
+		bare:          true,
+		noClobberTags: true,
+	}
+
+	// Tags that don't exist yet are set.
+	opts.tags = []string{"a", "b"}
+	if _, _, err := doPublish(context.Background(), img, opts); err != nil {
+		t.Fatalf("doPublish: %v", err)
+	}
+
+	// Republishing the same image to the same tags is fine.
+	if _, _, err := doPublish(context.Background(), img, opts); err != nil {
+		t.Fatalf("doPublish: %v", err)
+	}
+
+	// Moving a tag that points to a different image fails, and no tags are set.
+	opts.tags = []string{"c", "taken"}
+	if _, _, err := doPublish(context.Background(), img, opts); err == nil || !strings.Contains(err.Error(), "taken") {
+		t.Fatalf("expected error about clobbering tag %q, got %v", "taken", err)
+	}
+	tags, err := crane.ListTags(repo)
+	if err != nil {
+		t.Fatalf("failed to list tags: %v", err)
+	}
+	slices.Sort(tags)
+	if want := []string{"a", "b", "taken"}; !slices.Equal(want, tags) {
+		t.Fatalf("expected tags %v, got %v", want, tags)
+	}
+	otherDig, err := other.Digest()
+	if err != nil {
+		t.Fatalf("Digest: %v", err)
+	}
+	if got, err := crane.Digest(repo + ":taken"); err != nil || got != otherDig.String() {
+		t.Errorf("expected tag %q to be unchanged, got %s (%v)", "taken", got, err)
+	}
+}
+
+func TestRetag(t *testing.T) {
+	// Setup a local registry and have tests push to that.
+	srv := httptest.NewServer(registry.New())
+	defer srv.Close()
+	parts := strings.Split(srv.URL, ":")
+	repo := fmt.Sprintf("localhost:%s/test/retag", parts[len(parts)-1])
+
+	img, err := random.Image(1024, 1)
+	if err != nil {
+		t.Fatalf("random.Image: %v", err)
+	}
+	dig, err := img.Digest()
+	if err != nil {
+		t.Fatalf("Digest: %v", err)
+	}
+	ref, err := name.NewDigest(repo + "@" + dig.String())
+	if err != nil {
+		t.Fatalf("NewDigest: %v", err)
+	}
+	if err := remote.Write(ref, img); err != nil {
+		t.Fatalf("remote.Write: %v", err)
+	}
+
+	for _, tc := range []struct {
+		tags    []string
+		wantRef string
+	}{
+		{tags: nil, wantRef: ref.String()},
+		{tags: []string{"a", "b"}, wantRef: ref.String()},
+		{tags: []string{"c"}, wantRef: repo + ":c@" + dig.String()},
+	} {
+		got, refs, err := retag(context.Background(), ref, buildOptions{tags: tc.tags})
+		if err != nil {
+			t.Fatalf("retag(%v): %v", tc.tags, err)
+		}
+		if got != tc.wantRef {
+			t.Errorf("retag(%v): expected ref %q, got %q", tc.tags, tc.wantRef, got)
+		}
+		wantTags := tc.tags
+		if len(wantTags) == 0 {
+			wantTags = []string{"latest"}
+		}
+		if len(refs) != len(wantTags) {
+			t.Errorf("retag(%v): expected refs for %v, got %v", tc.tags, wantTags, refs)
+		}
+		for _, tag := range wantTags {
+			if want := repo + ":" + tag + "@" + dig.String(); refs[tag] != want {
+				t.Errorf("retag(%v): expected ref %q for tag %q, got %q", tc.tags, want, tag, refs[tag])
+			}
+		}
+	}
+
+	tags, err := crane.ListTags(repo)
+	if err != nil {
+		t.Fatalf("failed to list tags: %v", err)
+	}
+	slices.Sort(tags)
+	// Tags are added, and tags that were removed are left in place.
+	if want := []string{"a", "b", "c", "latest"}; !slices.Equal(want, tags) {
+		t.Fatalf("expected tags %v, got %v", want, tags)
+	}
+	for _, tag := range tags {
+		if got, err := crane.Digest(repo + ":" + tag); err != nil || got != dig.String() {
+			t.Errorf("expected tag %q to point to %s, got %s (%v)", tag, dig, got, err)
+		}
+	}
+}
+
+func TestDeleteImage(t *testing.T) {
+	// Setup a local registry to delete from.
+	srv := httptest.NewServer(registry.New())
+	defer srv.Close()
+	parts := strings.Split(srv.URL, ":")
+	repo := fmt.Sprintf("localhost:%s/test", parts[len(parts)-1])
+
+	img, err := random.Image(1024, 1)
+	if err != nil {
+		t.Fatalf("random.Image: %v", err)
+	}
+	dig, err := img.Digest()
+	if err != nil {
+		t.Fatalf("Digest: %v", err)
+	}
+	for _, tag := range []string{"a", "b"} {
+		if err := crane.Push(img, repo+":"+tag); err != nil {
+			t.Fatalf("crane.Push: %v", err)
+		}
+	}
+	// b has since been moved to another image, so it's left alone.
+	other, err := random.Image(1024, 1)
+	if err != nil {
+		t.Fatalf("random.Image: %v", err)
+	}
+	if err := crane.Push(other, repo+":b"); err != nil {
+		t.Fatalf("crane.Push: %v", err)
+	}
+
+	digestRef := repo + "@" + dig.String()
+	// The tag c is already gone, which is fine.
+	tagRefs := []string{repo + ":a@" + dig.String(), repo + ":b@" + dig.String(), repo + ":c@" + dig.String()}
+	if err := deleteImage(context.Background(), digestRef, tagRefs, buildOptions{}); err != nil {
+		t.Fatalf("deleteImage: %v", err)
+	}
+	for _, ref := range []string{repo + ":a", digestRef} {
+		if _, err := crane.Head(ref); err == nil {
+			t.Errorf("expected %s to be deleted", ref)
+		}
+	}
+	if _, err := crane.Head(repo + ":b"); err != nil {
+		t.Errorf("expected moved tag b to be kept: %v", err)
+	}
+
+	// Deleting it again finds nothing to delete.
+	if err := deleteImage(context.Background(), digestRef, tagRefs, buildOptions{}); err != nil {
+		t.Errorf("deleteImage again: %v", err)
+	}
+}
+
+func TestDeleteImage_Unsupported(t *testing.T) {
+	// Setup a local registry that doesn't support deletes.
+	reg := registry.New()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodDelete {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		reg.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+	parts := strings.Split(srv.URL, ":")
+	repo := fmt.Sprintf("localhost:%s/test", parts[len(parts)-1])
+
+	img, err := random.Image(1024, 1)
+	if err != nil {
+		t.Fatalf("random.Image: %v", err)
+	}
+	dig, err := img.Digest()
+	if err != nil {
+		t.Fatalf("Digest: %v", err)
+	}
+	if err := crane.Push(img, repo+"@"+dig.String()); err != nil {
+		t.Fatalf("crane.Push: %v", err)
+	}
+	err = deleteImage(context.Background(), repo+"@"+dig.String(), nil, buildOptions{})
+	if err == nil {
+		t.Fatal("expected an error deleting from a registry that doesn't support it")
+	}
+	if !deleteUnsupported(err) {
+		t.Errorf("expected the error to be reported as unsupported, got %v", err)
+	}
+}
+
+func TestAccResourceKoBuild_DeleteOnDestroy(t *testing.T) {
+	// Setup a local registry and have tests push to that.
+	srv := httptest.NewServer(registry.New())
+	defer srv.Close()
+	parts := strings.Split(srv.URL, ":")
+	url := fmt.Sprintf("localhost:%s/test", parts[len(parts)-1])
+	t.Setenv("KO_DOCKER_REPO", url)
+
+	var digestRef string
+	resource.Test(t, resource.TestCase{
+		ProviderFactories: providerFactories,
+		Steps: []resource.TestStep{{
+			Config: `
+			resource "ko_build" "foo" {
+			  importpath        = "github.com/ko-build/terraform-provider-ko/cmd/test"
+			  sbom              = "none"
+			  delete_on_destroy = true
+			}
+			`,
+			Check: resource.TestCheckResourceAttrWith("ko_build.foo", "image_digest_ref", func(v string) error {
+				digestRef = v
+				return nil
+			}),
+		}},
+		CheckDestroy: func(*terraform.State) error {
+			if _, err := crane.Head(digestRef); err == nil {
+				return fmt.Errorf("expected %s to be deleted", digestRef)
+			}
+			return nil
+		},
+	})
+}
+
+func TestCosignRefs(t *testing.T) {
+	const hex = "0000000000000000000000000000000000000000000000000000000000000001"
+	for _, ref := range []string{
+		"example.com/app@sha256:" + hex,
+		"example.com/app:v1@sha256:" + hex,
+	} {
+		sig, att, err := cosignRefs(ref)
+		if err != nil {
+			t.Fatalf("cosignRefs(%q): %v", ref, err)
+		}
+		if want := "example.com/app:sha256-" + hex + ".sig"; sig != want {
+			t.Errorf("cosignRefs(%q): expected signature ref %q, got %q", ref, want, sig)
+		}
+		if want := "example.com/app:sha256-" + hex + ".att"; att != want {
+			t.Errorf("cosignRefs(%q): expected attestation ref %q, got %q", ref, want, att)
+		}
+	}
+	if _, _, err := cosignRefs("example.com/app:v1"); err == nil {
+		t.Error("expected error for a reference without a digest")
+	}
+}
+
+func TestAccResourceKoBuild_UpdateTags(t *testing.T) {
+	// Setup a local registry and have tests push to that.
+	srv := httptest.NewServer(registry.New())
+	defer srv.Close()
+	parts := strings.Split(srv.URL, ":")
+	url := fmt.Sprintf("localhost:%s/test", parts[len(parts)-1])
+	t.Setenv("KO_DOCKER_REPO", url)
+
+	path := "github.com/ko-build/terraform-provider-ko/cmd/test"
+	config := `
+		resource "ko_build" "foo" {
+			sbom       = "none"
+			importpath = "%s"
+			tags       = %s
+		}
+	`
+	var digestRef string
+	resource.Test(t, resource.TestCase{
+		ProviderFactories: providerFactories,
+		Steps: []resource.TestStep{{
+			Config: fmt.Sprintf(config, path, `["foo"]`),
+			Check: resource.ComposeTestCheckFunc(
+				resource.TestCheckResourceAttrWith("ko_build.foo", "image_digest_ref", func(v string) error {
+					digestRef = v
+					return nil
+				}),
+			),
+		}, {
+			// Changing only the tags updates the resource in place, re-tagging the same image.
+			Config: fmt.Sprintf(config, path, `["bar", "baz"]`),
+			Check: resource.ComposeTestCheckFunc(
+				resource.TestCheckResourceAttrPtr("ko_build.foo", "image_ref", &digestRef),
+				resource.TestCheckResourceAttrPtr("ko_build.foo", "image_digest_ref", &digestRef),
+				resource.TestCheckResourceAttr("ko_build.foo", "effective_options.0.tags.#", "2"),
+			),
+		}},
+	})
+
+	tags, err := crane.ListTags(fmt.Sprintf("%s/%s", url, path), crane.WithTransport(srv.Client().Transport))
+	if err != nil {
+		t.Fatalf("failed to list tags: %v", err)
+	}
+	slices.Sort(tags)
+	if want := []string{"bar", "baz", "foo"}; !slices.Equal(want, tags) {
+		t.Fatalf("expected tags %v, got %v", want, tags)
+	}
+}
+
+func TestAccResourceKoBuild_ReuseUnchanged(t *testing.T) {
+	// Setup a local registry and have tests push to that.
+	srv := httptest.NewServer(registry.New())
+	defer srv.Close()
+	parts := strings.Split(srv.URL, ":")
+	url := fmt.Sprintf("localhost:%s/test", parts[len(parts)-1])
+	t.Setenv("KO_DOCKER_REPO", url)
+
+	config := `
+		resource "ko_build" "foo" {
+			sbom            = "none"
+			importpath      = "github.com/ko-build/terraform-provider-ko/cmd/test"
+			reuse_unchanged = true
+		}
+	`
+	resource.Test(t, resource.TestCase{
+		ProviderFactories: providerFactories,
+		Steps: []resource.TestStep{{
+			Config: config,
+			Check: resource.ComposeTestCheckFunc(
+				resource.TestMatchResourceAttr("ko_build.foo", "source_hash", regexp.MustCompile("^sha256:[0-9a-f]{64}$")),
+			),
+		}, {
+			// Nothing changed, so the image is reused and there's nothing to do.
+			Config:   config,
+			PlanOnly: true,
+		}},
+	})
+}
+
+func TestDoBuild_Labels(t *testing.T) {
+	srv := httptest.NewServer(registry.New())
+	defer srv.Close()
+	parts := strings.Split(srv.URL, ":")
+	url := fmt.Sprintf("localhost:%s/test", parts[len(parts)-1])
+	base := pushBaseIndex(t, url+"/base", v1.Platform{OS: "linux", Architecture: "amd64"})
+
+	labels := map[string]string{
+		"org.opencontainers.image.source":   "https://github.com/ko-build/terraform-provider-ko",
+		"org.opencontainers.image.revision": "0123456789abcdef",
+	}
+	opts := buildOptions{
+		ip:         "github.com/ko-build/terraform-provider-ko/cmd/test",
+		workingDir: ".",
+		imageRepo:  url + "/labels",
+		bare:       true,
+		platforms:  []string{"linux/amd64"},
+		baseImage:  base,
+		sbom:       "none",
+		labels:     labels,
+	}
+	res, _, err := doBuild(context.Background(), opts)
+	if err != nil {
+		t.Fatalf("doBuild: %v", err)
+	}
+	ref, _, err := doPublish(context.Background(), res, opts)
+	if err != nil {
+		t.Fatalf("doPublish: %v", err)
+	}
+
+	// Pull the published image and check its config.
+	r, err := name.ParseReference(ref)
+	if err != nil {
+		t.Fatalf("ParseReference: %v", err)
+	}
+	img, err := remote.Image(r)
+	if err != nil {
+		t.Fatalf("remote.Image: %v", err)
+	}
+	cf, err := img.ConfigFile()
+	if err != nil {
+		t.Fatalf("ConfigFile: %v", err)
+	}
+	for k, v := range labels {
+		if got := cf.Config.Labels[k]; got != v {
+			t.Errorf("expected label %s=%q, got %q", k, v, got)
+		}
+	}
+}
+
+func TestDoPublish_Annotations(t *testing.T) {
+	srv := httptest.NewServer(registry.New())
+	defer srv.Close()
+	parts := strings.Split(srv.URL, ":")
+	url := fmt.Sprintf("localhost:%s/test", parts[len(parts)-1])
+	base := pushBaseIndex(t, url+"/base",
+		v1.Platform{OS: "linux", Architecture: "amd64"},
+		v1.Platform{OS: "linux", Architecture: "arm64"},
+	)
+
+	const key, value = "com.example.policy", "strict"
+	for _, platforms := range [][]string{{"linux/amd64"}, {"linux/amd64", "linux/arm64"}} {
+		t.Run(strings.Join(platforms, ","), func(t *testing.T) {
+			opts := buildOptions{
+				ip:          "github.com/ko-build/terraform-provider-ko/cmd/test",
+				workingDir:  ".",
+				imageRepo:   url + "/annotations",
+				bare:        true,
+				platforms:   platforms,
+				baseImage:   base,
+				sbom:        "none",
+				annotations: map[string]string{key: value},
+			}
+			res, _, err := doBuild(context.Background(), opts)
+			if err != nil {
+				t.Fatalf("doBuild: %v", err)
+			}
+			ref, _, err := doPublish(context.Background(), res, opts)
+			if err != nil {
+				t.Fatalf("doPublish: %v", err)
+			}
+
+			// Pull the published manifest, and those of the images if it's an index.
+			r, err := name.ParseReference(ref)
+			if err != nil {
+				t.Fatalf("ParseReference: %v", err)
+			}
+			desc, err := remote.Get(r)
+			if err != nil {
+				t.Fatalf("remote.Get: %v", err)
+			}
+			var manifests []*v1.Manifest
+			if desc.MediaType.IsIndex() {
+				idx, err := desc.ImageIndex()
+				if err != nil {
+					t.Fatalf("ImageIndex: %v", err)
+				}
+				im, err := idx.IndexManifest()
+				if err != nil {
+					t.Fatalf("IndexManifest: %v", err)
+				}
+				if got := im.Annotations[key]; got != value {
+					t.Errorf("expected index annotation %s=%q, got %q", key, value, got)
+				}
+				for _, d := range im.Manifests {
+					img, err := remote.Image(r.Context().Digest(d.Digest.String()))
+					if err != nil {
+						t.Fatalf("remote.Image: %v", err)
+					}
+					m, err := img.Manifest()
+					if err != nil {
+						t.Fatalf("Manifest: %v", err)
+					}
+					manifests = append(manifests, m)
+				}
+			} else {
+				img, err := desc.Image()
+				if err != nil {
+					t.Fatalf("Image: %v", err)
+				}
+				m, err := img.Manifest()
+				if err != nil {
+					t.Fatalf("Manifest: %v", err)
+				}
+				manifests = append(manifests, m)
+			}
+			if len(manifests) != len(platforms) {
+				t.Fatalf("expected %d image manifests, got %d", len(platforms), len(manifests))
+			}
+			for _, m := range manifests {
+				if got := m.Annotations[key]; got != value {
+					t.Errorf("expected image annotation %s=%q, got %q", key, value, got)
+				}
+			}
+		})
+	}
+}
+
+func TestDoBuild_DeterministicSBOM(t *testing.T) {
+	srv := httptest.NewServer(registry.New())
+	defer srv.Close()
+	parts := strings.Split(srv.URL, ":")
+	url := fmt.Sprintf("localhost:%s/test", parts[len(parts)-1])
+	base := pushBaseIndex(t, url+"/base", v1.Platform{OS: "linux", Architecture: "amd64"})
+
+	// sbomOf builds the image and returns its SPDX SBOM, with a fresh builder each time so nothing is cached.
+	sbomOf := func() []byte {
+		t.Helper()
+		res, _, err := doBuild(context.Background(), buildOptions{
+			ip:         "github.com/ko-build/terraform-provider-ko/cmd/test",
+			workingDir: ".",
+			imageRepo:  url,
+			platforms:  []string{"linux/amd64"},
+			baseImage:  base,
+			sbom:       "spdx",
+		})
+		if err != nil {
+			t.Fatalf("doBuild: %v", err)
+		}
+		si, ok := res.(oci.SignedImage)
+		if !ok {
+			t.Fatalf("expected a signed image, got %T", res)
+		}
+		f, err := si.Attachment("sbom")
+		if err != nil {
+			t.Fatalf("Attachment: %v", err)
+		}
+		b, err := f.Payload()
+		if err != nil {
+			t.Fatalf("Payload: %v", err)
+		}
+		return b
+	}
+
+	// ko's SPDX documents are named after the image digest and dated with the image's creation time,
+	// so the same inputs give a byte-identical SBOM.
+	first, second := sbomOf(), sbomOf()
+	if !bytes.Equal(first, second) {
+		t.Errorf("expected identical SBOMs, got:\n%s\nand:\n%s", first, second)
+	}
+
+	// With SOURCE_DATE_EPOCH, the SBOM is dated with it, and is still the same from build to build.
+	t.Setenv("SOURCE_DATE_EPOCH", "1700000000")
+	first, second = sbomOf(), sbomOf()
+	if !bytes.Equal(first, second) {
+		t.Errorf("expected identical SBOMs with SOURCE_DATE_EPOCH, got:\n%s\nand:\n%s", first, second)
+	}
+	if !bytes.Contains(first, []byte(`"created": "2023-11-14T22:13:20Z"`)) {
+		t.Errorf("expected the SBOM to be created at SOURCE_DATE_EPOCH, got:\n%s", first)
+	}
+}
+
+func TestDoPublish_SBOMUpload(t *testing.T) {
+	// Setup a local registry and have tests push to that.
+	srv := httptest.NewServer(registry.New())
+	defer srv.Close()
+	parts := strings.Split(srv.URL, ":")
+	url := fmt.Sprintf("localhost:%s/test", parts[len(parts)-1])
+	base := pushBaseIndex(t, url+"/base", v1.Platform{OS: "linux", Architecture: "amd64"})
+
+	for _, upload := range []bool{false, true} {
+		t.Run(fmt.Sprint(upload), func(t *testing.T) {
+			repo := fmt.Sprintf("%s/upload-%t", url, upload)
+			opts := buildOptions{
+				ip:           "github.com/ko-build/terraform-provider-ko/cmd/test",
+				workingDir:   ".",
+				imageRepo:    repo,
+				bare:         true,
+				platforms:    []string{"linux/amd64"},
+				baseImage:    base,
+				sbom:         "spdx",
+				noSBOMUpload: !upload,
+			}
+			res, _, err := doBuild(context.Background(), opts)
+			if err != nil {
+				t.Fatalf("doBuild: %v", err)
+			}
+			if _, _, err := doPublish(context.Background(), res, opts); err != nil {
+				t.Fatalf("doPublish: %v", err)
+			}
+			tags, err := crane.ListTags(repo)
+			if err != nil {
+				t.Fatalf("failed to list tags: %v", err)
+			}
+			hasSBOM := slices.ContainsFunc(tags, func(tag string) bool { return strings.HasSuffix(tag, ".sbom") })
+			if hasSBOM != upload {
+				t.Errorf("expected SBOM pushed %t, got tags %v", upload, tags)
+			}
+		})
+	}
+}
+
+func TestExecuteRepoTemplate(t *testing.T) {
+	for _, tc := range []struct {
+		tmpl, ip, workingDir, want string
+	}{
+		{"{{.Repo}}/{{.Basename}}", "github.com/ko-build/terraform-provider-ko/cmd/test", ".", "example.com/repo/test"},
+		{"{{.Repo}}/{{.ImportPath}}", "github.com/ko-build/terraform-provider-ko/cmd/test-cgo", ".", "example.com/repo/github.com/ko-build/terraform-provider-ko/cmd/test-cgo"},
+		{"{{.Repo}}/{{.Basename}}", ".", "../../cmd/test", "example.com/repo/test"},
+		{"{{.Module}}", "github.com/ko-build/terraform-provider-ko/cmd/test", ".", "github.com/ko-build/terraform-provider-ko"},
+	} {
+		t.Run(tc.tmpl, func(t *testing.T) {
+			tmpl := template.Must(template.New("repo_template").Option("missingkey=error").Parse(tc.tmpl))
+			got, err := executeRepoTemplate(context.Background(), tmpl, "example.com/repo", tc.ip, tc.workingDir)
+			if err != nil {
+				t.Fatalf("executeRepoTemplate: %v", err)
+			}
+			if got != tc.want {
+				t.Errorf("got %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestExecuteRepoTemplate_NoGoList(t *testing.T) {
+	// A fully-qualified importpath is used as is, and the module is only listed if the template uses it,
+	// so templates are executed without running go on every read.
+	t.Setenv("KO_GO_PATH", filepath.Join(t.TempDir(), "no-go"))
+	tmpl := template.Must(template.New("repo_template").Option("missingkey=error").Parse("{{.Repo}}/{{.Basename}}"))
+	got, err := executeRepoTemplate(context.Background(), tmpl, "example.com/repo", "github.com/ko-build/terraform-provider-ko/cmd/test", ".")
+	if err != nil {
+		t.Fatalf("executeRepoTemplate: %v", err)
+	}
+	if want := "example.com/repo/test"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	tmpl = template.Must(template.New("repo_template").Option("missingkey=error").Parse("{{.Module}}"))
+	if _, err := executeRepoTemplate(context.Background(), tmpl, "example.com/repo", "github.com/ko-build/terraform-provider-ko/cmd/test", "."); err == nil {
+		t.Error("expected listing the module with KO_GO_PATH missing to fail")
+	}
+}
+
+func TestAccResourceKoBuild_RepoTemplate(t *testing.T) {
+	// Setup a local registry and have tests push to that.
+	srv := httptest.NewServer(registry.New())
+	defer srv.Close()
+	parts := strings.Split(srv.URL, ":")
+	url := fmt.Sprintf("localhost:%s/test", parts[len(parts)-1])
+	t.Setenv("KO_DOCKER_REPO", url)
+
+	var providerConfigured = map[string]func() (*schema.Provider, error){
+		"ko": func() (*schema.Provider, error) { //nolint: unparam
+			p := New("dev")()
+			p.Schema["repo_template"].Default = "{{.Repo}}/{{.Basename}}"
+			return p, nil
+		},
+	}
+
+	// Test that the provider's repo_template is used to name the image,
+	// and that a resource's repo still takes precedence.
+	resource.Test(t, resource.TestCase{
+		ProviderFactories: providerConfigured,
+		Steps: []resource.TestStep{{
+			Config: fmt.Sprintf(`
+		resource "ko_build" "foo" {
+			importpath = "github.com/ko-build/terraform-provider-ko/cmd/test"
+		}
+		resource "ko_build" "bar" {
+			importpath = "github.com/ko-build/terraform-provider-ko/cmd/test"
+			repo = "%s/configured-in-resource"
+		}
+		`, url),
+			Check: resource.ComposeTestCheckFunc(
+				resource.TestMatchResourceAttr("ko_build.foo", "image_ref", regexp.MustCompile("^"+url+"/test@sha256:")),
+				resource.TestMatchResourceAttr("ko_build.bar", "image_ref", regexp.MustCompile("^"+url+"/configured-in-resource@sha256:")),
+			),
+		}},
+	})
+}
+
+func TestCheckBaseDescriptor(t *testing.T) {
+	manifest := func(configMediaType types.MediaType) []byte {
+		b, err := json.Marshal(v1.Manifest{
+			SchemaVersion: 2,
+			MediaType:     types.OCIManifestSchema1,
+			Config: v1.Descriptor{
+				MediaType: configMediaType,
+				Digest:    v1.Hash{Algorithm: "sha256", Hex: strings.Repeat("0", 64)},
+			},
+		})
+		if err != nil {
+			t.Fatalf("json.Marshal: %v", err)
+		}
+		return b
+	}
+
+	for _, tc := range []struct {
+		name      string
+		mediaType types.MediaType
+		manifest  []byte
+		wantErr   string
+	}{
+		{name: "oci image", mediaType: types.OCIManifestSchema1, manifest: manifest(types.OCIConfigJSON)},
+		{name: "docker image", mediaType: types.DockerManifestSchema2, manifest: manifest(types.DockerConfigJSON)},
+		{name: "index", mediaType: types.OCIImageIndex},
+		{name: "empty config", mediaType: types.OCIManifestSchema1, manifest: manifest(ociEmptyJSON), wantErr: "empty config"},
+		{name: "artifact config", mediaType: types.OCIManifestSchema1, manifest: manifest("application/vnd.example.thing+json"), wantErr: "application/vnd.example.thing+json is not a container image config"},
+		{name: "artifact manifest", mediaType: ociArtifactManifest, wantErr: "is an OCI artifact manifest"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			err := checkBaseDescriptor(&remote.Descriptor{
+				Descriptor: v1.Descriptor{MediaType: tc.mediaType},
+				Manifest:   tc.manifest,
+			})
+			switch {
+			case tc.wantErr == "" && err != nil:
+				t.Errorf("unexpected error: %v", err)
+			case tc.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tc.wantErr)):
+				t.Errorf("expected error containing %q, got %v", tc.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestSameImage(t *testing.T) {
+	dig := "sha256:" + strings.Repeat("a", 64)
+	other := "sha256:" + strings.Repeat("b", 64)
+	for _, tc := range []struct {
+		a, b string
+		want bool
+	}{
+		{"example.com/app@" + dig, "example.com/app@" + dig, true},
+		{"example.com/app@" + dig, "example.com/app:v1@" + dig, true},
+		{"example.com/app@" + dig, "example.com/app@" + other, false},
+		{"example.com/app@" + dig, "example.com/other@" + dig, false},
+		{"example.com/app@" + dig, "", false},
+	} {
+		if got := sameImage(tc.a, tc.b); got != tc.want {
+			t.Errorf("sameImage(%q, %q) = %t, want %t", tc.a, tc.b, got, tc.want)
+		}
+	}
+}
+
+func TestResourceID(t *testing.T) {
+	ref := "example.com/app:v1@sha256:" + strings.Repeat("a", 64)
+	for _, tc := range []struct {
+		strategy string
+		tags     []string
+		want     string
+	}{
+		{"digest", []string{"v1"}, ref},
+		{"first_tag", []string{"v1", "v2"}, "example.com/app:v1"},
+		{"first_tag", nil, "example.com/app:latest"},
+		{"importpath", nil, "example.com/cmd/app"},
+	} {
+		got, err := resourceID(buildOptions{ip: "example.com/cmd/app", tags: tc.tags, idStrategy: tc.strategy}, ref)
+		if err != nil {
+			t.Fatalf("resourceID(%s): %v", tc.strategy, err)
+		}
+		if got != tc.want {
+			t.Errorf("resourceID(%s) = %q, want %q", tc.strategy, got, tc.want)
+		}
+	}
+}
+
+func TestAccResourceKoBuild_IDStrategy(t *testing.T) {
+	// Setup a local registry and have tests push to that.
+	srv := httptest.NewServer(registry.New())
+	defer srv.Close()
+	parts := strings.Split(srv.URL, ":")
+	url := fmt.Sprintf("localhost:%s/test", parts[len(parts)-1])
+	t.Setenv("KO_DOCKER_REPO", url)
+
+	cfg := `
+		resource "ko_build" "foo" {
+			importpath  = "github.com/ko-build/terraform-provider-ko/cmd/test"
+			tags        = ["v1"]
+			id_strategy = "first_tag"
+		}
+		`
+	resource.Test(t, resource.TestCase{
+		ProviderFactories: providerFactories,
+		Steps: []resource.TestStep{{
+			Config: cfg,
+			Check: resource.ComposeTestCheckFunc(
+				resource.TestCheckResourceAttr("ko_build.foo", "id", url+"/github.com/ko-build/terraform-provider-ko/cmd/test:v1"),
+				resource.TestMatchResourceAttr("ko_build.foo", "image_ref", regexp.MustCompile("^"+url+"/github.com/ko-build/terraform-provider-ko/cmd/test:v1@sha256:")),
+			),
+		}, {
+			// Rebuilding the same image should not produce a diff.
+			Config:   cfg,
+			PlanOnly: true,
+		}},
+	})
+}
+
+func TestDoBuild_PlatformVariants(t *testing.T) {
+	// Setup a local registry with a multi-platform base image that has several arm variants.
+	srv := httptest.NewServer(registry.New())
+	defer srv.Close()
+	parts := strings.Split(srv.URL, ":")
+	url := fmt.Sprintf("localhost:%s/test", parts[len(parts)-1])
+
+	base := pushBaseIndex(t, url+"/base",
+		v1.Platform{OS: "linux", Architecture: "amd64"},
+		v1.Platform{OS: "linux", Architecture: "arm", Variant: "v6"},
+		v1.Platform{OS: "linux", Architecture: "arm", Variant: "v7"},
+	)
+
+	// Build for both arm variants, but not amd64, and check each variant is built distinctly from the matching base.
+	res, _, err := doBuild(context.Background(), buildOptions{
+		ip:         "github.com/ko-build/terraform-provider-ko/cmd/test",
+		workingDir: ".",
+		imageRepo:  url,
+		platforms:  []string{"linux/arm/v6", "linux/arm/v7"},
+		baseImage:  base,
+		sbom:       "none",
+	})
+	if err != nil {
+		t.Fatalf("doBuild: %v", err)
+	}
+	idx, ok := res.(v1.ImageIndex)
+	if !ok {
+		t.Fatalf("expected an image index, got %T", res)
+	}
+	im, err := idx.IndexManifest()
+	if err != nil {
+		t.Fatalf("IndexManifest: %v", err)
+	}
+	var variants []string
+	for _, desc := range im.Manifests {
+		if desc.Platform == nil || desc.Platform.OS != "linux" || desc.Platform.Architecture != "arm" {
+			t.Fatalf("unexpected platform %v", desc.Platform)
+		}
+		img, err := idx.Image(desc.Digest)
+		if err != nil {
+			t.Fatalf("Image: %v", err)
+		}
+		cf, err := img.ConfigFile()
+		if err != nil {
+			t.Fatalf("ConfigFile: %v", err)
+		}
+		if cf.Architecture != "arm" || cf.Variant != desc.Platform.Variant {
+			t.Errorf("expected config for arm/%s, got %s/%s", desc.Platform.Variant, cf.Architecture, cf.Variant)
+		}
+		variants = append(variants, desc.Platform.Variant)
+	}
+	slices.Sort(variants)
+	if want := []string{"v6", "v7"}; !slices.Equal(variants, want) {
+		t.Errorf("expected variants %v, got %v", want, variants)
+	}
+}
+
+func TestDoBuild_IBMPlatforms(t *testing.T) {
+	// Setup a local registry with a multi-platform base image that includes IBM Z and Power.
+	srv := httptest.NewServer(registry.New())
+	defer srv.Close()
+	parts := strings.Split(srv.URL, ":")
+	url := fmt.Sprintf("localhost:%s/test", parts[len(parts)-1])
+
+	base := pushBaseIndex(t, url+"/base",
+		v1.Platform{OS: "linux", Architecture: "amd64"},
+		v1.Platform{OS: "linux", Architecture: "s390x"},
+		v1.Platform{OS: "linux", Architecture: "ppc64le"},
+	)
+
+	opts := buildOptions{
+		ip:         "github.com/ko-build/terraform-provider-ko/cmd/test",
+		workingDir: ".",
+		imageRepo:  url,
+		platforms:  []string{"linux/s390x", "linux/ppc64le"},
+		baseImage:  base,
+		sbom:       "none",
+	}
+	if err := opts.checkBasePlatforms(context.Background()); err != nil {
+		t.Fatalf("checkBasePlatforms: %v", err)
+	}
+	res, ref, err := doBuild(context.Background(), opts)
+	if err != nil {
+		t.Fatalf("doBuild: %v", err)
+	}
+	idx, ok := res.(v1.ImageIndex)
+	if !ok {
+		t.Fatalf("expected an image index, got %T", res)
+	}
+	im, err := idx.IndexManifest()
+	if err != nil {
+		t.Fatalf("IndexManifest: %v", err)
+	}
+	var archs []string
+	for _, desc := range im.Manifests {
+		img, err := idx.Image(desc.Digest)
+		if err != nil {
+			t.Fatalf("Image: %v", err)
+		}
+		cf, err := img.ConfigFile()
+		if err != nil {
+			t.Fatalf("ConfigFile: %v", err)
+		}
+		if desc.Platform == nil || cf.OS != "linux" || cf.Architecture != desc.Platform.Architecture {
+			t.Errorf("expected config for %v, got %s/%s", desc.Platform, cf.OS, cf.Architecture)
+		}
+		archs = append(archs, cf.Architecture)
+	}
+	slices.Sort(archs)
+	if want := []string{"ppc64le", "s390x"}; !slices.Equal(archs, want) {
+		t.Errorf("expected architectures %v, got %v", want, archs)
+	}
+
+	_, digests, _, err := digestOutputs(res, ref)
+	if err != nil {
+		t.Fatalf("digestOutputs: %v", err)
+	}
+	for _, p := range opts.platforms {
+		if _, ok := digests[p]; !ok {
+			t.Errorf("expected a platform digest for %s, got %v", p, digests)
+		}
+	}
+
+	// The race detector is supported on both.
+	if err := checkRacePlatforms(opts.platforms); err != nil {
+		t.Errorf("checkRacePlatforms: %v", err)
+	}
+}
+
+func TestDoBuild_ReproducibleIndex(t *testing.T) {
+	srv := httptest.NewServer(registry.New())
+	defer srv.Close()
+	parts := strings.Split(srv.URL, ":")
+	url := fmt.Sprintf("localhost:%s/test", parts[len(parts)-1])
+
+	base := pushBaseIndex(t, url+"/base",
+		v1.Platform{OS: "linux", Architecture: "amd64"},
+		v1.Platform{OS: "linux", Architecture: "arm64"},
+	)
+
+	// Build the same two-platform image twice, listing the platforms in a different order,
+	// and check the index is identical byte for byte.
+	var digests []v1.Hash
+	for _, platforms := range [][]string{{"linux/amd64", "linux/arm64"}, {"linux/arm64", "linux/amd64"}} {
+		res, _, err := doBuild(context.Background(), buildOptions{
+			ip:          "github.com/ko-build/terraform-provider-ko/cmd/test",
+			workingDir:  ".",
+			imageRepo:   url,
+			platforms:   platforms,
+			baseImage:   base,
+			sbom:        "spdx",
+			annotations: map[string]string{"b": "2", "a": "1"},
+		})
+		if err != nil {
+			t.Fatalf("doBuild: %v", err)
+		}
+		if _, ok := res.(v1.ImageIndex); !ok {
+			t.Fatalf("expected an image index, got %T", res)
+		}
+		dig, err := res.Digest()
+		if err != nil {
+			t.Fatalf("Digest: %v", err)
+		}
+		digests = append(digests, dig)
+	}
+	if digests[0] != digests[1] {
+		t.Errorf("expected the same index digest for both builds, got %s and %s", digests[0], digests[1])
+	}
+}
+
+func TestDigestOutputs(t *testing.T) {
+	// Setup a local registry to serve the base image.
+	srv := httptest.NewServer(registry.New())
+	defer srv.Close()
+	parts := strings.Split(srv.URL, ":")
+	url := fmt.Sprintf("localhost:%s/test", parts[len(parts)-1])
+	base := pushBaseIndex(t, url+"/base",
+		v1.Platform{OS: "linux", Architecture: "amd64"},
+		v1.Platform{OS: "linux", Architecture: "arm", Variant: "v7"},
+	)
+
+	for _, platforms := range [][]string{{"linux/amd64"}, {"linux/amd64", "linux/arm/v7"}} {
+		t.Run(strings.Join(platforms, ","), func(t *testing.T) {
+			res, ref, err := doBuild(context.Background(), buildOptions{
+				ip:         "github.com/ko-build/terraform-provider-ko/cmd/test",
+				workingDir: ".",
+				imageRepo:  url,
+				platforms:  platforms,
+				baseImage:  base,
+				sbom:       "none",
+			})
+			if err != nil {
+				t.Fatalf("doBuild: %v", err)
+			}
+			refs, digests, indexDigest, err := digestOutputs(res, ref)
+			if err != nil {
+				t.Fatalf("digestOutputs: %v", err)
+			}
+			if len(refs) != len(platforms) {
+				t.Fatalf("expected %d image refs, got %v", len(platforms), refs)
+			}
+			repo := ref[:strings.Index(ref, "@")]
+			for _, p := range platforms {
+				got, ok := refs[p].(string)
+				if !ok || !strings.HasPrefix(got, repo+"@sha256:") {
+					t.Errorf("expected an image ref in %s for %s, got %v", repo, p, refs[p])
+				}
+			}
+			for p, dig := range digests {
+				if want := repo + "@" + dig.(string); refs[p] != want {
+					t.Errorf("expected image ref %s for %s, got %v", want, p, refs[p])
+				}
+			}
+			if len(platforms) == 1 {
+				if refs[platforms[0]] != ref {
+					t.Errorf("expected single-platform image ref %s, got %v", ref, refs[platforms[0]])
+				}
+				if indexDigest != "" {
+					t.Errorf("expected no index digest for a single-platform image, got %s", indexDigest)
+				}
+			} else if want := repo + "@" + indexDigest; ref != want {
+				t.Errorf("expected image ref %s to be the index digest, got %s", want, ref)
+			}
+		})
+	}
+}
+
+func TestCheckRacePlatforms(t *testing.T) {
+	for _, tc := range []struct {
+		platforms []string
+		wantErr   string
+	}{
+		{[]string{"linux/amd64", "linux/arm64", "windows/amd64"}, ""},
+		{[]string{"linux/amd64/v3"}, ""},
+		{[]string{"linux/amd64", "linux/arm/v7", "linux/386"}, "race is not supported on platforms linux/arm/v7, linux/386"},
+		{[]string{"all"}, `race cannot be used with platforms "all"`},
+	} {
+		err := checkRacePlatforms(tc.platforms)
+		if tc.wantErr == "" {
+			if err != nil {
+				t.Errorf("checkRacePlatforms(%v): %v", tc.platforms, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+			t.Errorf("checkRacePlatforms(%v) = %v, want error containing %q", tc.platforms, err, tc.wantErr)
+		}
+	}
+}
+
+func TestDoBuild_Race(t *testing.T) {
+	if _, err := exec.LookPath("gcc"); err != nil {
+		t.Skip("race builds require a C compiler")
+	}
+
+	// Setup a local registry to serve the base image.
+	srv := httptest.NewServer(registry.New())
+	defer srv.Close()
+	parts := strings.Split(srv.URL, ":")
+	url := fmt.Sprintf("localhost:%s/test", parts[len(parts)-1])
+	base := pushBaseIndex(t, url+"/base", v1.Platform{OS: "linux", Architecture: runtime.GOARCH})
+
+	res, _, err := doBuild(context.Background(), buildOptions{
+		ip:         "github.com/ko-build/terraform-provider-ko/cmd/test",
+		workingDir: ".",
+		imageRepo:  url,
+		platforms:  []string{"linux/" + runtime.GOARCH},
+		baseImage:  base,
+		sbom:       "none",
+		race:       true,
+	})
+	if err != nil {
+		t.Fatalf("doBuild: %v", err)
+	}
+	info, err := buildInfoOf(res)
+	if err != nil {
+		t.Fatalf("buildInfoOf: %v", err)
+	}
+	settings := map[string]string{}
+	for _, s := range info.Settings {
+		settings[s.Key] = s.Value
+	}
+	if settings["-race"] != "true" || settings["CGO_ENABLED"] != "1" {
+		t.Errorf("expected a race build with cgo enabled, got settings %v", settings)
+	}
+}
+
+func TestDoBuild_BuildTags(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("running the built binary requires a linux host")
+	}
+
+	// Setup a local registry to serve the base image.
+	srv := httptest.NewServer(registry.New())
+	defer srv.Close()
+	parts := strings.Split(srv.URL, ":")
+	url := fmt.Sprintf("localhost:%s/test", parts[len(parts)-1])
+	base := pushBaseIndex(t, url+"/base", v1.Platform{OS: "linux", Architecture: runtime.GOARCH})
+
+	for _, tc := range []struct {
+		buildTags []string
+		want      string
+	}{
+		{nil, "hello"},
+		{[]string{"loud"}, "HELLO"},
+		{[]string{"other", "loud"}, "HELLO"},
+	} {
+		t.Run(strings.Join(tc.buildTags, ","), func(t *testing.T) {
+			res, _, err := doBuild(context.Background(), buildOptions{
+				ip:         "github.com/ko-build/terraform-provider-ko/cmd/test-tags",
+				workingDir: ".",
+				imageRepo:  url,
+				platforms:  []string{"linux/" + runtime.GOARCH},
+				baseImage:  base,
+				sbom:       "none",
+				buildTags:  tc.buildTags,
+			})
+			if err != nil {
+				t.Fatalf("doBuild: %v", err)
+			}
+			b, err := binaryOf(res)
+			if err != nil {
+				t.Fatalf("binaryOf: %v", err)
+			}
+			bin := filepath.Join(t.TempDir(), "test-tags")
+			if err := os.WriteFile(bin, b, 0o755); err != nil {
+				t.Fatalf("WriteFile: %v", err)
+			}
+			out, err := exec.Command(bin).Output()
+			if err != nil {
+				t.Fatalf("running binary: %v", err)
+			}
+			if got := strings.TrimSpace(string(out)); got != tc.want {
+				t.Errorf("expected the binary to print %q, got %q", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestDoBuild_Gcflags(t *testing.T) {
+	// Setup a local registry to serve the base image.
+	srv := httptest.NewServer(registry.New())
+	defer srv.Close()
+	parts := strings.Split(srv.URL, ":")
+	url := fmt.Sprintf("localhost:%s/test", parts[len(parts)-1])
+	base := pushBaseIndex(t, url+"/base", v1.Platform{OS: "linux", Architecture: "amd64"})
+
+	res, _, err := doBuild(context.Background(), buildOptions{
+		ip:         "github.com/ko-build/terraform-provider-ko/cmd/test",
+		workingDir: ".",
+		imageRepo:  url,
+		platforms:  []string{"linux/amd64"},
+		baseImage:  base,
+		sbom:       "none",
+		gcflags:    []string{"all=-N -l"},
+		asmflags:   []string{"all=-trimpath=/src"},
+	})
+	if err != nil {
+		t.Fatalf("doBuild: %v", err)
+	}
+	if _, err := res.Digest(); err != nil {
+		t.Fatalf("Digest: %v", err)
+	}
+	info, err := buildInfoOf(res)
+	if err != nil {
+		t.Fatalf("buildInfoOf: %v", err)
+	}
+	settings := map[string]string{}
+	for _, s := range info.Settings {
+		settings[s.Key] = s.Value
+	}
+	if settings["-gcflags"] != "all=-N -l" || settings["-asmflags"] != "all=-trimpath=/src" {
+		t.Errorf("expected the build to use the gcflags and asmflags, got settings %v", settings)
+	}
+}
+
+func TestDoBuild_Trimpath(t *testing.T) {
+	// Setup a local registry to serve the base image.
+	srv := httptest.NewServer(registry.New())
+	defer srv.Close()
+	parts := strings.Split(srv.URL, ":")
+	url := fmt.Sprintf("localhost:%s/test", parts[len(parts)-1])
+	base := pushBaseIndex(t, url+"/base", v1.Platform{OS: "linux", Architecture: "amd64"})
+
+	for _, noTrimpath := range []bool{false, true} {
+		t.Run(fmt.Sprintf("noTrimpath=%t", noTrimpath), func(t *testing.T) {
+			res, _, err := doBuild(context.Background(), buildOptions{
+				ip:         "github.com/ko-build/terraform-provider-ko/cmd/test",
+				workingDir: ".",
+				imageRepo:  url,
+				platforms:  []string{"linux/amd64"},
+				baseImage:  base,
+				sbom:       "none",
+				noTrimpath: noTrimpath,
+			})
+			if err != nil {
+				t.Fatalf("doBuild: %v", err)
+			}
+			info, err := buildInfoOf(res)
+			if err != nil {
+				t.Fatalf("buildInfoOf: %v", err)
+			}
+			trimpath := false
+			for _, s := range info.Settings {
+				if s.Key == "-trimpath" && s.Value == "true" {
+					trimpath = true
+				}
+			}
+			if trimpath == noTrimpath {
+				t.Errorf("expected -trimpath %t, got settings %v", !noTrimpath, info.Settings)
+			}
+		})
+	}
+}
+
+func TestMergeDefaults(t *testing.T) {
+	for _, tc := range []struct {
+		defaults, values, want []string
+	}{
+		{nil, nil, nil},
+		{nil, []string{"-s"}, []string{"-s"}},
+		{[]string{"-s", "-w"}, nil, []string{"-s", "-w"}},
+		{[]string{"GOFLAGS=-trimpath", "FOO=provider"}, []string{"FOO=resource"}, []string{"GOFLAGS=-trimpath", "FOO=provider", "FOO=resource"}},
+	} {
+		if got := mergeDefaults(tc.defaults, tc.values); !slices.Equal(got, tc.want) {
+			t.Errorf("mergeDefaults(%v, %v) = %v, want %v", tc.defaults, tc.values, got, tc.want)
+		}
+	}
+
+	// Merging must not modify the provider's defaults, which are shared by every resource.
+	defaults := make([]string, 1, 10)
+	defaults[0] = "-s"
+	_ = mergeDefaults(defaults, []string{"-w"})
+	if got := defaults[:2]; got[1] != "" {
+		t.Errorf("mergeDefaults modified the defaults: %v", got)
+	}
+}
+
+func TestToStringSlice(t *testing.T) {
+	got, err := toStringSlice([]interface{}{"-s", "-w"})
+	if err != nil {
+		t.Fatalf("toStringSlice: %v", err)
+	}
+	if want := []string{"-s", "-w"}; !slices.Equal(got, want) {
+		t.Errorf("toStringSlice = %v, want %v", got, want)
+	}
+
+	// A non-string element is an error, not a panic that would crash the provider.
+	if _, err := toStringSlice([]interface{}{"-s", 42}); err == nil || !strings.Contains(err.Error(), "element 1: expected string, got int") {
+		t.Errorf("expected an error for the non-string element, got %v", err)
+	}
+	if _, err := toStringMap(map[string]interface{}{"a": "b", "c": nil}); err == nil || !strings.Contains(err.Error(), `key "c": expected string, got <nil>`) {
+		t.Errorf("expected an error for the non-string value, got %v", err)
+	}
+}
+
+func TestAccResourceKoBuild_ProviderDefaults(t *testing.T) {
+	// Setup a local registry and have tests push to that.
+	srv := httptest.NewServer(registry.New())
+	defer srv.Close()
+	parts := strings.Split(srv.URL, ":")
+	url := fmt.Sprintf("localhost:%s/test", parts[len(parts)-1])
+	t.Setenv("KO_DOCKER_REPO", url)
+
+	// Test that the provider's ldflags and env are applied to every build, followed by the resource's.
+	resource.Test(t, resource.TestCase{
+		ProviderFactories: providerFactories,
+		Steps: []resource.TestStep{{
+			Config: `
+		provider "ko" {
+			ldflags = ["-s", "-w"]
+			env     = ["GOFLAGS=-trimpath"]
+		}
+
+		resource "ko_build" "foo" {
+			importpath = "github.com/ko-build/terraform-provider-ko/cmd/test"
+			ldflags    = ["-X main.version=1.2.3"]
+		}
+
+		resource "ko_build" "bar" {
+			importpath = "github.com/ko-build/terraform-provider-ko/cmd/test"
+		}
+		`,
+			Check: resource.ComposeTestCheckFunc(
+				resource.TestCheckResourceAttr("ko_build.foo", "effective_options.0.ldflags.#", "3"),
+				resource.TestCheckResourceAttr("ko_build.foo", "effective_options.0.ldflags.0", "-s"),
+				resource.TestCheckResourceAttr("ko_build.foo", "effective_options.0.ldflags.2", "-X main.version=1.2.3"),
+				resource.TestCheckResourceAttr("ko_build.foo", "effective_options.0.env.#", "1"),
+				resource.TestCheckResourceAttr("ko_build.bar", "effective_options.0.ldflags.#", "2"),
+				resource.TestCheckResourceAttr("ko_build.bar", "effective_options.0.env.0", "GOFLAGS=-trimpath"),
+			),
+		}},
+	})
+}
+
+func TestSourceDateEpoch(t *testing.T) {
+	t.Setenv("SOURCE_DATE_EPOCH", "")
+	if got, err := sourceDateEpoch(); err != nil || got != nil {
+		t.Errorf("expected no creation time when unset, got %v, %v", got, err)
+	}
+
+	t.Setenv("SOURCE_DATE_EPOCH", "1700000000")
+	if got, err := sourceDateEpoch(); err != nil || got == nil || got.Unix() != 1700000000 {
+		t.Errorf("expected creation time 1700000000, got %v, %v", got, err)
+	}
+
+	t.Setenv("SOURCE_DATE_EPOCH", "not-a-number")
+	opts := buildOptions{
+		ip:         "github.com/ko-build/terraform-provider-ko/cmd/test",
+		workingDir: ".",
+		platforms:  []string{"linux/amd64"},
+		sbom:       "none",
+	}
+	if _, err := opts.makeBuilder(context.Background()); err == nil || !strings.Contains(err.Error(), "SOURCE_DATE_EPOCH") {
+		t.Errorf("expected strict builds to fail on invalid SOURCE_DATE_EPOCH, got %v", err)
+	}
+	if diags := sourceDateEpochWarnings(opts); diags != nil {
+		t.Errorf("expected no warnings for strict builds, got %v", diags)
+	}
+
+	opts.lenientSourceDateEpoch = true
+	if _, err := opts.makeBuilder(context.Background()); err != nil {
+		t.Errorf("expected lenient builds to ignore invalid SOURCE_DATE_EPOCH, got %v", err)
+	}
+	if diags := sourceDateEpochWarnings(opts); len(diags) != 1 || diags[0].Severity != diag.Warning {
+		t.Errorf("expected a warning for lenient builds, got %v", diags)
+	}
+
+	// The resource's source_date_epoch takes precedence over the environment variable, even when that's invalid.
+	opts.sourceDateEpoch = "1600000000"
+	if got, err := opts.creationTime(); err != nil || got == nil || got.Unix() != 1600000000 {
+		t.Errorf("expected creation time 1600000000, got %v, %v", got, err)
+	}
+	if diags := sourceDateEpochWarnings(opts); diags != nil {
+		t.Errorf("expected no warnings when source_date_epoch is set, got %v", diags)
+	}
+	t.Setenv("SOURCE_DATE_EPOCH", "1700000000")
+	if got, err := opts.creationTime(); err != nil || got == nil || got.Unix() != 1600000000 {
+		t.Errorf("expected source_date_epoch to override SOURCE_DATE_EPOCH, got %v, %v", got, err)
+	}
+
+	// An invalid source_date_epoch fails the build, whatever the provider's leniency.
+	opts.sourceDateEpoch = "yesterday"
+	if _, err := opts.makeBuilder(context.Background()); err == nil || !strings.Contains(err.Error(), "source_date_epoch should be the number of seconds") {
+		t.Errorf("expected builds to fail on invalid source_date_epoch, got %v", err)
+	}
+}
+
+func TestRestrictToBasePlatforms(t *testing.T) {
+	// Setup a local registry to serve the base image.
+	srv := httptest.NewServer(registry.New())
+	defer srv.Close()
+	parts := strings.Split(srv.URL, ":")
+	url := fmt.Sprintf("localhost:%s/test", parts[len(parts)-1])
+	base := pushBaseIndex(t, url+"/base",
+		v1.Platform{OS: "linux", Architecture: "amd64"},
+		v1.Platform{OS: "linux", Architecture: "arm", Variant: "v7"},
+	)
+
+	for _, tc := range []struct {
+		platforms, wantPlatforms, wantDropped []string
+		wantErr                               string
+	}{
+		{[]string{"all"}, []string{"all"}, nil, ""},
+		{[]string{"linux/amd64", "linux/arm/v7"}, []string{"linux/amd64", "linux/arm/v7"}, nil, ""},
+		{[]string{"linux/amd64", "linux/arm64", "linux/arm/v6"}, []string{"linux/amd64"}, []string{"linux/arm64", "linux/arm/v6"}, ""},
+		{[]string{"linux/arm"}, []string{"linux/arm"}, nil, ""},
+		{[]string{"linux/s390x"}, nil, nil, "provides none of the platforms linux/s390x"},
+	} {
+		t.Run(strings.Join(tc.platforms, ","), func(t *testing.T) {
+			opts := buildOptions{baseImage: base, platforms: tc.platforms}
+			dropped, err := opts.restrictToBasePlatforms(context.Background())
+			if tc.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+					t.Fatalf("expected error containing %q, got %v", tc.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("restrictToBasePlatforms: %v", err)
+			}
+			if !slices.Equal(opts.platforms, tc.wantPlatforms) {
+				t.Errorf("expected platforms %v, got %v", tc.wantPlatforms, opts.platforms)
+			}
+			if !slices.Equal(dropped, tc.wantDropped) {
+				t.Errorf("expected dropped platforms %v, got %v", tc.wantDropped, dropped)
+			}
+		})
+	}
+}
+
+func TestDoBuild_MissingBasePlatforms(t *testing.T) {
+	// Setup a local registry to serve the base image.
+	srv := httptest.NewServer(registry.New())
+	defer srv.Close()
+	parts := strings.Split(srv.URL, ":")
+	url := fmt.Sprintf("localhost:%s/test", parts[len(parts)-1])
+	base := pushBaseIndex(t, url+"/base",
+		v1.Platform{OS: "linux", Architecture: "amd64"},
+		v1.Platform{OS: "linux", Architecture: "arm", Variant: "v7"},
+	)
+
+	for _, tc := range []struct {
+		platforms []string
+		wantErr   string
+	}{
+		{[]string{"all"}, ""},
+		{[]string{"linux/amd64", "linux/arm"}, ""},
+		{[]string{"linux/amd64", "linux/arm64", "linux/s390x"}, "does not provide platforms linux/arm64, linux/s390x; it provides linux/amd64, linux/arm/v7"},
+	} {
+		t.Run(strings.Join(tc.platforms, ","), func(t *testing.T) {
+			opts := buildOptions{baseImage: base, platforms: tc.platforms}
+			err := opts.checkBasePlatforms(context.Background())
+			if tc.wantErr == "" {
+				if err != nil {
+					t.Fatalf("checkBasePlatforms: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Fatalf("expected error containing %q, got %v", tc.wantErr, err)
+			}
+
+			// doBuild fails with the same error, before building anything.
+			opts.ip = "github.com/ko-build/terraform-provider-ko/cmd/test"
+			opts.imageRepo = url
+			opts.sbom = "none"
+			if _, _, err := doBuild(context.Background(), opts); err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Fatalf("expected doBuild error containing %q, got %v", tc.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestBaseImageOverrides(t *testing.T) {
+	// Setup a local registry and have tests push to that.
+	srv := httptest.NewServer(registry.New())
+	defer srv.Close()
+	parts := strings.Split(srv.URL, ":")
+	url := fmt.Sprintf("localhost:%s/test", parts[len(parts)-1])
+	baseA := pushBaseIndex(t, url+"/base-a", v1.Platform{OS: "linux", Architecture: "amd64"})
+	baseB := pushBaseIndex(t, url+"/base-b", v1.Platform{OS: "linux", Architecture: "amd64"})
+	baseDefault := pushBaseIndex(t, url+"/base-default", v1.Platform{OS: "linux", Architecture: "amd64"})
+
+	const (
+		ipA = "github.com/ko-build/terraform-provider-ko/cmd/test"
+		ipB = "github.com/ko-build/terraform-provider-ko/cmd/test-tags"
+		ipC = "github.com/ko-build/terraform-provider-ko/cmd/test-lambda"
+	)
+	overrides := map[string]interface{}{ipA: baseA, ipB: baseB}
+	po := &Opts{
+		bo: &options.BuildOptions{},
+		po: &options.PublishOptions{DockerRepo: url},
+	}
+
+	for _, tc := range []struct {
+		ip, workingDir string
+		overrides      map[string]interface{}
+		want           string
+	}{
+		{ipA, ".", overrides, baseA},
+		{ipB, ".", overrides, baseB},
+		{ipC, ".", overrides, baseDefault},
+		// Keys and importpaths are compared as fully-qualified import paths, either of which may be relative to working_dir.
+		{"./cmd/test", "../..", overrides, baseA},
+		{".", "../../cmd/test-tags", overrides, baseB},
+		{ipB, "../..", map[string]interface{}{"./cmd/test-tags": baseB}, baseB},
+		{"./cmd/test-tags", "../..", map[string]interface{}{"./cmd/test-tags": baseB, ipA: baseA}, baseB},
+	} {
+		want := tc.want
+		t.Run(tc.ip+" in "+tc.workingDir, func(t *testing.T) {
+			d := schema.TestResourceDataRaw(t, resourceBuild().Schema, map[string]interface{}{
+				"importpath":           tc.ip,
+				"working_dir":          tc.workingDir,
+				"base_image":           baseDefault,
+				"base_image_overrides": tc.overrides,
+				"sbom":                 "none",
+			})
+			opts, err := fromData(context.Background(), d, po)
+			if err != nil {
+				t.Fatalf("fromData: %v", err)
+			}
+			if opts.baseImage != want {
+				t.Errorf("expected base image %s, got %s", want, opts.baseImage)
+			}
+
+			// The image is built on the base image's layers.
+			res, _, err := doBuild(context.Background(), opts)
+			if err != nil {
+				t.Fatalf("doBuild: %v", err)
+			}
+			got, err := baseImageOf(res)
+			if err != nil {
+				t.Fatalf("baseImageOf: %v", err)
+			}
+			if !strings.HasPrefix(got, want+"@") {
+				t.Errorf("expected an image built on %s, got %s", want, got)
+			}
+			r, err := name.ParseReference(want)
+			if err != nil {
+				t.Fatalf("ParseReference: %v", err)
+			}
+			base, err := remote.Image(r)
+			if err != nil {
+				t.Fatalf("remote.Image: %v", err)
+			}
+			baseLayers, err := base.Layers()
+			if err != nil {
+				t.Fatalf("Layers: %v", err)
+			}
+			layers, err := res.(v1.Image).Layers()
+			if err != nil {
+				t.Fatalf("Layers: %v", err)
+			}
+			wantDigest, err := baseLayers[0].Digest()
+			if err != nil {
+				t.Fatalf("Digest: %v", err)
+			}
+			gotDigest, err := layers[0].Digest()
+			if err != nil {
+				t.Fatalf("Digest: %v", err)
+			}
+			if gotDigest != wantDigest {
+				t.Errorf("expected base layer %s, got %s", wantDigest, gotDigest)
+			}
+		})
+	}
+}
+
+func TestBaseImageOverride(t *testing.T) {
+	const ip = "github.com/ko-build/terraform-provider-ko/cmd/test"
+	for _, tc := range []struct {
+		desc      string
+		overrides map[string]string
+		want      string
+		wantErr   bool
+	}{{
+		desc:      "no match",
+		overrides: map[string]string{"github.com/ko-build/terraform-provider-ko/cmd/test-tags": "example.com/tags"},
+	}, {
+		desc:      "relative key for a missing package",
+		overrides: map[string]string{"./missing": "example.com/missing"},
+	}, {
+		desc:      "same base image for the same package",
+		overrides: map[string]string{ip: "example.com/base", "../../cmd/test": "example.com/base"},
+		want:      "example.com/base",
+	}, {
+		desc:      "different base images for the same package",
+		overrides: map[string]string{ip: "example.com/a", "../../cmd/test": "example.com/b"},
+		wantErr:   true,
+	}} {
+		t.Run(tc.desc, func(t *testing.T) {
+			got, ok, err := baseImageOverride(context.Background(), tc.overrides, ip, ".")
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("baseImageOverride() error = %v, wantErr %t", err, tc.wantErr)
+			}
+			if got != tc.want || ok != (tc.want != "") {
+				t.Errorf("baseImageOverride() = %q, %t, want %q", got, ok, tc.want)
+			}
+		})
+	}
+}
+
+func TestBaseImageOverride_NoGoList(t *testing.T) {
+	// Keys that aren't relative are compared with a fully-qualified importpath as is, without listing packages,
+	// and relative keys that can't be resolved, here because there's no go command to list them, are skipped.
+	t.Setenv("PATH", t.TempDir())
+	const ip = "github.com/ko-build/terraform-provider-ko/cmd/test"
+	overrides := map[string]string{
+		"../../cmd/test-tags": "example.com/tags",
+		"ko://" + ip:          "example.com/base",
+	}
+	got, ok, err := baseImageOverride(context.Background(), overrides, ip, ".")
+	if err != nil || !ok || got != "example.com/base" {
+		t.Errorf("baseImageOverride() = %q, %t, %v, want %q", got, ok, err, "example.com/base")
+	}
+}
+
+func TestProviderBaseImage(t *testing.T) {
+	// Setup a local registry and have tests push to that.
+	srv := httptest.NewServer(registry.New())
+	defer srv.Close()
+	parts := strings.Split(srv.URL, ":")
+	url := fmt.Sprintf("localhost:%s/test", parts[len(parts)-1])
+	providerBase := pushBaseIndex(t, url+"/provider-base", v1.Platform{OS: "linux", Architecture: "amd64"})
+	resourceBase := pushBaseIndex(t, url+"/resource-base", v1.Platform{OS: "linux", Architecture: "amd64"})
+
+	po := &Opts{
+		bo: &options.BuildOptions{BaseImage: providerBase},
+		po: &options.PublishOptions{DockerRepo: url},
+	}
+	const ip = "github.com/ko-build/terraform-provider-ko/cmd/test"
+
+	// A ko_build without a base_image inherits the provider's.
+	for _, c := range []struct {
+		desc string
+		raw  map[string]interface{}
+		want string
+	}{{
+		desc: "inherited",
+		raw:  map[string]interface{}{"importpath": ip, "sbom": "none"},
+		want: providerBase,
+	}, {
+		desc: "overridden",
+		raw:  map[string]interface{}{"importpath": ip, "sbom": "none", "base_image": resourceBase},
+		want: resourceBase,
+	}} {
+		t.Run(c.desc, func(t *testing.T) {
+			opts, err := fromData(context.Background(), schema.TestResourceDataRaw(t, resourceBuild().Schema, c.raw), po)
+			if err != nil {
+				t.Fatalf("fromData: %v", err)
+			}
+			if opts.baseImage != c.want {
+				t.Errorf("expected base image %s, got %s", c.want, opts.baseImage)
+			}
+		})
+	}
+
+	// So does the ko_build data source.
+	t.Run("data source", func(t *testing.T) {
+		d := schema.TestResourceDataRaw(t, dataSourceBuild().Schema, map[string]interface{}{
+			"importpath": ip,
+			"sbom":       "none",
+			"push":       true,
+		})
+		if diags := dataSourceBuildRead(context.Background(), d, po); diags.HasError() {
+			t.Fatalf("dataSourceBuildRead: %v", diags)
+		}
+		ref, err := name.ParseReference(d.Get("image_ref").(string))
+		if err != nil {
+			t.Fatalf("ParseReference: %v", err)
+		}
+		img, err := remote.Image(ref)
+		if err != nil {
+			t.Fatalf("remote.Image: %v", err)
+		}
+		got, err := baseImageOf(img)
+		if err != nil {
+			t.Fatalf("baseImageOf: %v", err)
+		}
+		if !strings.HasPrefix(got, providerBase+"@") {
+			t.Errorf("expected an image built on %s, got %s", providerBase, got)
+		}
+	})
+}
+
+func TestSinglePlatformBaseWarning(t *testing.T) {
+	// Setup a local registry to serve the base images.
+	srv := httptest.NewServer(registry.New())
+	defer srv.Close()
+	parts := strings.Split(srv.URL, ":")
+	url := fmt.Sprintf("localhost:%s/test", parts[len(parts)-1])
+	index := pushBaseIndex(t, url+"/index",
+		v1.Platform{OS: "linux", Architecture: "amd64"},
+		v1.Platform{OS: "linux", Architecture: "arm64"},
+	)
+
+	// A single-platform base image, not in an index.
+	img, err := random.Image(1024, 1)
+	if err != nil {
+		t.Fatalf("random.Image: %v", err)
+	}
+	cf, err := img.ConfigFile()
+	if err != nil {
+		t.Fatalf("ConfigFile: %v", err)
+	}
+	cf.OS, cf.Architecture = "linux", "arm64"
+	if img, err = mutate.ConfigFile(img, cf); err != nil {
+		t.Fatalf("mutate.ConfigFile: %v", err)
+	}
+	single := url + "/single"
+	r, err := name.ParseReference(single)
+	if err != nil {
+		t.Fatalf("ParseReference: %v", err)
+	}
+	if err := remote.Write(r, img); err != nil {
+		t.Fatalf("pushing base: %v", err)
+	}
+
+	for _, tc := range []struct {
+		desc      string
+		baseImage string
+		platforms []string
+		want      string
+	}{
+		{"all, single", single, []string{"all"}, "is a single-platform image rather than an image index, so only linux/arm64 is built"},
+		{"all, index", index, []string{"all"}, ""},
+		{"one platform, single", single, []string{"linux/arm64"}, ""},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			opts := buildOptions{baseImage: tc.baseImage, platforms: tc.platforms}
+			msg, err := opts.singlePlatformBaseWarning(context.Background())
+			if err != nil {
+				t.Fatalf("singlePlatformBaseWarning: %v", err)
+			}
+			if tc.want == "" && msg != "" {
+				t.Errorf("expected no warning, got %q", msg)
+			} else if !strings.Contains(msg, tc.want) {
+				t.Errorf("expected warning containing %q, got %q", tc.want, msg)
+			}
+		})
+	}
+}
+
+func TestToDigestRef(t *testing.T) {
+	const dig = "sha256:0000000000000000000000000000000000000000000000000000000000000000"
+	for _, ref := range []string{
+		"example.com/repo@" + dig,
+		"example.com/repo:v1@" + dig,
+	} {
+		got, err := toDigestRef(ref)
+		if err != nil {
+			t.Fatalf("toDigestRef(%q): %v", ref, err)
+		}
+		if want := "example.com/repo@" + dig; got != want {
+			t.Errorf("toDigestRef(%q) = %q, want %q", ref, got, want)
+		}
+	}
+	if _, err := toDigestRef("example.com/repo:v1"); err == nil {
+		t.Error("expected error for a reference without a digest")
+	}
+}
+
+// pushBaseIndex pushes an index of random images for each of the platforms to ref, for use as a base image, and returns ref.
+func pushBaseIndex(t *testing.T, ref string, platforms ...v1.Platform) string {
+	t.Helper()
+	var adds []mutate.IndexAddendum
+	for _, p := range platforms {
+		img, err := random.Image(1024, 1)
+		if err != nil {
+			t.Fatalf("random.Image: %v", err)
+		}
+		cf, err := img.ConfigFile()
+		if err != nil {
+			t.Fatalf("ConfigFile: %v", err)
+		}
+		cf.OS, cf.Architecture, cf.Variant = p.OS, p.Architecture, p.Variant
+		if img, err = mutate.ConfigFile(img, cf); err != nil {
+			t.Fatalf("mutate.ConfigFile: %v", err)
+		}
+		p := p
+		adds = append(adds, mutate.IndexAddendum{Add: img, Descriptor: v1.Descriptor{Platform: &p}})
+	}
+	r, err := name.ParseReference(ref)
+	if err != nil {
+		t.Fatalf("ParseReference: %v", err)
+	}
+	if err := remote.WriteIndex(r, mutate.AppendManifests(empty.Index, adds...)); err != nil {
+		t.Fatalf("pushing base: %v", err)
+	}
+	return ref
+}
+
+func TestResolveImportpath(t *testing.T) {
+	for _, tc := range []struct {
+		ip, workingDir string
+	}{
+		{"github.com/ko-build/terraform-provider-ko/cmd/test", "."},
+		{"ko://github.com/ko-build/terraform-provider-ko/cmd/test", "."},
+		{".", "../../cmd/test"},
+		{"./cmd/test", "../.."},
+	} {
+		t.Run(tc.ip, func(t *testing.T) {
+			got, err := resolveImportpath(context.Background(), buildOptions{
+				ip:         tc.ip,
+				workingDir: tc.workingDir,
+				platforms:  []string{"linux/amd64"},
+				sbom:       "none",
+			})
+			if err != nil {
+				t.Fatalf("resolveImportpath: %v", err)
+			}
+			if want := "github.com/ko-build/terraform-provider-ko/cmd/test"; got != want {
+				t.Errorf("resolveImportpath(%q in %q) = %q, want %q", tc.ip, tc.workingDir, got, want)
+			}
+		})
+	}
+}
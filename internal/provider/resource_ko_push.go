@@ -0,0 +1,171 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/layout"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+)
+
+func resourcePush() *schema.Resource {
+	return &schema.Resource{
+		Description: "Publishes an image saved to an OCI image layout, for example by `ko_build` with `oci_layout_dir` set, to a container registry. This allows images to be built and pushed in separate stages.",
+
+		CreateContext: resourceKoPushCreate,
+		ReadContext:   resourceKoPushRead,
+		DeleteContext: resourceKoPushDelete,
+
+		Schema: map[string]*schema.Schema{
+			"oci_layout_dir": {
+				Description: "Directory containing the OCI image layout to push from",
+				Type:        schema.TypeString,
+				Required:    true,
+				ForceNew:    true, // Any time this changes, don't try to update in-place, just create it.
+			},
+			"repo": {
+				Description: "Container repository to push the image to",
+				Type:        schema.TypeString,
+				Required:    true,
+				ForceNew:    true, // Any time this changes, don't try to update in-place, just create it.
+			},
+			"digest": {
+				Description: "Digest of the image or index in the layout to push. Defaults to the image most recently saved to the layout.",
+				Type:        schema.TypeString,
+				Optional:    true,
+				Computed:    true,
+				ForceNew:    true, // Any time this changes, don't try to update in-place, just create it.
+			},
+			"image_ref": {
+				Description: "The pushed image reference, in the form `repo@digest`",
+				Type:        schema.TypeString,
+				Computed:    true,
+			},
+		},
+	}
+}
+
+// layoutDescriptor returns the descriptor in the layout's index with the given digest, or the last one if digest is empty.
+func layoutDescriptor(dir string, idx v1.ImageIndex, digest string) (v1.Descriptor, error) {
+	im, err := idx.IndexManifest()
+	if err != nil {
+		return v1.Descriptor{}, fmt.Errorf("reading OCI layout %s: %w", dir, err)
+	}
+	if len(im.Manifests) == 0 {
+		return v1.Descriptor{}, fmt.Errorf("OCI layout %s contains no images", dir)
+	}
+	if digest == "" {
+		return im.Manifests[len(im.Manifests)-1], nil
+	}
+	for _, desc := range im.Manifests {
+		if desc.Digest.String() == digest {
+			return desc, nil
+		}
+	}
+	return v1.Descriptor{}, fmt.Errorf("OCI layout %s does not contain %s", dir, digest)
+}
+
+// doPush pushes the image or index with the given digest (or the last one, if empty) from the layout at dir to opts.imageRepo, and returns its reference.
+func doPush(ctx context.Context, dir, digest string, opts buildOptions) (string, error) {
+	root, err := layout.ImageIndexFromPath(dir)
+	if err != nil {
+		return "", fmt.Errorf("reading OCI layout %s: %w", dir, err)
+	}
+	desc, err := layoutDescriptor(dir, root, digest)
+	if err != nil {
+		return "", err
+	}
+	r, err := name.NewRepository(opts.imageRepo, opts.nameOptions()...)
+	if err != nil {
+		return "", fmt.Errorf("parsing repo %q: %w", opts.imageRepo, err)
+	}
+	ref := r.Digest(desc.Digest.String())
+
+	ropts := opts.remoteOptions(ctx)
+	switch {
+	case desc.MediaType.IsIndex():
+		idx, err := root.ImageIndex(desc.Digest)
+		if err != nil {
+			return "", fmt.Errorf("reading index %s: %w", desc.Digest, err)
+		}
+		if err := remote.WriteIndex(ref, idx, ropts...); err != nil {
+			return "", fmt.Errorf("pushing %s: %w", ref, err)
+		}
+	case desc.MediaType.IsImage():
+		img, err := root.Image(desc.Digest)
+		if err != nil {
+			return "", fmt.Errorf("reading image %s: %w", desc.Digest, err)
+		}
+		if err := remote.Write(ref, img, ropts...); err != nil {
+			return "", fmt.Errorf("pushing %s: %w", ref, err)
+		}
+	default:
+		return "", fmt.Errorf("unexpected media type %s for %s", desc.MediaType, desc.Digest)
+	}
+	return ref.String(), nil
+}
+
+func resourceKoPushCreate(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	po, err := NewProviderOpts(meta)
+	if err != nil {
+		return diag.Errorf("configuring provider: %v", err)
+	}
+
+	opts := pushOptions(d, po)
+	ref, err := doPush(ctx, d.Get("oci_layout_dir").(string), d.Get("digest").(string), opts)
+	if err != nil {
+		return diag.Errorf("[id=%s] create doPush: %v", d.Id(), err)
+	}
+	dig, err := name.NewDigest(ref)
+	if err != nil {
+		return diag.Errorf("[id=%s] create parsing %q: %v", d.Id(), ref, err)
+	}
+
+	_ = d.Set("digest", dig.DigestStr())
+	_ = d.Set("image_ref", ref)
+	d.SetId(ref)
+	return nil
+}
+
+// pushOptions returns the options to push to and read from the registry with, from the resource's repo and the provider's settings.
+func pushOptions(d *schema.ResourceData, po *Opts) buildOptions {
+	return po.registryOptions(buildOptions{imageRepo: d.Get("repo").(string)})
+}
+
+func resourceKoPushRead(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	po, err := NewProviderOpts(meta)
+	if err != nil {
+		return diag.Errorf("configuring provider: %v", err)
+	}
+
+	opts := pushOptions(d, po)
+	ref, err := name.NewDigest(d.Id(), opts.nameOptions()...)
+	if err != nil {
+		return diag.Errorf("[id=%s] read parsing ID: %v", d.Id(), err)
+	}
+	if _, err := remote.Head(ref, opts.remoteOptions(ctx)...); err != nil {
+		var terr *transport.Error
+		if errors.As(err, &terr) && terr.StatusCode == http.StatusNotFound {
+			d.SetId("") // The image is gone from the registry; push it again on next apply.
+			return nil
+		}
+		return diag.Diagnostics{{
+			Severity: diag.Warning,
+			Summary:  "Failed to check pushed image -- it may need to be pushed again.",
+			Detail:   fmt.Sprintf("failed to read image: %v", err),
+		}}
+	}
+	return nil
+}
+
+func resourceKoPushDelete(_ context.Context, _ *schema.ResourceData, _ interface{}) diag.Diagnostics {
+	// Like ko_build, pushed images are left in the registry.
+	return nil
+}
@@ -0,0 +1,140 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/crane"
+	"github.com/google/go-containerregistry/pkg/registry"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/layout"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/resource"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/terraform"
+)
+
+func TestDoPush(t *testing.T) {
+	// Setup a local registry and have tests push to that.
+	srv := httptest.NewServer(registry.New())
+	defer srv.Close()
+	parts := strings.Split(srv.URL, ":")
+	repo := fmt.Sprintf("localhost:%s/test", parts[len(parts)-1])
+
+	dir := t.TempDir()
+	p, err := layout.Write(dir, empty.Index)
+	if err != nil {
+		t.Fatalf("layout.Write: %v", err)
+	}
+	img, err := random.Image(1024, 1)
+	if err != nil {
+		t.Fatalf("random.Image: %v", err)
+	}
+	idx, err := random.Index(1024, 1, 2)
+	if err != nil {
+		t.Fatalf("random.Index: %v", err)
+	}
+	if err := p.AppendImage(img); err != nil {
+		t.Fatalf("AppendImage: %v", err)
+	}
+	if err := p.AppendIndex(idx); err != nil {
+		t.Fatalf("AppendIndex: %v", err)
+	}
+	imgDig, err := img.Digest()
+	if err != nil {
+		t.Fatalf("Digest: %v", err)
+	}
+	idxDig, err := idx.Digest()
+	if err != nil {
+		t.Fatalf("Digest: %v", err)
+	}
+
+	for _, tc := range []struct {
+		desc, digest, want string
+	}{
+		{"latest saved", "", idxDig.String()},
+		{"by digest", imgDig.String(), imgDig.String()},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			ref, err := doPush(context.Background(), dir, tc.digest, buildOptions{imageRepo: repo})
+			if err != nil {
+				t.Fatalf("doPush: %v", err)
+			}
+			if want := repo + "@" + tc.want; ref != want {
+				t.Errorf("expected ref %q, got %q", want, ref)
+			}
+			if _, err := crane.Head(ref); err != nil {
+				t.Errorf("expected %s to be pushed: %v", ref, err)
+			}
+		})
+	}
+
+	if _, err := doPush(context.Background(), dir, "sha256:0000000000000000000000000000000000000000000000000000000000000000", buildOptions{imageRepo: repo}); err == nil {
+		t.Error("expected error pushing digest not in layout")
+	}
+}
+
+func TestAccResourceKoPush(t *testing.T) {
+	// Setup a local registry and have tests push to that.
+	srv := httptest.NewServer(registry.New())
+	defer srv.Close()
+	parts := strings.Split(srv.URL, ":")
+	url := fmt.Sprintf("localhost:%s/test", parts[len(parts)-1])
+	t.Setenv("KO_DOCKER_REPO", url)
+	dir := t.TempDir()
+
+	resource.Test(t, resource.TestCase{
+		ProviderFactories: providerFactories,
+		Steps: []resource.TestStep{{
+			Config: fmt.Sprintf(`
+			resource "ko_build" "foo" {
+			  importpath     = "github.com/ko-build/terraform-provider-ko/cmd/test"
+			  oci_layout_dir = %q
+			}
+
+			resource "ko_push" "foo" {
+			  oci_layout_dir = %q
+			  repo           = "%s/pushed"
+			  digest         = split("@", ko_build.foo.image_ref)[1]
+			}
+			`, dir, dir, url),
+			Check: resource.ComposeTestCheckFunc(
+				resource.TestMatchResourceAttr("ko_push.foo", "image_ref",
+					regexp.MustCompile("^"+url+"/pushed@sha256:")),
+				func(s *terraform.State) error {
+					// The build was only saved to the layout, and only the push was published.
+					buildRef := s.RootModule().Resources["ko_build.foo"].Primary.Attributes["image_ref"]
+					if _, err := crane.Head(buildRef); err == nil {
+						return fmt.Errorf("expected %s not to be published", buildRef)
+					}
+					if got, want := s.RootModule().Resources["ko_push.foo"].Primary.Attributes["digest"], buildRef[strings.Index(buildRef, "@")+1:]; got != want {
+						return fmt.Errorf("expected pushed digest %s, got %s", want, got)
+					}
+					return nil
+				},
+			),
+		}},
+	})
+}
+
+func TestPushOptions(t *testing.T) {
+	// ko_push uses the provider's registry settings, like ko_build.
+	po := &Opts{retryBackoff: retryBackoff(3, time.Second), insecure: true}
+	d := schema.TestResourceDataRaw(t, resourcePush().Schema, map[string]interface{}{
+		"oci_layout_dir": t.TempDir(),
+		"digest":         "sha256:" + strings.Repeat("0", 64),
+		"repo":           "example.com/repo",
+	})
+	opts := pushOptions(d, po)
+	if opts.imageRepo != "example.com/repo" || !opts.insecure {
+		t.Errorf("expected repo example.com/repo and insecure, got %q and %t", opts.imageRepo, opts.insecure)
+	}
+	if opts.retryBackoff != po.retryBackoff {
+		t.Errorf("expected retry backoff %+v, got %+v", po.retryBackoff, opts.retryBackoff)
+	}
+}
@@ -0,0 +1,115 @@
+package provider
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"encoding/base64"
+	"errors"
+	"fmt"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/sigstore/cosign/v2/pkg/oci"
+	ocimutate "github.com/sigstore/cosign/v2/pkg/oci/mutate"
+	ociremote "github.com/sigstore/cosign/v2/pkg/oci/remote"
+	"github.com/sigstore/cosign/v2/pkg/oci/static"
+	"github.com/sigstore/sigstore/pkg/cryptoutils"
+	"github.com/sigstore/sigstore/pkg/signature"
+	"github.com/sigstore/sigstore/pkg/signature/payload"
+)
+
+// loadSigner returns a signer for key, a PEM private key or the path to one, which may be encrypted with password
+// like the keys `cosign generate-key-pair` writes.
+func loadSigner(key, password string) (signature.SignerVerifier, error) {
+	b, err := readPEM(key)
+	if err != nil {
+		return nil, err
+	}
+	pk, err := cryptoutils.UnmarshalPEMToPrivateKey(b, func(bool) ([]byte, error) { return []byte(password), nil })
+	if err != nil {
+		return nil, fmt.Errorf("reading private key: %w", err)
+	}
+	return signature.LoadSignerVerifier(pk, crypto.SHA256)
+}
+
+// signImage signs ref, the published image, with o.signKey, and pushes the signature to the cosign signature tag
+// that signature_ref names, along with any signatures already there, so `cosign verify` finds it.
+func signImage(ctx context.Context, ref string, o buildOptions) error {
+	sv, err := loadSigner(o.signKey, o.signPassword)
+	if err != nil {
+		return err
+	}
+	dig, err := name.NewDigest(ref, o.nameOptions()...)
+	if err != nil {
+		return err
+	}
+	p, err := payload.Cosign{Image: dig}.MarshalJSON()
+	if err != nil {
+		return err
+	}
+	sig, err := sv.SignMessage(bytes.NewReader(p))
+	if err != nil {
+		return fmt.Errorf("signing: %w", err)
+	}
+	s, err := static.NewSignature(p, base64.StdEncoding.EncodeToString(sig))
+	if err != nil {
+		return err
+	}
+
+	artifactRef, err := o.artifactRef(ref)
+	if err != nil {
+		return err
+	}
+	sigRef, _, err := cosignRefs(artifactRef)
+	if err != nil {
+		return err
+	}
+	return appendToTag(ctx, sigRef, s, o)
+}
+
+// appendToTag pushes s to the cosign signature or attestation tag tagRef, along with any signatures or attestations
+// already there, using the artifact repo's credentials if it's set.
+func appendToTag(ctx context.Context, tagRef string, s oci.Signature, o buildOptions) error {
+	ao := o
+	if o.artifactRepo != "" {
+		ao = o.artifactOptions()
+	}
+	tag, err := name.NewTag(tagRef, o.nameOptions()...)
+	if err != nil {
+		return err
+	}
+	ropts := ao.remoteOptions(ctx)
+	sigs, err := ociremote.Signatures(tag, ociremote.WithRemoteOptions(ropts...))
+	if err != nil {
+		return fmt.Errorf("reading %s: %w", tag, err)
+	}
+	if sigs, err = ocimutate.AppendSignatures(sigs, false, s); err != nil {
+		return err
+	}
+	if err := remote.Write(tag, sigs, ropts...); err != nil {
+		return fmt.Errorf("writing %s: %w", tag, err)
+	}
+	return nil
+}
+
+// validateSign is a CustomizeDiffFunc that rejects `sign` unless the image is published to the registry,
+// since that's where the signature is pushed, and `attest` without `sign`, whose key signs the attestation.
+func validateSign(_ context.Context, d *schema.ResourceDiff, _ interface{}) error {
+	if len(d.Get("sign").([]interface{})) == 0 {
+		if d.Get("attest").(bool) {
+			return errors.New("attest requires sign, since the attestation is signed with its key")
+		}
+		return nil
+	}
+	switch {
+	case d.NewValueKnown("push") && !d.Get("push").(bool):
+		return errors.New("sign can't be set when push = false, since the image isn't pushed to the registry")
+	case d.Get("publish_mode").(string) != "registry":
+		return errors.New(`sign requires publish_mode = "registry", since the signature is pushed to the registry`)
+	case d.Get("oci_layout_dir").(string) != "":
+		return errors.New("sign can't be set with oci_layout_dir, since the image isn't pushed to the registry")
+	}
+	return nil
+}
@@ -0,0 +1,170 @@
+package provider
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/elliptic"
+	"encoding/base64"
+	"fmt"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/resource"
+	ociremote "github.com/sigstore/cosign/v2/pkg/oci/remote"
+	"github.com/sigstore/sigstore/pkg/cryptoutils"
+	"github.com/sigstore/sigstore/pkg/signature"
+	"github.com/sigstore/sigstore/pkg/signature/payload"
+)
+
+func TestSignImage(t *testing.T) {
+	srv := httptest.NewServer(registry.New())
+	defer srv.Close()
+	parts := strings.Split(srv.URL, ":")
+	url := fmt.Sprintf("localhost:%s/test", parts[len(parts)-1])
+	base := pushBaseIndex(t, url+"/base", v1.Platform{OS: "linux", Architecture: "amd64"})
+
+	// An encrypted key, like cosign generate-key-pair writes, and an unencrypted one in a file.
+	encKey, encPub, err := cryptoutils.GeneratePEMEncodedECDSAKeyPair(elliptic.P256(), cryptoutils.StaticPasswordFunc([]byte("hunter2")))
+	if err != nil {
+		t.Fatalf("GeneratePEMEncodedECDSAKeyPair: %v", err)
+	}
+	plainKey, plainPub, err := cryptoutils.GeneratePEMEncodedECDSAKeyPair(elliptic.P256(), cryptoutils.SkipPassword)
+	if err != nil {
+		t.Fatalf("GeneratePEMEncodedECDSAKeyPair: %v", err)
+	}
+	keyFile := filepath.Join(t.TempDir(), "cosign.key")
+	if err := os.WriteFile(keyFile, plainKey, 0o600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	opts := buildOptions{
+		ip:           "github.com/ko-build/terraform-provider-ko/cmd/test",
+		workingDir:   ".",
+		imageRepo:    url + "/images",
+		platforms:    []string{"linux/amd64"},
+		baseImage:    base,
+		sbom:         "none",
+		artifactRepo: url + "/artifacts",
+	}
+	res, _, err := doBuild(context.Background(), opts)
+	if err != nil {
+		t.Fatalf("doBuild: %v", err)
+	}
+	ref, _, err := doPublish(context.Background(), res, opts)
+	if err != nil {
+		t.Fatalf("doPublish: %v", err)
+	}
+
+	opts.signKey, opts.signPassword = string(encKey), "hunter2"
+	if err := signImage(context.Background(), ref, opts); err != nil {
+		t.Fatalf("signImage: %v", err)
+	}
+	// Signing again with another key keeps the first signature.
+	opts.signKey, opts.signPassword = keyFile, ""
+	if err := signImage(context.Background(), ref, opts); err != nil {
+		t.Fatalf("signImage: %v", err)
+	}
+
+	// Read the signatures back from the signature tag in the artifact repo, and verify them with the public keys.
+	dig, err := name.NewDigest(ref)
+	if err != nil {
+		t.Fatalf("NewDigest: %v", err)
+	}
+	artifactRef, err := opts.artifactRef(ref)
+	if err != nil {
+		t.Fatalf("artifactRef: %v", err)
+	}
+	if !strings.Contains(artifactRef, "/artifacts@") {
+		t.Fatalf("expected the artifact repo in %q", artifactRef)
+	}
+	sigRef, _, err := cosignRefs(artifactRef)
+	if err != nil {
+		t.Fatalf("cosignRefs: %v", err)
+	}
+	tag, err := name.NewTag(sigRef)
+	if err != nil {
+		t.Fatalf("NewTag: %v", err)
+	}
+	sigs, err := ociremote.Signatures(tag)
+	if err != nil {
+		t.Fatalf("Signatures: %v", err)
+	}
+	got, err := sigs.Get()
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if len(got) != 2 {
+		t.Fatalf("expected 2 signatures, got %d", len(got))
+	}
+	for i, pub := range [][]byte{encPub, plainPub} {
+		pk, err := cryptoutils.UnmarshalPEMToPublicKey(pub)
+		if err != nil {
+			t.Fatalf("UnmarshalPEMToPublicKey: %v", err)
+		}
+		v, err := signature.LoadVerifier(pk, crypto.SHA256)
+		if err != nil {
+			t.Fatalf("LoadVerifier: %v", err)
+		}
+		p, err := got[i].Payload()
+		if err != nil {
+			t.Fatalf("Payload: %v", err)
+		}
+		b64, err := got[i].Base64Signature()
+		if err != nil {
+			t.Fatalf("Base64Signature: %v", err)
+		}
+		sig, err := base64.StdEncoding.DecodeString(b64)
+		if err != nil {
+			t.Fatalf("DecodeString: %v", err)
+		}
+		if err := v.VerifySignature(bytes.NewReader(sig), bytes.NewReader(p)); err != nil {
+			t.Errorf("signature %d doesn't verify: %v", i, err)
+		}
+		var cp payload.Cosign
+		if err := cp.UnmarshalJSON(p); err != nil {
+			t.Fatalf("UnmarshalJSON: %v", err)
+		}
+		if cp.Image.DigestStr() != dig.DigestStr() {
+			t.Errorf("expected signature %d to be for %s, got %s", i, dig.DigestStr(), cp.Image.DigestStr())
+		}
+	}
+}
+
+func TestLoadSigner_WrongPassword(t *testing.T) {
+	key, _, err := cryptoutils.GeneratePEMEncodedECDSAKeyPair(elliptic.P256(), cryptoutils.StaticPasswordFunc([]byte("hunter2")))
+	if err != nil {
+		t.Fatalf("GeneratePEMEncodedECDSAKeyPair: %v", err)
+	}
+	if _, err := loadSigner(string(key), "wrong"); err == nil {
+		t.Error("expected an error with the wrong password")
+	}
+}
+
+func TestAccResourceKoBuild_SignRequiresPush(t *testing.T) {
+	t.Setenv("KO_DOCKER_REPO", "example.com/repo")
+
+	resource.Test(t, resource.TestCase{
+		ProviderFactories: providerFactories,
+		Steps: []resource.TestStep{{
+			Config: `
+			resource "ko_build" "foo" {
+			  importpath = "github.com/ko-build/terraform-provider-ko/cmd/test"
+			  push       = false
+			  sign {
+			    key = "cosign.key"
+			  }
+			}
+			`,
+			PlanOnly:    true,
+			ExpectError: regexp.MustCompile(`sign can't be set when push = false`),
+		}},
+	})
+}
@@ -0,0 +1,253 @@
+package provider
+
+import (
+	"cmp"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+)
+
+// listedPackage is the subset of `go list -json` output that the source hash depends on.
+type listedPackage struct {
+	ImportPath string
+	Dir        string
+	Standard   bool
+	DepOnly    bool // False for opts.ip itself, however it's written.
+	Module     *listedModule
+
+	GoFiles, CgoFiles, IgnoredGoFiles, IgnoredOtherFiles, CFiles, CXXFiles, HFiles, SFiles, SysoFiles, EmbedFiles []string
+}
+
+// files returns the package's lists of files that the source hash depends on.
+func (p *listedPackage) files() []*[]string {
+	return []*[]string{&p.GoFiles, &p.CgoFiles, &p.IgnoredGoFiles, &p.IgnoredOtherFiles, &p.CFiles, &p.CXXFiles, &p.HFiles, &p.SFiles, &p.SysoFiles, &p.EmbedFiles}
+}
+
+// merge adds the files of o, the same package listed for another platform, to p's.
+func (p *listedPackage) merge(o listedPackage) {
+	for i, files := range o.files() {
+		mine := p.files()[i]
+		for _, f := range *files {
+			if !slices.Contains(*mine, f) {
+				*mine = append(*mine, f)
+			}
+		}
+		slices.Sort(*mine)
+	}
+}
+
+type listedModule struct {
+	Path    string
+	Version string
+	Main    bool
+	GoMod   string
+	Replace *listedModule
+}
+
+// sourceHash returns a hash of everything the image built from opts depends on: the build inputs, the base image's digest,
+// the Go toolchain version, the versions of module dependencies, and the contents of the source, embedded and kodata files
+// of packages in the main module or in locally replaced modules. If the hash is unchanged, rebuilding would produce the same image.
+func sourceHash(ctx context.Context, opts buildOptions) (string, error) {
+	h := sha256.New()
+	if err := json.NewEncoder(h).Encode(map[string]interface{}{
+		"importpath":        opts.ip,
+		"repo":              opts.imageRepo,
+		"bare":              opts.bare,
+		"platforms":         opts.platforms,
+		"base_image":        opts.baseImage,
+		"sbom":              opts.sbom,
+		"ldflags":           opts.ldflags,
+		"platform_ldflags":  opts.platformLdflags,
+		"env":               opts.env,
+		"build_tags":        opts.buildTags,
+		"gcflags":           opts.gcflags,
+		"asmflags":          opts.asmflags,
+		"no_trimpath":       opts.noTrimpath,
+		"ko_build":          opts.koBuild,
+		"annotations":       opts.annotations,
+		"labels":            opts.labels,
+		"race":              opts.race,
+		"cgo":               opts.cgo,
+		"stop_signal":       opts.stopSignal,
+		"user":              opts.user,
+		"ports":             opts.ports,
+		"image_env":         opts.imageEnv,
+		"entrypoint_prefix": opts.entrypointPrefix,
+		"entrypoint":        opts.entrypoint,
+		"args":              opts.args,
+		"force_index":       opts.forceIndex,
+		"arch_override":     opts.archOverride,
+		"docker_types":      opts.dockerMediaTypes,
+		"source_date":       cmp.Or(opts.sourceDateEpoch, os.Getenv("SOURCE_DATE_EPOCH")),
+	}); err != nil {
+		return "", err
+	}
+
+	base, err := name.ParseReference(opts.baseImage, opts.nameOptions()...)
+	if err != nil {
+		return "", fmt.Errorf("parsing base image %q: %w", opts.baseImage, err)
+	}
+	desc, err := remote.Head(base, opts.remoteOptions(ctx)...)
+	if err != nil {
+		return "", fmt.Errorf("reading base image %s: %w", base, err)
+	}
+	fmt.Fprintf(h, "base %s\n", desc.Digest)
+
+	goVersion, err := goToolchainVersion(ctx)
+	if err != nil {
+		return "", err
+	}
+	fmt.Fprintf(h, "go %s\n", goVersion)
+
+	pkgs, err := listDeps(ctx, opts)
+	if err != nil {
+		return "", err
+	}
+	gomods := map[string]bool{}
+	for _, p := range pkgs {
+		if p.Standard {
+			continue
+		}
+		if m := p.Module; m != nil && !m.Main && (m.Replace == nil || m.Replace.Version != "") {
+			// Module dependencies are identified by their version; only local source is hashed.
+			if m.Replace != nil {
+				m = m.Replace
+			}
+			fmt.Fprintf(h, "module %s %s\n", m.Path, m.Version)
+			continue
+		}
+		if p.Module != nil && p.Module.GoMod != "" && !gomods[p.Module.GoMod] {
+			gomods[p.Module.GoMod] = true
+			if err := hashFile(h, p.Module.GoMod); err != nil {
+				return "", err
+			}
+		}
+		for _, files := range p.files() {
+			for _, f := range *files {
+				if err := hashFile(h, filepath.Join(p.Dir, f)); err != nil {
+					return "", err
+				}
+			}
+		}
+		if !p.DepOnly {
+			if err := hashTree(h, filepath.Join(p.Dir, "kodata")); err != nil {
+				return "", err
+			}
+		}
+	}
+	return "sha256:" + hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// listDeps returns the packages opts.ip depends on, including itself, for each platform it's built for, sorted by import path.
+// Like ko's build, it lists with the build tags and the cgo setting of opts; a package's files for each platform are merged.
+func listDeps(ctx context.Context, opts buildOptions) ([]listedPackage, error) {
+	gobin := os.Getenv("KO_GO_PATH")
+	if gobin == "" {
+		gobin = "go"
+	}
+	envs := [][]string{nil} // With platforms "all", list for the host platform.
+	if len(opts.platforms) > 0 && opts.platforms[0] != "all" {
+		envs = envs[:0]
+		for _, platform := range opts.platforms {
+			p, err := v1.ParsePlatform(platform)
+			if err != nil {
+				return nil, fmt.Errorf("parsing platform %q: %w", platform, err)
+			}
+			envs = append(envs, []string{"GOOS=" + p.OS, "GOARCH=" + p.Architecture})
+		}
+	}
+
+	args := []string{"list", "-deps", "-json"}
+	if len(opts.buildTags) > 0 {
+		args = append(args, "-tags="+strings.Join(opts.buildTags, ","))
+	}
+	args = append(args, strings.TrimPrefix(opts.ip, "ko://"))
+	// ko disables cgo unless the build enables it.
+	cgo := "CGO_ENABLED=0"
+	if opts.cgoEnabled() {
+		cgo = "CGO_ENABLED=1"
+	}
+
+	seen := map[string]listedPackage{}
+	for _, env := range envs {
+		var stdout, stderr strings.Builder
+		cmd := exec.CommandContext(ctx, gobin, args...) //nolint: gosec // Same go invocation ko makes.
+		cmd.Dir = opts.workingDir
+		cmd.Env = append(append(append(os.Environ(), opts.env...), cgo), env...)
+		cmd.Stdout = &stdout
+		cmd.Stderr = &stderr
+		if err := cmd.Run(); err != nil {
+			return nil, fmt.Errorf("go list %s: %w: %s", opts.ip, err, stderr.String())
+		}
+		dec := json.NewDecoder(strings.NewReader(stdout.String()))
+		for {
+			var p listedPackage
+			if err := dec.Decode(&p); errors.Is(err, io.EOF) {
+				break
+			} else if err != nil {
+				return nil, fmt.Errorf("decoding go list output: %w", err)
+			}
+			if prev, ok := seen[p.ImportPath]; ok {
+				prev.merge(p)
+				p = prev
+			}
+			seen[p.ImportPath] = p
+		}
+	}
+
+	out := make([]listedPackage, 0, len(seen))
+	for _, p := range seen {
+		out = append(out, p)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].ImportPath < out[j].ImportPath })
+	return out, nil
+}
+
+// hashFile writes the path and contents of the file at path to h.
+func hashFile(h io.Writer, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	fmt.Fprintf(h, "file %s\n", path)
+	_, err = io.Copy(h, f)
+	return err
+}
+
+// hashTree writes the paths, modes and contents of the files under dir to h, following symlinks like ko does for kodata.
+// A missing dir is hashed as empty.
+func hashTree(h io.Writer, dir string) error {
+	if _, err := os.Stat(dir); errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	return filepath.WalkDir(dir, func(path string, _ fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		fi, err := os.Stat(path)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(h, "mode %s %s\n", path, fi.Mode())
+		if fi.IsDir() {
+			return nil
+		}
+		return hashFile(h, path)
+	})
+}
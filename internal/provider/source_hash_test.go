@@ -0,0 +1,174 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/crane"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+)
+
+func TestSourceHash(t *testing.T) {
+	// Setup a local registry and have tests push to that.
+	srv := httptest.NewServer(registry.New())
+	defer srv.Close()
+	parts := strings.Split(srv.URL, ":")
+	repo := fmt.Sprintf("localhost:%s/test", parts[len(parts)-1])
+	base := repo + "/base"
+	pushBase := func() {
+		t.Helper()
+		img, err := random.Image(1024, 1)
+		if err != nil {
+			t.Fatalf("random.Image: %v", err)
+		}
+		ref, err := name.ParseReference(base)
+		if err != nil {
+			t.Fatalf("ParseReference: %v", err)
+		}
+		if err := remote.Write(ref, img); err != nil {
+			t.Fatalf("remote.Write: %v", err)
+		}
+	}
+	pushBase()
+
+	dir := t.TempDir()
+	write := func(path, content string) {
+		t.Helper()
+		path = filepath.Join(dir, path)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatalf("MkdirAll: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatalf("WriteFile: %v", err)
+		}
+	}
+	write("go.mod", "module example.com/app\n\ngo 1.21\n")
+	write("main.go", "package main\n\nimport _ \"example.com/app/lib\"\n\nfunc main() {}\n")
+	write("lib/lib.go", "package lib\n")
+	write("lib/lib_windows.go", "package lib\n")
+	write("kodata/index.html", "hello")
+	t.Setenv("GOWORK", "off")
+
+	opts := buildOptions{
+		ip:         "example.com/app",
+		workingDir: dir,
+		imageRepo:  repo,
+		platforms:  []string{"linux/amd64"},
+		baseImage:  base,
+	}
+	hash := func(opts buildOptions) string {
+		t.Helper()
+		h, err := sourceHash(context.Background(), opts)
+		if err != nil {
+			t.Fatalf("sourceHash: %v", err)
+		}
+		return h
+	}
+	want := hash(opts)
+	if got := hash(opts); got != want {
+		t.Fatalf("expected the same hash for unchanged source, got %s and %s", want, got)
+	}
+
+	// Tags don't change the image, so they don't change the hash.
+	withTags := opts
+	withTags.tags = []string{"v1"}
+	if got := hash(withTags); got != want {
+		t.Errorf("expected tags not to change the hash, got %s and %s", want, got)
+	}
+
+	for _, tc := range []struct {
+		desc   string
+		change func() buildOptions
+	}{{
+		desc:   "build inputs",
+		change: func() buildOptions { o := opts; o.ldflags = []string{"-s"}; return o },
+	}, {
+		desc:   "source in a dependency",
+		change: func() buildOptions { write("lib/lib.go", "package lib\n\nvar X = 1\n"); return opts },
+	}, {
+		desc:   "source for another platform",
+		change: func() buildOptions { write("lib/lib_windows.go", "package lib\n\nvar Y = 1\n"); return opts },
+	}, {
+		desc:   "kodata",
+		change: func() buildOptions { write("kodata/index.html", "goodbye"); return opts },
+	}, {
+		desc:   "base image",
+		change: func() buildOptions { pushBase(); return opts },
+	}} {
+		got := hash(tc.change())
+		if got == want {
+			t.Errorf("expected changing the %s to change the hash", tc.desc)
+		}
+		want = got
+	}
+
+	// So are the files that only some builds see.
+	write("lib/lib_amd64.s", "")
+	write("lib/lib_loud.go", "//go:build loud\n\npackage lib\n\nimport _ \"example.com/app/loud\"\n")
+	write("loud/loud.go", "package loud\n")
+	for _, tc := range []struct {
+		desc   string
+		opts   func() buildOptions
+		change func()
+	}{{
+		desc:   "kodata of a relative importpath",
+		opts:   func() buildOptions { o := opts; o.ip = "."; return o },
+		change: func() { write("kodata/index.html", "hello again") },
+	}, {
+		desc:   "assembly for the first of several platforms",
+		opts:   func() buildOptions { o := opts; o.platforms = []string{"linux/amd64", "linux/arm64"}; return o },
+		change: func() { write("lib/lib_amd64.s", "// changed\n") },
+	}, {
+		desc:   "dependency imported with build tags",
+		opts:   func() buildOptions { o := opts; o.buildTags = []string{"loud"}; return o },
+		change: func() { write("loud/loud.go", "package loud\n\nvar Z = 1\n") },
+	}} {
+		o := tc.opts()
+		before := hash(o)
+		tc.change()
+		if hash(o) == before {
+			t.Errorf("expected changing the %s to change the hash", tc.desc)
+		}
+	}
+}
+
+func TestImageExists(t *testing.T) {
+	// Setup a local registry and have tests push to that.
+	srv := httptest.NewServer(registry.New())
+	defer srv.Close()
+	parts := strings.Split(srv.URL, ":")
+	repo := fmt.Sprintf("localhost:%s/test/exists", parts[len(parts)-1])
+
+	img, err := random.Image(1024, 1)
+	if err != nil {
+		t.Fatalf("random.Image: %v", err)
+	}
+	if err := crane.Push(img, repo); err != nil {
+		t.Fatalf("crane.Push: %v", err)
+	}
+	dig, err := img.Digest()
+	if err != nil {
+		t.Fatalf("Digest: %v", err)
+	}
+
+	for ref, want := range map[string]bool{
+		repo + "@" + dig.String(): true,
+		repo + "@sha256:0000000000000000000000000000000000000000000000000000000000000000": false,
+	} {
+		got, err := imageExists(context.Background(), ref, buildOptions{})
+		if err != nil {
+			t.Fatalf("imageExists(%s): %v", ref, err)
+		}
+		if got != want {
+			t.Errorf("imageExists(%s): expected %t, got %t", ref, want, got)
+		}
+	}
+}
@@ -0,0 +1,22 @@
+package provider
+
+import (
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/ko/pkg/build"
+)
+
+// validStopSignals are the signal names accepted for an image's StopSignal.
+var validStopSignals = map[string]struct{}{
+	"SIGABRT": {}, "SIGALRM": {}, "SIGBUS": {}, "SIGCHLD": {}, "SIGCONT": {}, "SIGFPE": {},
+	"SIGHUP": {}, "SIGILL": {}, "SIGINT": {}, "SIGIO": {}, "SIGKILL": {}, "SIGPIPE": {},
+	"SIGPROF": {}, "SIGPWR": {}, "SIGQUIT": {}, "SIGSEGV": {}, "SIGSTOP": {}, "SIGSYS": {},
+	"SIGTERM": {}, "SIGTRAP": {}, "SIGTSTP": {}, "SIGTTIN": {}, "SIGTTOU": {}, "SIGURG": {},
+	"SIGUSR1": {}, "SIGUSR2": {}, "SIGVTALRM": {}, "SIGWINCH": {}, "SIGXCPU": {}, "SIGXFSZ": {},
+}
+
+// withStopSignal returns the built image or index with StopSignal set in the config of each of its images.
+func withStopSignal(res build.Result, sig string) (build.Result, error) {
+	return mapImages(res, func(img v1.Image) (v1.Image, error) {
+		return mutateConfig(img, func(c *v1.Config) { c.StopSignal = sig })
+	})
+}
@@ -0,0 +1,150 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/crane"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+)
+
+func TestDoBuild_StopSignal(t *testing.T) {
+	// Setup a local registry and have tests push to that.
+	srv := httptest.NewServer(registry.New())
+	defer srv.Close()
+	parts := strings.Split(srv.URL, ":")
+	url := fmt.Sprintf("localhost:%s/test", parts[len(parts)-1])
+
+	base := pushBaseIndex(t, url+"/base",
+		v1.Platform{OS: "linux", Architecture: "amd64"},
+		v1.Platform{OS: "linux", Architecture: "arm64"},
+	)
+
+	for _, platforms := range [][]string{{"linux/amd64"}, {"linux/amd64", "linux/arm64"}} {
+		t.Run(strings.Join(platforms, ","), func(t *testing.T) {
+			opts := buildOptions{
+				ip:         "github.com/ko-build/terraform-provider-ko/cmd/test",
+				workingDir: ".",
+				imageRepo:  url,
+				platforms:  platforms,
+				baseImage:  base,
+				sbom:       "none",
+				stopSignal: "SIGINT",
+			}
+			res, _, err := doBuild(context.Background(), opts)
+			if err != nil {
+				t.Fatalf("doBuild: %v", err)
+			}
+			ref, _, err := doPublish(context.Background(), res, opts)
+			if err != nil {
+				t.Fatalf("doPublish: %v", err)
+			}
+
+			// Read the configs back from the registry.
+			r, err := name.ParseReference(ref)
+			if err != nil {
+				t.Fatalf("ParseReference: %v", err)
+			}
+			desc, err := remote.Get(r)
+			if err != nil {
+				t.Fatalf("remote.Get: %v", err)
+			}
+			var imgs []v1.Image
+			if desc.MediaType.IsIndex() {
+				idx, err := desc.ImageIndex()
+				if err != nil {
+					t.Fatalf("ImageIndex: %v", err)
+				}
+				im, err := idx.IndexManifest()
+				if err != nil {
+					t.Fatalf("IndexManifest: %v", err)
+				}
+				for _, m := range im.Manifests {
+					img, err := idx.Image(m.Digest)
+					if err != nil {
+						t.Fatalf("Image: %v", err)
+					}
+					imgs = append(imgs, img)
+				}
+			} else {
+				img, err := desc.Image()
+				if err != nil {
+					t.Fatalf("Image: %v", err)
+				}
+				imgs = append(imgs, img)
+			}
+			if len(imgs) != len(platforms) {
+				t.Fatalf("expected %d images, got %d", len(platforms), len(imgs))
+			}
+			for _, img := range imgs {
+				cf, err := img.ConfigFile()
+				if err != nil {
+					t.Fatalf("ConfigFile: %v", err)
+				}
+				if cf.Config.StopSignal != "SIGINT" {
+					t.Errorf("expected StopSignal %q for %s/%s, got %q", "SIGINT", cf.OS, cf.Architecture, cf.Config.StopSignal)
+				}
+			}
+		})
+	}
+}
+
+func TestDoBuild_ImageConfigKeepsBaseDigest(t *testing.T) {
+	// Setup a local registry and have tests push to that.
+	srv := httptest.NewServer(registry.New())
+	defer srv.Close()
+	parts := strings.Split(srv.URL, ":")
+	url := fmt.Sprintf("localhost:%s/test", parts[len(parts)-1])
+
+	base := pushBaseIndex(t, url+"/base",
+		v1.Platform{OS: "linux", Architecture: "amd64"},
+		v1.Platform{OS: "linux", Architecture: "arm64"},
+	)
+	// ko records the digest of the base image each image was built on.
+	digests := map[string]bool{}
+	for _, p := range []*v1.Platform{{OS: "linux", Architecture: "amd64"}, {OS: "linux", Architecture: "arm64"}} {
+		d, err := crane.Digest(base, crane.WithPlatform(p))
+		if err != nil {
+			t.Fatalf("crane.Digest: %v", err)
+		}
+		digests[d] = true
+	}
+
+	for _, platforms := range [][]string{{"linux/amd64"}, {"linux/amd64", "linux/arm64"}} {
+		t.Run(strings.Join(platforms, ","), func(t *testing.T) {
+			res, _, err := doBuild(context.Background(), buildOptions{
+				ip:         "github.com/ko-build/terraform-provider-ko/cmd/test",
+				workingDir: ".",
+				imageRepo:  url,
+				platforms:  platforms,
+				baseImage:  base,
+				sbom:       "none",
+				stopSignal: "SIGINT",
+				ports:      []string{"8080"},
+				imageEnv:   map[string]string{"LOG_LEVEL": "debug"},
+			})
+			if err != nil {
+				t.Fatalf("doBuild: %v", err)
+			}
+			// The config is changed in the built image, so the base digests still refer to the base images in the registry.
+			if _, err := mapImages(res, func(img v1.Image) (v1.Image, error) {
+				_, dig, err := baseAnnotationsOf(img)
+				if err != nil {
+					return nil, err
+				}
+				if !digests[dig] {
+					t.Errorf("expected the digest of a base image from %s, got %s", base, dig)
+				}
+				return img, nil
+			}); err != nil {
+				t.Fatalf("baseAnnotationsOf: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,147 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+)
+
+// maxTagLength is the maximum length of a tag allowed by the OCI distribution spec.
+const maxTagLength = 128
+
+// tagRE is the tag grammar from the OCI distribution spec.
+var tagRE = regexp.MustCompile(`^[a-zA-Z0-9_][a-zA-Z0-9._-]{0,127}$`)
+
+// validateTag returns why tag isn't a valid OCI tag, or "" if it is valid.
+func validateTag(tag string) string {
+	switch {
+	case tagRE.MatchString(tag):
+		return ""
+	case tag == "":
+		return "must not be empty"
+	case len(tag) > maxTagLength:
+		return fmt.Sprintf("must be at most %d characters", maxTagLength)
+	case !tagRE.MatchString(tag[:1]):
+		return "must start with a letter, digit or underscore"
+	}
+	for _, r := range tag {
+		if !tagRE.MatchString("_" + string(r)) {
+			return fmt.Sprintf("must not contain %q", r)
+		}
+	}
+	return "is invalid"
+}
+
+// sanitizeTag turns tag into a valid OCI tag by lowercasing it, replacing invalid characters with "-",
+// replacing an invalid leading character with "_" and truncating it to the maximum tag length.
+func sanitizeTag(tag string) string {
+	var b strings.Builder
+	for i, r := range strings.ToLower(tag) {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9', r == '_':
+			b.WriteRune(r)
+		case i == 0:
+			b.WriteRune('_')
+		case r == '.' || r == '-':
+			b.WriteRune(r)
+		default:
+			b.WriteRune('-')
+		}
+	}
+	out := b.String()
+	if len(out) > maxTagLength {
+		out = out[:maxTagLength]
+	}
+	return out
+}
+
+func sanitizeTags(tags []string) []string {
+	out := make([]string, len(tags))
+	for i, t := range tags {
+		out[i] = sanitizeTag(t)
+	}
+	return out
+}
+
+// validateTags is a CustomizeDiffFunc that reports invalid `tags` at plan time, unless `sanitize_tags` is set.
+func validateTags(_ context.Context, d *schema.ResourceDiff, _ interface{}) error {
+	if d.Get("sanitize_tags").(bool) || !d.NewValueKnown("tags") {
+		return nil
+	}
+	var invalid []string
+	for i, v := range d.Get("tags").([]interface{}) {
+		t, ok := v.(string)
+		if !ok || !d.NewValueKnown(fmt.Sprintf("tags.%d", i)) {
+			continue
+		}
+		if reason := validateTag(t); reason != "" {
+			invalid = append(invalid, fmt.Sprintf("%q %s", t, reason))
+		}
+	}
+	if len(invalid) > 0 {
+		return fmt.Errorf("invalid tags: %s; set sanitize_tags to fix them automatically", strings.Join(invalid, ", "))
+	}
+	return nil
+}
+
+// validateTagOnly is a CustomizeDiffFunc that rejects `tag_only` unless exactly one tag other than `latest` is set,
+// since the tag is then the only way to refer to the image.
+func validateTagOnly(_ context.Context, d *schema.ResourceDiff, _ interface{}) error {
+	if !d.Get("tag_only").(bool) || !d.NewValueKnown("tags") {
+		return nil
+	}
+	tags := d.Get("tags").([]interface{})
+	if len(tags) != 1 || tags[0] == "latest" {
+		return errors.New("tag_only requires exactly one tag other than latest, since image_ref then refers to the image by that tag alone")
+	}
+	return nil
+}
+
+// tagOnlyRef returns the repo:tag form of a digest reference, for `tag_only`.
+func tagOnlyRef(ref, tag string) (string, error) {
+	dig, err := name.NewDigest(ref)
+	if err != nil {
+		return "", err
+	}
+	return dig.Context().Tag(tag).String(), nil
+}
+
+// imageRef returns the value of `image_ref` for the published digest reference ref: ref itself, or its repo:tag form with `tag_only`.
+func (o *buildOptions) imageRef(ref string) (string, error) {
+	if !o.tagOnly || len(o.tags) != 1 {
+		return ref, nil
+	}
+	return tagOnlyRef(ref, o.tags[0])
+}
+
+// publishedRef returns the digest reference of the image in the resource's state,
+// which is `image_digest_ref` with `tag_only` or when loaded into the Docker daemon, since `image_ref` then has no digest.
+func publishedRef(d *schema.ResourceData) string {
+	if d.Get("tag_only").(bool) || d.Get("publish_mode").(string) == "daemon" {
+		return d.Get("image_digest_ref").(string)
+	}
+	return d.Get("image_ref").(string)
+}
+
+// retagDiff is a CustomizeDiffFunc that marks the outputs that re-tagging changes as unknown when only `tags` change,
+// since the image is re-tagged in place rather than rebuilt. Images published to the Docker daemon or a tarball aren't
+// in the registry to re-tag, so changing their tags replaces the resource, publishing the image again with the new tags.
+func retagDiff(_ context.Context, d *schema.ResourceDiff, _ interface{}) error {
+	if d.Id() == "" || !d.HasChange("tags") {
+		return nil
+	}
+	if mode := d.Get("publish_mode").(string); mode != "" && mode != "registry" {
+		return d.ForceNew("tags")
+	}
+	for _, k := range []string{"image_ref", "tag_refs", "effective_options", "auth_source"} {
+		if err := d.SetNewComputed(k); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,166 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/registry"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/resource"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/terraform"
+)
+
+func TestValidateTag(t *testing.T) {
+	for _, tc := range []struct {
+		tag, want string
+	}{
+		{"latest", ""},
+		{"v1.2.3-rc.1_Build", ""},
+		{"_private", ""},
+		{strings.Repeat("a", 128), ""},
+		{"", "must not be empty"},
+		{strings.Repeat("a", 129), "must be at most 128 characters"},
+		{".hidden", "must start with a letter, digit or underscore"},
+		{"-dash", "must start with a letter, digit or underscore"},
+		{"My/Tag", `must not contain '/'`},
+		{"feature branch", `must not contain ' '`},
+	} {
+		if got := validateTag(tc.tag); got != tc.want {
+			t.Errorf("validateTag(%q) = %q, want %q", tc.tag, got, tc.want)
+		}
+	}
+}
+
+func TestSanitizeTag(t *testing.T) {
+	for _, tc := range []struct {
+		tag, want string
+	}{
+		{"latest", "latest"},
+		{"My/Tag", "my-tag"},
+		{"feature branch", "feature-branch"},
+		{"v1.2.3-RC.1", "v1.2.3-rc.1"},
+		{".hidden", "_hidden"},
+		{"-dash", "_dash"},
+		{strings.Repeat("a", 200), strings.Repeat("a", 128)},
+	} {
+		got := sanitizeTag(tc.tag)
+		if got != tc.want {
+			t.Errorf("sanitizeTag(%q) = %q, want %q", tc.tag, got, tc.want)
+		}
+		if reason := validateTag(got); reason != "" {
+			t.Errorf("sanitizeTag(%q) = %q, which %s", tc.tag, got, reason)
+		}
+	}
+}
+
+func TestAccResourceKoBuild_InvalidTags(t *testing.T) {
+	t.Setenv("KO_DOCKER_REPO", "example.com/repo")
+
+	resource.Test(t, resource.TestCase{
+		ProviderFactories: providerFactories,
+		Steps: []resource.TestStep{{
+			Config: `
+			resource "ko_build" "foo" {
+			  importpath = "github.com/ko-build/terraform-provider-ko/cmd/test"
+			  tags       = ["ok", "My/Tag", "feature branch"]
+			}
+			`,
+			PlanOnly:    true,
+			ExpectError: regexp.MustCompile(`invalid tags: "My/Tag" must not contain '/', "feature branch" must not contain ' '`),
+		}},
+	})
+}
+
+func TestTagOnlyRef(t *testing.T) {
+	const dig = "sha256:0000000000000000000000000000000000000000000000000000000000000000"
+	for _, ref := range []string{"example.com/app@" + dig, "example.com/app:v1@" + dig} {
+		got, err := tagOnlyRef(ref, "v1.2.3")
+		if err != nil {
+			t.Fatalf("tagOnlyRef(%q): %v", ref, err)
+		}
+		if want := "example.com/app:v1.2.3"; got != want {
+			t.Errorf("tagOnlyRef(%q) = %q, want %q", ref, got, want)
+		}
+	}
+}
+
+func TestAccResourceKoBuild_TagOnly(t *testing.T) {
+	// Setup a local registry and have tests push to that.
+	srv := httptest.NewServer(registry.New())
+	defer srv.Close()
+	parts := strings.Split(srv.URL, ":")
+	url := fmt.Sprintf("localhost:%s/test", parts[len(parts)-1])
+	t.Setenv("KO_DOCKER_REPO", url)
+
+	config := `
+		resource "ko_build" "foo" {
+			sbom       = "none"
+			importpath = "github.com/ko-build/terraform-provider-ko/cmd/test"
+			tags       = %s
+			tag_only   = true
+		}
+	`
+	repo := url + "/github.com/ko-build/terraform-provider-ko/cmd/test"
+	resource.Test(t, resource.TestCase{
+		ProviderFactories: providerFactories,
+		Steps: []resource.TestStep{{
+			Config: fmt.Sprintf(config, `["v1.2.3"]`),
+			Check: resource.ComposeTestCheckFunc(
+				resource.TestCheckResourceAttr("ko_build.foo", "image_ref", repo+":v1.2.3"),
+				resource.TestMatchResourceAttr("ko_build.foo", "image_digest_ref", regexp.MustCompile("^"+repo+"@sha256:")),
+			),
+		}, {
+			// Changes are detected by digest, so rebuilding the same image has no diff.
+			Config:   fmt.Sprintf(config, `["v1.2.3"]`),
+			PlanOnly: true,
+		}, {
+			// Re-tagging refers to the image by the new tag.
+			Config: fmt.Sprintf(config, `["v1.2.4"]`),
+			Check:  resource.TestCheckResourceAttr("ko_build.foo", "image_ref", repo+":v1.2.4"),
+		}, {
+			Config:      fmt.Sprintf(config, `["v1.2.3", "stable"]`),
+			ExpectError: regexp.MustCompile("tag_only requires exactly one tag other than latest"),
+		}, {
+			Config:      fmt.Sprintf(config, `["latest"]`),
+			ExpectError: regexp.MustCompile("tag_only requires exactly one tag other than latest"),
+		}},
+	})
+}
+
+func TestRetagDiff(t *testing.T) {
+	// Changing only the tags re-tags an image in the registry in place, but replaces one published locally.
+	for mode, wantNew := range map[string]bool{"registry": false, "daemon": true} {
+		t.Run(mode, func(t *testing.T) {
+			r := resourceBuild()
+			config := func(tag string) *terraform.ResourceConfig {
+				return terraform.NewResourceConfigRaw(map[string]interface{}{
+					"importpath":   "github.com/ko-build/terraform-provider-ko/cmd/test",
+					"publish_mode": mode,
+					"tags":         []interface{}{tag},
+				})
+			}
+			created, err := r.Diff(context.Background(), nil, config("v1"), nil)
+			if err != nil {
+				t.Fatalf("Diff: %v", err)
+			}
+			// The state after creating it, leaving out the attributes computed when it was created.
+			state := &terraform.InstanceState{ID: "id", Attributes: map[string]string{}}
+			for k, a := range created.Attributes {
+				if !a.NewComputed {
+					state.Attributes[k] = a.New
+				}
+			}
+
+			diff, err := r.Diff(context.Background(), state, config("v2"), nil)
+			if err != nil {
+				t.Fatalf("Diff: %v", err)
+			}
+			if got := diff.RequiresNew(); got != wantNew {
+				t.Errorf("expected changing the tags to require replacement %t, got %t", wantNew, got)
+			}
+		})
+	}
+}
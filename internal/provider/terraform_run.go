@@ -0,0 +1,26 @@
+package provider
+
+import "os"
+
+const (
+	annotationTerraformRunID     = "io.terraform.run-id"
+	annotationTerraformWorkspace = "io.terraform.workspace"
+)
+
+// terraformRunAnnotations returns annotations identifying the HCP Terraform or Terraform Enterprise run the provider is running in,
+// from the TFC_RUN_ID and TFC_WORKSPACE_SLUG or TFC_WORKSPACE_NAME environment variables those set.
+// Outside of such a run, it returns no annotations.
+func terraformRunAnnotations() map[string]string {
+	out := map[string]string{}
+	if id := os.Getenv("TFC_RUN_ID"); id != "" {
+		out[annotationTerraformRunID] = id
+	}
+	ws := os.Getenv("TFC_WORKSPACE_SLUG")
+	if ws == "" {
+		ws = os.Getenv("TFC_WORKSPACE_NAME")
+	}
+	if ws != "" {
+		out[annotationTerraformWorkspace] = ws
+	}
+	return out
+}
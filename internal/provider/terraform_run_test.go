@@ -0,0 +1,73 @@
+package provider
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/registry"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/resource"
+)
+
+func TestTerraformRunAnnotations(t *testing.T) {
+	for _, tc := range []struct {
+		desc string
+		env  map[string]string
+		want map[string]string
+	}{{
+		desc: "outside a run",
+		want: map[string]string{},
+	}, {
+		desc: "slug preferred",
+		env:  map[string]string{"TFC_RUN_ID": "run-abc", "TFC_WORKSPACE_SLUG": "org/ws", "TFC_WORKSPACE_NAME": "ws"},
+		want: map[string]string{annotationTerraformRunID: "run-abc", annotationTerraformWorkspace: "org/ws"},
+	}, {
+		desc: "name only",
+		env:  map[string]string{"TFC_WORKSPACE_NAME": "ws"},
+		want: map[string]string{annotationTerraformWorkspace: "ws"},
+	}} {
+		t.Run(tc.desc, func(t *testing.T) {
+			for _, k := range []string{"TFC_RUN_ID", "TFC_WORKSPACE_SLUG", "TFC_WORKSPACE_NAME"} {
+				t.Setenv(k, tc.env[k])
+			}
+			if got := terraformRunAnnotations(); fmt.Sprint(got) != fmt.Sprint(tc.want) {
+				t.Errorf("expected %v, got %v", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestAccResourceKoBuild_TerraformRunAnnotations(t *testing.T) {
+	// Setup a local registry and have tests push to that.
+	srv := httptest.NewServer(registry.New())
+	defer srv.Close()
+	parts := strings.Split(srv.URL, ":")
+	url := fmt.Sprintf("localhost:%s/test", parts[len(parts)-1])
+	t.Setenv("KO_DOCKER_REPO", url)
+	t.Setenv("TFC_RUN_ID", "run-1")
+	t.Setenv("TFC_WORKSPACE_SLUG", "org/ws")
+
+	config := `
+		resource "ko_build" "foo" {
+			sbom                      = "none"
+			importpath                = "github.com/ko-build/terraform-provider-ko/cmd/test"
+			terraform_run_annotations = true
+		}
+	`
+	resource.Test(t, resource.TestCase{
+		ProviderFactories: providerFactories,
+		Steps: []resource.TestStep{{
+			Config: config,
+			Check: resource.ComposeTestCheckFunc(
+				resource.TestCheckResourceAttr("ko_build.foo", "run_annotations.io.terraform.run-id", "run-1"),
+				resource.TestCheckResourceAttr("ko_build.foo", "run_annotations.io.terraform.workspace", "org/ws"),
+			),
+		}, {
+			// A later run keeps the image annotated with the run that created it.
+			PreConfig: func() { t.Setenv("TFC_RUN_ID", "run-2") },
+			Config:    config,
+			PlanOnly:  true,
+		}},
+	})
+}
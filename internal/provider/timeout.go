@@ -0,0 +1,24 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// withTimeout returns ctx limited to o.timeout, if it's set.
+func (o *buildOptions) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if o.timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, o.timeout)
+}
+
+// timeoutError returns err, saying that phase exceeded o.timeout if ctx's deadline passed,
+// since the errors of a killed go build or a cancelled registry request don't say why they stopped.
+func (o *buildOptions) timeoutError(ctx context.Context, phase string, err error) error {
+	if err != nil && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return fmt.Errorf("%s exceeded timeout of %s: %w", phase, o.timeout, err)
+	}
+	return err
+}
@@ -0,0 +1,102 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/registry"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+)
+
+// slowRegistry serves a local registry that holds requests matching slow until released or cancelled.
+func slowRegistry(t *testing.T, slow func(*http.Request) bool) string {
+	reg := registry.New()
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if slow(r) {
+			select {
+			case <-release:
+			case <-r.Context().Done():
+				return
+			}
+		}
+		reg.ServeHTTP(w, r)
+	}))
+	t.Cleanup(srv.Close)
+	t.Cleanup(func() { close(release) })
+	parts := strings.Split(srv.URL, ":")
+	return fmt.Sprintf("localhost:%s/test", parts[len(parts)-1])
+}
+
+func TestTimeout_Build(t *testing.T) {
+	var hold atomic.Bool
+	url := slowRegistry(t, func(r *http.Request) bool {
+		return hold.Load() && r.Method == http.MethodGet && strings.Contains(r.URL.Path, "/base/manifests/")
+	})
+	base := pushBaseIndex(t, url+"/base", v1.Platform{OS: "linux", Architecture: "amd64"})
+	hold.Store(true)
+
+	opts := buildOptions{
+		ip:         "github.com/ko-build/terraform-provider-ko/cmd/test",
+		workingDir: ".",
+		imageRepo:  url,
+		platforms:  []string{"linux/amd64"},
+		baseImage:  base,
+		sbom:       "none",
+		timeout:    time.Second,
+	}
+	ctx, cancel := opts.withTimeout(context.Background())
+	defer cancel()
+	_, _, err := doBuild(ctx, opts)
+	err = opts.timeoutError(ctx, "build", err)
+	if err == nil || !strings.Contains(err.Error(), "build exceeded timeout of 1s") {
+		t.Fatalf("expected the build to exceed its timeout, got %v", err)
+	}
+}
+
+func TestTimeout_Publish(t *testing.T) {
+	var hold atomic.Bool
+	url := slowRegistry(t, func(r *http.Request) bool {
+		return hold.Load() && r.Method == http.MethodPut && strings.Contains(r.URL.Path, "/manifests/")
+	})
+	base := pushBaseIndex(t, url+"/base", v1.Platform{OS: "linux", Architecture: "amd64"})
+	hold.Store(true)
+
+	opts := buildOptions{
+		ip:         "github.com/ko-build/terraform-provider-ko/cmd/test",
+		workingDir: ".",
+		imageRepo:  url,
+		platforms:  []string{"linux/amd64"},
+		baseImage:  base,
+		sbom:       "none",
+		timeout:    time.Minute,
+	}
+	res, _, err := doBuild(context.Background(), opts)
+	if err != nil {
+		t.Fatalf("doBuild: %v", err)
+	}
+
+	opts.timeout = time.Second
+	ctx, cancel := opts.withTimeout(context.Background())
+	defer cancel()
+	_, _, err = doPublish(ctx, res, opts)
+	err = opts.timeoutError(ctx, "publish", err)
+	if err == nil || !strings.Contains(err.Error(), "publish exceeded timeout of 1s") {
+		t.Fatalf("expected the publish to exceed its timeout, got %v", err)
+	}
+}
+
+func TestTimeout_Unset(t *testing.T) {
+	opts := buildOptions{}
+	ctx, cancel := opts.withTimeout(context.Background())
+	defer cancel()
+	if _, ok := ctx.Deadline(); ok {
+		t.Error("expected no deadline without a timeout")
+	}
+}
@@ -0,0 +1,114 @@
+package provider
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
+)
+
+// caTransport returns a transport for registry requests that trusts the certificates in caCert in addition to the system's.
+// caCert is either PEM-encoded certificates or the path to a file containing them.
+func caTransport(caCert string) (http.RoundTripper, error) {
+	pem, err := readPEM(caCert)
+	if err != nil {
+		return nil, fmt.Errorf("reading CA certificates: %w", err)
+	}
+
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		pool = x509.NewCertPool() // Not all platforms have a system pool; trust only caCert there.
+	}
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, errors.New("no PEM-encoded certificates found in CA certificates")
+	}
+
+	t := remote.DefaultTransport.(*http.Transport).Clone()
+	if t.TLSClientConfig == nil {
+		t.TLSClientConfig = &tls.Config{} //nolint: gosec // MinVersion is left to the Go default, like remote.DefaultTransport.
+	}
+	t.TLSClientConfig.RootCAs = pool
+	return t, nil
+}
+
+// clientCertTransport returns a copy of t, or of the default transport if t is nil, that presents the client certificate cert
+// with its private key key to registries that require mutual TLS. Each is either PEM-encoded or the path to a file containing it.
+func clientCertTransport(t http.RoundTripper, cert, key string) (http.RoundTripper, error) {
+	certPEM, err := readPEM(cert)
+	if err != nil {
+		return nil, fmt.Errorf("reading client certificate: %w", err)
+	}
+	keyPEM, err := readPEM(key)
+	if err != nil {
+		return nil, fmt.Errorf("reading client key: %w", err)
+	}
+	pair, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return nil, fmt.Errorf("loading client certificate: %w", err)
+	}
+
+	ht, ok := t.(*http.Transport)
+	if !ok {
+		ht = remote.DefaultTransport.(*http.Transport)
+	}
+	ht = ht.Clone()
+	if ht.TLSClientConfig == nil {
+		ht.TLSClientConfig = &tls.Config{} //nolint: gosec // MinVersion is left to the Go default, like remote.DefaultTransport.
+	}
+	ht.TLSClientConfig.Certificates = []tls.Certificate{pair}
+	return ht, nil
+}
+
+// retryStatusCodes are the statuses retryTransport retries, in addition to network errors.
+// Statuses that registries use to answer checks, like 401 and 404, are left alone.
+var retryStatusCodes = []int{
+	http.StatusRequestTimeout,
+	http.StatusTooManyRequests,
+	http.StatusInternalServerError,
+	http.StatusBadGateway,
+	http.StatusServiceUnavailable,
+	http.StatusGatewayTimeout,
+}
+
+// retryBackoff returns the backoff to retry registry requests count times with, waiting d before the first retry.
+func retryBackoff(count int, d time.Duration) remote.Backoff {
+	return remote.Backoff{Duration: d, Factor: 2.0, Jitter: 0.1, Steps: count + 1}
+}
+
+// retryTransport returns t, or the default transport if t is nil, retrying requests that fail with a network error or retryStatusCodes with backoff.
+// It wraps the transport given to ko's publisher too, which doesn't take retry options of its own.
+func retryTransport(t http.RoundTripper, backoff remote.Backoff) http.RoundTripper {
+	if t == nil {
+		t = remote.DefaultTransport
+	}
+	return transport.NewRetry(t, transport.WithRetryBackoff(backoff), transport.WithRetryStatusCodes(retryStatusCodes...))
+}
+
+// readPEM returns v if it's PEM-encoded, or the contents of the file at path v otherwise.
+func readPEM(v string) ([]byte, error) {
+	if strings.Contains(v, "-----BEGIN") {
+		return []byte(v), nil
+	}
+	return os.ReadFile(v)
+}
+
+// insecureTransport returns a copy of t, or of the default transport if t is nil, that doesn't verify registries' certificates.
+func insecureTransport(t http.RoundTripper) http.RoundTripper {
+	ht, ok := t.(*http.Transport)
+	if !ok {
+		ht = remote.DefaultTransport.(*http.Transport)
+	}
+	ht = ht.Clone()
+	if ht.TLSClientConfig == nil {
+		ht.TLSClientConfig = &tls.Config{} //nolint: gosec // MinVersion is left to the Go default, like remote.DefaultTransport.
+	}
+	ht.TLSClientConfig.InsecureSkipVerify = true //nolint: gosec // Only with the provider's insecure, for registries with self-signed certificates.
+	return ht
+}
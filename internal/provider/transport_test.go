@@ -0,0 +1,332 @@
+package provider
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+)
+
+func TestCATransport(t *testing.T) {
+	// Setup a local registry serving TLS with a certificate that isn't in the system trust store.
+	srv := httptest.NewTLSServer(registry.New())
+	defer srv.Close()
+	ref, err := name.ParseReference(strings.TrimPrefix(srv.URL, "https://") + "/test/ca")
+	if err != nil {
+		t.Fatalf("ParseReference: %v", err)
+	}
+	img, err := random.Image(1024, 1)
+	if err != nil {
+		t.Fatalf("random.Image: %v", err)
+	}
+
+	caCert := string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw}))
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	if err := os.WriteFile(caFile, []byte(caCert), 0o600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	if err := remote.Write(ref, img); err == nil {
+		t.Fatal("expected pushing without the CA certificate to fail")
+	}
+	for desc, c := range map[string]string{"PEM": caCert, "file": caFile} {
+		t.Run(desc, func(t *testing.T) {
+			transport, err := caTransport(c)
+			if err != nil {
+				t.Fatalf("caTransport: %v", err)
+			}
+			opts := buildOptions{imageRepo: ref.Context().String(), transport: transport}
+			if err := remote.Write(ref, img, opts.remoteOptions(context.Background())...); err != nil {
+				t.Fatalf("remote.Write: %v", err)
+			}
+		})
+	}
+
+	for _, c := range []string{filepath.Join(t.TempDir(), "missing.pem"), "-----BEGIN CERTIFICATE-----\nnot a cert\n-----END CERTIFICATE-----\n"} {
+		if _, err := caTransport(c); err == nil {
+			t.Errorf("caTransport(%q): expected error", c)
+		}
+	}
+}
+
+func TestInsecure(t *testing.T) {
+	for _, tc := range []struct {
+		desc  string
+		newFn func(http.Handler) *httptest.Server
+	}{
+		{"plain HTTP", httptest.NewServer},
+		{"self-signed TLS", httptest.NewTLSServer},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			srv := tc.newFn(registry.New())
+			defer srv.Close()
+			// Name the registry with a host that isn't assumed to be insecure the way localhost is,
+			// and send requests for it to the test server.
+			addr := srv.Listener.Addr().String()
+			_, port, _ := strings.Cut(addr, ":")
+			dialer := remote.DefaultTransport.(*http.Transport).Clone()
+			dialer.DialContext = func(ctx context.Context, network, _ string) (net.Conn, error) {
+				return (&net.Dialer{}).DialContext(ctx, network, addr)
+			}
+			url := "registry.example:" + port + "/test"
+
+			base := url + "/base:latest"
+			img, err := random.Image(1024, 1)
+			if err != nil {
+				t.Fatalf("random.Image: %v", err)
+			}
+			if img, err = mutate.ConfigFile(img, &v1.ConfigFile{OS: "linux", Architecture: "amd64"}); err != nil {
+				t.Fatalf("mutate.ConfigFile: %v", err)
+			}
+			baseRef, err := name.ParseReference(base, name.Insecure)
+			if err != nil {
+				t.Fatalf("ParseReference: %v", err)
+			}
+			if err := remote.Write(baseRef, img, remote.WithTransport(insecureTransport(dialer))); err != nil {
+				t.Fatalf("pushing base image: %v", err)
+			}
+
+			for _, insecure := range []bool{false, true} {
+				opts := buildOptions{
+					ip:         "github.com/ko-build/terraform-provider-ko/cmd/test",
+					workingDir: ".",
+					imageRepo:  url,
+					platforms:  []string{"linux/amd64"},
+					baseImage:  base,
+					sbom:       "none",
+					transport:  dialer,
+					insecure:   insecure,
+				}
+				if insecure {
+					opts.transport = insecureTransport(dialer)
+				}
+				res, _, err := doBuild(context.Background(), opts)
+				if !insecure {
+					if err == nil {
+						t.Error("expected fetching the base image to fail without insecure")
+					}
+					continue
+				}
+				if err != nil {
+					t.Fatalf("doBuild: %v", err)
+				}
+				ref, _, err := doPublish(context.Background(), res, opts)
+				if err != nil {
+					t.Fatalf("doPublish: %v", err)
+				}
+				if exists, err := imageExists(context.Background(), ref, opts); err != nil || !exists {
+					t.Errorf("expected %s to exist, got %t, %v", ref, exists, err)
+				}
+			}
+		})
+	}
+}
+
+func TestClientCertTransport(t *testing.T) {
+	// Generate a self-signed client certificate, which the registry trusts as its own CA.
+	cert, certPEM, keyPEM := newClientCert(t)
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "client.pem"), filepath.Join(dir, "client-key.pem")
+	if err := os.WriteFile(certFile, []byte(certPEM), 0o600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	if err := os.WriteFile(keyFile, []byte(keyPEM), 0o600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	// Setup a local registry serving TLS with a private CA that requires client certificates.
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(cert)
+	srv := httptest.NewUnstartedServer(registry.New())
+	srv.TLS = &tls.Config{ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: clientCAs} //nolint: gosec
+	srv.StartTLS()
+	defer srv.Close()
+	ref, err := name.ParseReference(strings.TrimPrefix(srv.URL, "https://") + "/test/mtls")
+	if err != nil {
+		t.Fatalf("ParseReference: %v", err)
+	}
+	img, err := random.Image(1024, 1)
+	if err != nil {
+		t.Fatalf("random.Image: %v", err)
+	}
+	caTr, err := caTransport(string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw})))
+	if err != nil {
+		t.Fatalf("caTransport: %v", err)
+	}
+
+	if err := remote.Write(ref, img, remote.WithTransport(caTr)); err == nil {
+		t.Fatal("expected pushing without the client certificate to fail")
+	}
+	for desc, c := range map[string][2]string{"PEM": {certPEM, keyPEM}, "file": {certFile, keyFile}} {
+		t.Run(desc, func(t *testing.T) {
+			transport, err := clientCertTransport(caTr, c[0], c[1])
+			if err != nil {
+				t.Fatalf("clientCertTransport: %v", err)
+			}
+			opts := buildOptions{imageRepo: ref.Context().String(), transport: transport}
+			if err := remote.Write(ref, img, opts.remoteOptions(context.Background())...); err != nil {
+				t.Fatalf("remote.Write: %v", err)
+			}
+		})
+	}
+
+	if _, err := clientCertTransport(nil, certPEM, certPEM); err == nil {
+		t.Error("expected an error with a certificate in place of the key")
+	}
+}
+
+func TestRetryTransport(t *testing.T) {
+	// Setup a local registry that rate limits the first two requests for each base manifest, and counts manifest requests.
+	reg := registry.New()
+	var mu sync.Mutex
+	requests := map[string]int{}
+	var flaky atomic.Bool
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if flaky.Load() && strings.Contains(r.URL.Path, "/manifests/") {
+			mu.Lock()
+			requests[r.URL.Path]++
+			n := requests[r.URL.Path]
+			mu.Unlock()
+			if n <= 2 && strings.Contains(r.URL.Path, "/base/") {
+				w.WriteHeader(http.StatusTooManyRequests)
+				return
+			}
+		}
+		reg.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+	parts := strings.Split(srv.URL, ":")
+	url := fmt.Sprintf("localhost:%s/test", parts[len(parts)-1])
+	base := pushBaseIndex(t, url+"/base", v1.Platform{OS: "linux", Architecture: "amd64"})
+	flaky.Store(true)
+
+	// 429 isn't retried by default.
+	opts := buildOptions{baseImage: base, platforms: []string{"linux/amd64"}}
+	if _, _, err := opts.fetchBase(); err == nil {
+		t.Fatal("expected fetching the base to fail without retries")
+	}
+
+	backoff := retryBackoff(2, 10*time.Millisecond)
+	opts.transport, opts.retryBackoff = retryTransport(nil, backoff), backoff
+	if _, _, err := opts.fetchBase(); err != nil {
+		t.Fatalf("fetchBase with retries: %v", err)
+	}
+
+	// Statuses that answer checks, like 404, aren't retried.
+	if exists, err := imageExists(context.Background(), url+"/missing:latest", opts); err != nil || exists {
+		t.Fatalf("imageExists = %t, %v; want false", exists, err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if got := requests["/v2/test/missing/manifests/latest"]; got != 1 {
+		t.Errorf("expected 1 request for the missing manifest, got %d", got)
+	}
+}
+
+func TestRetryTransport_OneLayer(t *testing.T) {
+	// Setup a local registry that is always unavailable to look up the "down" tag, or to put manifests,
+	// and counts the attempts at each.
+	reg := registry.New()
+	var gets, puts atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodPut && strings.Contains(r.URL.Path, "/manifests/"):
+			puts.Add(1)
+		case strings.HasSuffix(r.URL.Path, "/manifests/down"):
+			gets.Add(1)
+		default:
+			reg.ServeHTTP(w, r)
+			return
+		}
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+	parts := strings.Split(srv.URL, ":")
+	repo := fmt.Sprintf("localhost:%s/test/unavailable", parts[len(parts)-1])
+	down, err := name.ParseReference(repo + ":down")
+	if err != nil {
+		t.Fatalf("ParseReference: %v", err)
+	}
+	ref, err := name.ParseReference(repo + ":latest")
+	if err != nil {
+		t.Fatalf("ParseReference: %v", err)
+	}
+	img, err := random.Image(1024, 1)
+	if err != nil {
+		t.Fatalf("random.Image: %v", err)
+	}
+
+	// Both reads, retried by the provider's transport, and uploads, retried by go-containerregistry,
+	// are attempted once per step of the backoff, rather than again by each layer.
+	backoff := retryBackoff(2, time.Millisecond)
+	opts := buildOptions{transport: retryTransport(nil, backoff), retryBackoff: backoff}
+	if _, err := remote.Head(down, opts.remoteOptions(context.Background())...); err == nil {
+		t.Fatal("expected the manifest lookup to fail")
+	}
+	if err := remote.Write(ref, img, opts.remoteOptions(context.Background())...); err == nil {
+		t.Fatal("expected writing the image to fail")
+	}
+	if got := gets.Load(); got != int32(backoff.Steps) {
+		t.Errorf("expected %d attempts to look up the manifest, got %d", backoff.Steps, got)
+	}
+	if got := puts.Load(); got != int32(backoff.Steps) {
+		t.Errorf("expected %d attempts to put the manifest, got %d", backoff.Steps, got)
+	}
+}
+
+// newClientCert generates a self-signed client certificate, which can be trusted as its own CA,
+// and returns it along with the PEM encoding of it and its key.
+func newClientCert(t *testing.T) (*x509.Certificate, string, string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "ko client"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("CreateCertificate: %v", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("ParseCertificate: %v", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("MarshalECPrivateKey: %v", err)
+	}
+	return cert, string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})),
+		string(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}))
+}